@@ -2,18 +2,13 @@ package appstore
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"time"
-
-	"github.com/golang-jwt/jwt/v5"
 )
 
 // HTTPClient is an interface for making HTTP requests.
@@ -40,13 +35,10 @@ func (e *APIException) Error() string {
 // APIClient is a client for interacting with the App Store Server API.
 // It handles authentication via JWT tokens and provides methods for all API endpoints.
 type APIClient struct {
-	signingKey  *ecdsa.PrivateKey
-	keyID       string
-	issuerID    string
-	bundleID    string
-	environment Environment
-	baseURL     string
-	httpClient  HTTPClient
+	tokenProvider TokenProvider
+	environment   Environment
+	baseURL       string
+	httpClient    HTTPClient
 }
 
 // NewAPIClient creates a new API client with default HTTP client settings.
@@ -58,23 +50,17 @@ func NewAPIClient(signingKey []byte, keyID, issuerID, bundleID string, environme
 // NewAPIClientWithHTTPClient creates a new API client with a custom HTTP client.
 // This allows for custom timeout settings, proxies, or mock HTTP clients for testing.
 func NewAPIClientWithHTTPClient(signingKey []byte, keyID, issuerID, bundleID string, environment Environment, httpClient HTTPClient) (*APIClient, error) {
-	if environment == ENVIRONMENT_XCODE {
-		return nil, errors.New("unsupported environment for an APIClient: Xcode")
-	}
-
-	block, _ := pem.Decode(signingKey)
-	if block == nil {
-		return nil, errors.New("failed to parse PEM block from signing key")
-	}
-
-	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	tokenProvider, err := NewInAppKeyTokenProvider(signingKey, keyID, issuerID, bundleID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %v", err)
+		return nil, err
 	}
+	return NewAPIClientWithTokenProvider(tokenProvider, environment, httpClient)
+}
 
-	privateKey, ok := key.(*ecdsa.PrivateKey)
-	if !ok {
-		return nil, errors.New("key is not an ECDSA private key")
+// NewAPIClientWithTokenProvider creates a new API client that authenticates requests with tokens from the given provider.
+func NewAPIClientWithTokenProvider(tokenProvider TokenProvider, environment Environment, httpClient HTTPClient) (*APIClient, error) {
+	if tokenProvider == nil {
+		return nil, errors.New("token provider is required")
 	}
 
 	var baseURL string
@@ -85,33 +71,20 @@ func NewAPIClientWithHTTPClient(signingKey []byte, keyID, issuerID, bundleID str
 		baseURL = "https://api.storekit-sandbox.itunes.apple.com"
 	case ENVIRONMENT_LOCAL_TESTING:
 		baseURL = "https://local-testing-base-url"
+	case ENVIRONMENT_XCODE:
+		return nil, errors.New("unsupported environment for an APIClient: Xcode")
 	default:
 		return nil, fmt.Errorf("invalid environment: %v", environment)
 	}
 
 	return &APIClient{
-		signingKey:  privateKey,
-		keyID:       keyID,
-		issuerID:    issuerID,
-		bundleID:    bundleID,
-		environment: environment,
-		baseURL:     baseURL,
-		httpClient:  httpClient,
+		tokenProvider: tokenProvider,
+		environment:   environment,
+		baseURL:       baseURL,
+		httpClient:    httpClient,
 	}, nil
 }
 
-func (c *APIClient) generateToken() (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
-		"bid": c.bundleID,
-		"iss": c.issuerID,
-		"aud": "appstoreconnect-v1",
-		"exp": time.Now().Add(5 * time.Minute).Unix(),
-	})
-	token.Header["kid"] = c.keyID
-
-	return token.SignedString(c.signingKey)
-}
-
 func (c *APIClient) makeRequest(method, path string, queryParams url.Values, body, destination any) error {
 	fullURL := c.baseURL + path
 	if len(queryParams) > 0 {
@@ -132,7 +105,7 @@ func (c *APIClient) makeRequest(method, path string, queryParams url.Values, bod
 		return err
 	}
 
-	token, err := c.generateToken()
+	token, err := c.tokenProvider.Token()
 	if err != nil {
 		return err
 	}
@@ -269,9 +242,13 @@ func (c *APIClient) SetAppAccountToken(originalTransactionID string, updateAppAc
 }
 
 // UploadImage uploads an image to use for retention messaging.
+// The image is validated locally first; a *ValidationException is returned without contacting the server if it doesn't meet the requirements.
 //
 // https://developer.apple.com/documentation/retentionmessaging/upload-image
 func (c *APIClient) UploadImage(imageIdentifier string, image []byte) error {
+	if err := ValidateRetentionImage(image); err != nil {
+		return err
+	}
 	path := fmt.Sprintf("/inApps/v1/messaging/image/%s", imageIdentifier)
 	return c.makeRequestWithBinaryBody("PUT", path, nil, image, "image/png", nil)
 }
@@ -297,9 +274,13 @@ func (c *APIClient) GetImageList() (*GetImageListResponse, error) {
 }
 
 // UploadMessage uploads a message to use for retention messaging.
+// The message is validated locally first; a *ValidationException is returned without contacting the server if it exceeds any length limit.
 //
 // https://developer.apple.com/documentation/retentionmessaging/upload-message
 func (c *APIClient) UploadMessage(messageIdentifier string, uploadMessageRequestBody UploadMessageRequestBody) error {
+	if err := uploadMessageRequestBody.Validate(); err != nil {
+		return err
+	}
 	path := fmt.Sprintf("/inApps/v1/messaging/message/%s", messageIdentifier)
 	return c.makeRequest("PUT", path, nil, uploadMessageRequestBody, nil)
 }
@@ -325,9 +306,13 @@ func (c *APIClient) GetMessageList() (*GetMessageListResponse, error) {
 }
 
 // ConfigureDefaultMessage configures a default message for a specific product in a specific locale.
+// The locale is validated locally first; a *ValidationException is returned without contacting the server if it isn't a valid BCP 47 tag.
 //
 // https://developer.apple.com/documentation/retentionmessaging/configure-default-message
 func (c *APIClient) ConfigureDefaultMessage(productID, locale string, defaultConfigurationRequest DefaultConfigurationRequest) error {
+	if err := ValidateLocale(locale); err != nil {
+		return err
+	}
 	path := fmt.Sprintf("/inApps/v1/messaging/default/%s/%s", productID, locale)
 	return c.makeRequest("PUT", path, nil, defaultConfigurationRequest, nil)
 }
@@ -363,7 +348,7 @@ func (c *APIClient) makeRequestWithBinaryBody(method, path string, queryParams u
 		return err
 	}
 
-	token, err := c.generateToken()
+	token, err := c.tokenProvider.Token()
 	if err != nil {
 		return err
 	}
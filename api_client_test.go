@@ -708,12 +708,13 @@ func TestAPIError_InvalidAppAccountTokenUUID(t *testing.T) {
 // Test UploadImage
 func TestUploadImage(t *testing.T) {
 	assert := assert.New(t)
+	image := createTestPNG(t, RetentionImageWidth, RetentionImageHeight)
 	client := createMockAPIClient(t, "", "PUT", "https://local-testing-base-url/inApps/v1/messaging/image/img_123", nil, nil, 204)
-	client.httpClient.(*MockHTTPClient).expectedBinaryData = []byte("fake-image-data")
+	client.httpClient.(*MockHTTPClient).expectedBinaryData = image
 	client.httpClient.(*MockHTTPClient).expectedContentType = "image/png"
 	client.httpClient.(*MockHTTPClient).responseBody = []byte("")
 
-	err := client.UploadImage("img_123", []byte("fake-image-data"))
+	err := client.UploadImage("img_123", image)
 	assert.NoError(err, "UploadImage failed")
 }
 
@@ -1054,11 +1055,12 @@ func TestUploadMessage_WithImage(t *testing.T) {
 // Test UploadImage: Error path
 func TestUploadImage_Error(t *testing.T) {
 	assert := assert.New(t)
+	image := createTestPNG(t, RetentionImageWidth, RetentionImageHeight)
 	client := createMockAPIClient(t, "apiException.json", "PUT", "https://local-testing-base-url/inApps/v1/messaging/image/img_123", nil, nil, 500)
-	client.httpClient.(*MockHTTPClient).expectedBinaryData = []byte("fake-image-data")
+	client.httpClient.(*MockHTTPClient).expectedBinaryData = image
 	client.httpClient.(*MockHTTPClient).expectedContentType = "image/png"
 
-	err := client.UploadImage("img_123", []byte("fake-image-data"))
+	err := client.UploadImage("img_123", image)
 	assert.Error(err, "Expected error for UploadImage")
 
 	apiErr, ok := err.(*APIException)
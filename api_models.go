@@ -1,5 +1,7 @@
 package appstore
 
+import "encoding/json"
+
 // HistoryResponse is a response that contains the customer's transaction history for an app.
 //
 // https://developer.apple.com/documentation/appstoreserverapi/historyresponse
@@ -575,6 +577,21 @@ type JWSTransactionDecodedPayload struct {
 	//
 	// https://developer.apple.com/documentation/appstoreservernotifications/revocationpercentage
 	RevocationPercentage int32 `json:"revocationPercentage,omitempty"`
+
+	// Properties of the payload that this library doesn't model yet, keyed by their JSON name.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes the payload, keeping unrecognized properties in Extra.
+func (p *JWSTransactionDecodedPayload) UnmarshalJSON(data []byte) error {
+	type plain JWSTransactionDecodedPayload
+	return unmarshalWithExtra(data, (*plain)(p), &p.Extra)
+}
+
+// MarshalJSON encodes the payload, including the properties in Extra.
+func (p JWSTransactionDecodedPayload) MarshalJSON() ([]byte, error) {
+	type plain JWSTransactionDecodedPayload
+	return marshalWithExtra(plain(p), p.Extra)
 }
 
 // JWSRenewalInfoDecodedPayload is a decoded payload containing subscription renewal information for an auto-renewable subscription.
@@ -685,6 +702,21 @@ type JWSRenewalInfoDecodedPayload struct {
 	//
 	// https://developer.apple.com/documentation/appstoreserverapi/offerPeriod
 	OfferPeriod string `json:"offerPeriod,omitempty"`
+
+	// Properties of the payload that this library doesn't model yet, keyed by their JSON name.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes the payload, keeping unrecognized properties in Extra.
+func (p *JWSRenewalInfoDecodedPayload) UnmarshalJSON(data []byte) error {
+	type plain JWSRenewalInfoDecodedPayload
+	return unmarshalWithExtra(data, (*plain)(p), &p.Extra)
+}
+
+// MarshalJSON encodes the payload, including the properties in Extra.
+func (p JWSRenewalInfoDecodedPayload) MarshalJSON() ([]byte, error) {
+	type plain JWSRenewalInfoDecodedPayload
+	return marshalWithExtra(plain(p), p.Extra)
 }
 
 // AppTransaction is information that represents the customer’s purchase of the app, cryptographically signed by the App Store.
@@ -755,4 +787,19 @@ type AppTransaction struct {
 	//
 	// https://developer.apple.com/documentation/storekit/apptransaction/originalplatform
 	OriginalPlatform PurchasePlatform `json:"originalPlatform,omitempty"`
+
+	// Properties of the payload that this library doesn't model yet, keyed by their JSON name.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes the payload, keeping unrecognized properties in Extra.
+func (p *AppTransaction) UnmarshalJSON(data []byte) error {
+	type plain AppTransaction
+	return unmarshalWithExtra(data, (*plain)(p), &p.Extra)
+}
+
+// MarshalJSON encodes the payload, including the properties in Extra.
+func (p AppTransaction) MarshalJSON() ([]byte, error) {
+	type plain AppTransaction
+	return marshalWithExtra(plain(p), p.Extra)
 }
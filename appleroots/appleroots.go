@@ -0,0 +1,90 @@
+// Package appleroots embeds the Apple root certificates that sign App Store data.
+//
+// The certificates are published at https://www.apple.com/certificateauthority/.
+// Signed transactions, renewal info and notifications from the App Store chain to Apple Root CA - G3.
+//
+// Only Apple Root CA - G3 is embedded. App Store signed data uses ECDSA keys, and G3 is Apple's ECDSA root;
+// Apple Root CA - G2 is an RSA root that doesn't sign it, so embedding G2 would only widen the set of trusted
+// chains. To trust another root as well, download it from the page above and pass it with the result of DER.
+package appleroots
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+//go:embed AppleRootCA-G3.cer
+var appleRootCAG3 []byte
+
+// Certificate describes an embedded root certificate.
+type Certificate struct {
+	// The common name of the certificate.
+	Name string
+
+	// The SHA-256 fingerprint of the DER encoding, as uppercase hex pairs separated by colons.
+	SHA256Fingerprint string
+
+	// The time after which the certificate is no longer valid.
+	NotAfter time.Time
+
+	// The DER encoding of the certificate.
+	DER []byte
+}
+
+var certificates = []Certificate{
+	{
+		Name:              "Apple Root CA - G3",
+		SHA256Fingerprint: "63:34:3A:BF:B8:9A:6A:03:EB:B5:7E:9B:3F:5F:A7:BE:7C:4F:5C:75:6F:30:17:B3:A8:C4:88:C3:65:3E:91:79",
+		NotAfter:          time.Date(2039, time.April, 30, 18, 19, 6, 0, time.UTC),
+		DER:               appleRootCAG3,
+	},
+}
+
+// All returns the embedded root certificates.
+func All() []Certificate {
+	all := make([]Certificate, len(certificates))
+	for i, c := range certificates {
+		c.DER = append([]byte(nil), c.DER...)
+		all[i] = c
+	}
+	return all
+}
+
+// DER returns the DER encodings of the embedded root certificates,
+// in the form accepted by appstore.NewSignedDataVerifier.
+func DER() [][]byte {
+	der := make([][]byte, len(certificates))
+	for i, c := range certificates {
+		der[i] = append([]byte(nil), c.DER...)
+	}
+	return der
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a DER encoded certificate,
+// formatted as uppercase hex pairs separated by colons.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	encoded := strings.ToUpper(hex.EncodeToString(sum[:]))
+	pairs := make([]string, 0, len(sum))
+	for i := 0; i < len(encoded); i += 2 {
+		pairs = append(pairs, encoded[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
+
+// Parse parses the embedded root certificates.
+func Parse() ([]*x509.Certificate, error) {
+	parsed := make([]*x509.Certificate, 0, len(certificates))
+	for _, c := range certificates {
+		cert, err := x509.ParseCertificate(c.DER)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, cert)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,30 @@
+package appleroots
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbeddedCertificatesMatchMetadata(t *testing.T) {
+	assert := assert.New(t)
+	parsed, err := Parse()
+	assert.NoError(err, "Failed to parse embedded certificates")
+
+	all := All()
+	assert.Equal(len(all), len(parsed), "Certificate count")
+	for i, c := range all {
+		assert.Equal(c.SHA256Fingerprint, Fingerprint(c.DER), "Fingerprint of %s", c.Name)
+		assert.Equal(c.Name, parsed[i].Subject.CommonName, "Name")
+		assert.True(c.NotAfter.Equal(parsed[i].NotAfter), "NotAfter of %s", c.Name)
+		assert.True(parsed[i].IsCA, "%s is a CA", c.Name)
+		assert.Equal(parsed[i].RawSubject, parsed[i].RawIssuer, "%s is self-signed", c.Name)
+	}
+}
+
+func TestDERReturnsCopies(t *testing.T) {
+	assert := assert.New(t)
+	der := DER()
+	der[0][0] ^= 0xFF
+	assert.NotEqual(der[0][0], DER()[0][0], "Callers can't modify the embedded certificates")
+}
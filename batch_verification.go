@@ -0,0 +1,116 @@
+package appstore
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// SignedTransactionResult is the outcome of verifying one item of a batch of signed transactions.
+type SignedTransactionResult struct {
+	// The decoded transaction, or nil if verification failed.
+	Transaction *JWSTransactionDecodedPayload
+
+	// The error from verifying the transaction, or nil.
+	Err error
+}
+
+// VerifyAndDecodeSignedTransactions verifies and decodes signedTransactions in parallel, using at most concurrency
+// goroutines, or GOMAXPROCS if concurrency isn't positive. Transactions signed with the same certificate chain share
+// one chain verification, so revocation is checked once per chain rather than once per transaction.
+//
+// The results are in the same order as signedTransactions, and each item that fails verification carries its own error.
+// Every transaction must have the verifier's bundle ID and its primary environment, the first one given to
+// WithEnvironments, otherwise it fails with INVALID_APP_IDENTIFIER or INVALID_ENVIRONMENT.
+//
+// If ctx is done before every transaction is verified, the items that weren't started fail with ctx.Err(), which is
+// also returned. Items waiting for another item's verification of their chain fail with RETRYABLE_VERIFICATION_FAILURE
+// wrapping ctx.Err().
+func (v *SignedDataVerifier) VerifyAndDecodeSignedTransactions(ctx context.Context, signedTransactions []string, concurrency int) ([]SignedTransactionResult, error) {
+	results, err := v.verifyTransactions(ctx, signedTransactions, concurrency)
+	checkBatchIdentity(results, v.bundleID, v.environment)
+	return results, err
+}
+
+// VerifyAndDecodeHistoryResponse verifies and decodes the signed transactions of response like
+// VerifyAndDecodeSignedTransactions, and checks that every transaction has the bundle ID and environment of the response.
+func (v *SignedDataVerifier) VerifyAndDecodeHistoryResponse(ctx context.Context, response *HistoryResponse, concurrency int) ([]SignedTransactionResult, error) {
+	results, err := v.verifyTransactions(ctx, response.SignedTransactions, concurrency)
+	checkBatchIdentity(results, response.BundleId, response.Environment)
+	return results, err
+}
+
+// verifyTransactions verifies signedTransactions in parallel. It returns ctx.Err() if ctx was done before every item was started.
+func (v *SignedDataVerifier) verifyTransactions(ctx context.Context, signedTransactions []string, concurrency int) ([]SignedTransactionResult, error) {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	concurrency = min(concurrency, len(signedTransactions))
+
+	results := make([]SignedTransactionResult, len(signedTransactions))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				transaction, err := v.verifyBatchTransaction(ctx, signedTransactions[i])
+				results[i] = SignedTransactionResult{Transaction: transaction, Err: err}
+			}
+		}()
+	}
+
+	next := 0
+feed:
+	for ; next < len(signedTransactions) && ctx.Err() == nil; next++ {
+		select {
+		case indexes <- next:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if next == len(signedTransactions) {
+		return results, nil
+	}
+	for i := next; i < len(signedTransactions); i++ {
+		results[i] = SignedTransactionResult{Err: ctx.Err()}
+	}
+	return results, ctx.Err()
+}
+
+// verifyBatchTransaction is VerifyAndDecodeSignedTransaction, giving up when ctx is done while it waits for another
+// item's verification of the same chain.
+func (v *SignedDataVerifier) verifyBatchTransaction(ctx context.Context, signedTransaction string) (*JWSTransactionDecodedPayload, error) {
+	payload := &JWSTransactionDecodedPayload{}
+	if _, err := v.decodeSignedObjectContext(ctx, signedTransaction, payload, nil); err != nil {
+		return nil, err
+	}
+	if err := v.verifyDecoded(payload, nil); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// checkBatchIdentity fails every verified transaction that doesn't belong to the same app and environment as its batch.
+func checkBatchIdentity(results []SignedTransactionResult, bundleID string, environment Environment) {
+	for i, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		transaction := result.Transaction
+		var err error
+		switch {
+		case transaction.BundleId != bundleID:
+			err = NewVerificationException(INVALID_APP_IDENTIFIER, errors.New("bundleId differs from the batch: "+transaction.BundleId))
+		case transaction.Environment != environment:
+			err = NewVerificationException(INVALID_ENVIRONMENT, errors.New("environment differs from the batch: "+string(transaction.Environment)))
+		}
+		if err != nil {
+			results[i] = SignedTransactionResult{Err: err}
+		}
+	}
+}
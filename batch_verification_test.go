@@ -0,0 +1,149 @@
+package appstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestSignedTransactions(t *testing.T, pki *testPKI, count int, environment Environment) []string {
+	t.Helper()
+	signed := make([]string, count)
+	for i := range signed {
+		signed[i] = createTestSignedPayload(t, pki, jwt.MapClaims{
+			"transactionId": string(rune('a' + i)),
+			"bundleId":      "com.example",
+			"environment":   string(environment),
+		})
+	}
+	return signed
+}
+
+func TestVerifyAndDecodeSignedTransactions(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	responder := newTestOCSPResponder(t, pki)
+	verifier := createTestReportVerifier(t, pki, WithOCSPFetcher(responder))
+
+	signed := createTestSignedTransactions(t, pki, 20, ENVIRONMENT_SANDBOX)
+	signed[5] = signed[5][:len(signed[5])-4] + "AAAA"
+	results, err := verifier.VerifyAndDecodeSignedTransactions(context.Background(), signed, 8)
+	assert.NoError(err, "Batch completes")
+	assert.Len(results, 20, "One result per transaction")
+	for i, result := range results {
+		if i == 5 {
+			assertVerificationStatus(t, VERIFICATION_FAILURE, result.Err)
+			assert.Nil(result.Transaction, "No transaction for a failed item")
+			continue
+		}
+		if assert.NoError(result.Err, "Expected valid transaction") {
+			assert.Equal(string(rune('a'+i)), result.Transaction.TransactionId, "Results are in input order")
+		}
+	}
+	assert.Equal(2, responder.requests, "The shared chain is checked once")
+
+	results, err = verifier.VerifyAndDecodeSignedTransactions(context.Background(), nil, 0)
+	assert.NoError(err, "Empty batch")
+	assert.Empty(results, "No results")
+}
+
+func TestVerifyAndDecodeSignedTransactionsCrossChecksItems(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki,
+		WithEnvironments(ENVIRONMENT_SANDBOX, ENVIRONMENT_PRODUCTION),
+		WithAppAppleID(1234),
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED),
+	)
+
+	signed := createTestSignedTransactions(t, pki, 3, ENVIRONMENT_SANDBOX)
+	signed[2] = createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": "Production"})
+	results, err := verifier.VerifyAndDecodeSignedTransactions(context.Background(), signed, 2)
+	assert.NoError(err, "Batch completes")
+	assert.NoError(results[0].Err, "Expected valid transaction")
+	assert.NoError(results[1].Err, "Expected valid transaction")
+	assertVerificationStatus(t, INVALID_ENVIRONMENT, results[2].Err)
+}
+
+func TestVerifyAndDecodeSignedTransactionsChecksTheVerifierIdentity(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki,
+		WithEnvironments(ENVIRONMENT_SANDBOX, ENVIRONMENT_PRODUCTION),
+		WithAppAppleID(1234),
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED),
+	)
+
+	signed := createTestSignedTransactions(t, pki, 3, ENVIRONMENT_SANDBOX)
+	signed[0] = createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": "Production"})
+	results, err := verifier.VerifyAndDecodeSignedTransactions(context.Background(), signed, 1)
+	assert.NoError(err, "Batch completes")
+	assertVerificationStatus(t, INVALID_ENVIRONMENT, results[0].Err)
+	assert.NoError(results[1].Err, "A wrong first item doesn't fail the others")
+	assert.NoError(results[2].Err, "A wrong first item doesn't fail the others")
+}
+
+func TestVerifyAndDecodeHistoryResponse(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki, WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED))
+
+	response := &HistoryResponse{
+		BundleId:           "com.example",
+		Environment:        ENVIRONMENT_SANDBOX,
+		SignedTransactions: createTestSignedTransactions(t, pki, 2, ENVIRONMENT_SANDBOX),
+	}
+	results, err := verifier.VerifyAndDecodeHistoryResponse(context.Background(), response, 0)
+	assert.NoError(err, "Batch completes")
+	assert.NoError(results[0].Err, "Expected valid transaction")
+	assert.NoError(results[1].Err, "Expected valid transaction")
+
+	response.BundleId = "com.other"
+	results, err = verifier.VerifyAndDecodeHistoryResponse(context.Background(), response, 0)
+	assert.NoError(err, "Batch completes")
+	assertVerificationStatus(t, INVALID_APP_IDENTIFIER, results[0].Err)
+	assertVerificationStatus(t, INVALID_APP_IDENTIFIER, results[1].Err)
+}
+
+func TestVerifyAndDecodeSignedTransactionsCancelled(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki, WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := verifier.VerifyAndDecodeSignedTransactions(ctx, createTestSignedTransactions(t, pki, 3, ENVIRONMENT_SANDBOX), 1)
+	assert.ErrorIs(err, context.Canceled, "Cancelled batch")
+	assert.Len(results, 3, "One result per transaction")
+	for _, result := range results {
+		if result.Err != nil {
+			assert.ErrorIs(result.Err, context.Canceled, "Unverified items carry the context error")
+		}
+	}
+}
+
+// cancellingOCSPFetcher cancels a context when it is used
+type cancellingOCSPFetcher struct {
+	OCSPFetcher
+	cancel context.CancelFunc
+}
+
+func (f cancellingOCSPFetcher) FetchOCSP(server string, request []byte) ([]byte, error) {
+	f.cancel()
+	return f.OCSPFetcher.FetchOCSP(server, request)
+}
+
+func TestVerifyAndDecodeSignedTransactionsCancelledAfterEveryItemStarted(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	verifier := createTestReportVerifier(t, pki, WithOCSPFetcher(cancellingOCSPFetcher{OCSPFetcher: newTestOCSPResponder(t, pki), cancel: cancel}))
+
+	results, err := verifier.VerifyAndDecodeSignedTransactions(ctx, createTestSignedTransactions(t, pki, 1, ENVIRONMENT_SANDBOX), 1)
+	assert.NoError(err, "No item was skipped")
+	assert.NoError(results[0].Err, "Expected valid transaction")
+	assert.Error(ctx.Err(), "Cancelled during the batch")
+}
@@ -0,0 +1,195 @@
+package appstore
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"sync"
+	"time"
+)
+
+// ChainCache caches the public keys of verified certificate chains, so that signed data from a chain that was verified
+// recently skips parsing, chain building and revocation checks. When full, it evicts the least recently used chain.
+//
+// A ChainCache is safe for concurrent use and may be shared by several verifiers with WithSharedChainCache.
+// Chains are cached separately for each set of trusted roots, revocation mode, and for online and offline verification,
+// so a chain verified by one verifier is only reused by another that would have verified it the same way.
+type ChainCache struct {
+	size      int
+	ttl       time.Duration
+	mutex     sync.Mutex
+	entries   map[chainCacheKey]*list.Element
+	order     *list.List
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// ChainCacheStats reports how a ChainCache has been used.
+type ChainCacheStats struct {
+	// The number of lookups that found a usable chain.
+	Hits uint64
+
+	// The number of lookups that didn't, including those that found an expired chain.
+	Misses uint64
+
+	// The number of chains dropped to make room for another.
+	Evictions uint64
+
+	// The number of chains currently cached.
+	Entries int
+}
+
+type chainCacheKey struct {
+	roots  [sha256.Size]byte
+	chain  [sha256.Size]byte
+	online bool
+	mode   RevocationMode
+}
+
+type chainCacheItem struct {
+	key   chainCacheKey
+	entry cacheEntry
+}
+
+type cacheEntry struct {
+	publicKey *ecdsa.PublicKey
+	expiry    time.Time
+
+	// The trusted root the chain was verified against
+	root *x509.Certificate
+
+	// The period in which every certificate in the chain is valid
+	notBefore time.Time
+	notAfter  time.Time
+}
+
+// NewChainCache creates a cache that holds up to size verified chains, each for ttl.
+// For chains verified online, ttl is also how often revocation is checked again. A size of zero caches nothing.
+func NewChainCache(size int, ttl time.Duration) *ChainCache {
+	return &ChainCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[chainCacheKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Stats returns the cache's hit, miss and eviction counts and its current size.
+func (c *ChainCache) Stats() ChainCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return ChainCacheStats{Hits: c.hits, Misses: c.misses, Evictions: c.evictions, Entries: c.order.Len()}
+}
+
+// Purge removes every cached chain. It doesn't reset the stats.
+func (c *ChainCache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	clear(c.entries)
+	c.order.Init()
+}
+
+// get returns a cached chain that hasn't expired and may be used at effectiveDate.
+func (c *ChainCache) get(key chainCacheKey, now, effectiveDate time.Time) (cacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if ok && !now.Before(element.Value.(*chainCacheItem).entry.expiry) {
+		c.remove(element)
+		ok = false
+	}
+	if !ok || !element.Value.(*chainCacheItem).entry.validAt(effectiveDate) {
+		c.misses++
+		return cacheEntry{}, false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*chainCacheItem).entry, true
+}
+
+func (c *ChainCache) put(key chainCacheKey, entry cacheEntry) {
+	if c.size <= 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*chainCacheItem).entry = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.order.Len() >= c.size {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+	c.entries[key] = c.order.PushFront(&chainCacheItem{key: key, entry: entry})
+}
+
+func (c *ChainCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*chainCacheItem).key)
+}
+
+// newCacheEntry records a verified chain's public key and root, to expire after the cache's TTL.
+func (c *ChainCache) newCacheEntry(pubKey *ecdsa.PublicKey, chain []*x509.Certificate, now time.Time) cacheEntry {
+	entry := cacheEntry{
+		publicKey: pubKey,
+		expiry:    now.Add(c.ttl),
+		root:      chain[len(chain)-1],
+	}
+	entry.notBefore, entry.notAfter = chainValidity(chain)
+	return entry
+}
+
+// chainValidity returns the period in which every certificate in chain is valid.
+func chainValidity(chain []*x509.Certificate) (notBefore, notAfter time.Time) {
+	for _, cert := range chain {
+		if notBefore.IsZero() || cert.NotBefore.After(notBefore) {
+			notBefore = cert.NotBefore
+		}
+		if notAfter.IsZero() || cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+	return notBefore, notAfter
+}
+
+// validAt reports whether the cached chain may be used at the given effective date.
+// Without a recorded validity period, the entry is only checked against its expiry.
+func (e cacheEntry) validAt(effectiveDate time.Time) bool {
+	if e.notBefore.IsZero() && e.notAfter.IsZero() {
+		return true
+	}
+	return !effectiveDate.Before(e.notBefore) && !effectiveDate.After(e.notAfter)
+}
+
+// chainFingerprint identifies the base64 encoded certificates of an x5c header.
+func chainFingerprint(certificates []string) [sha256.Size]byte {
+	h := sha256.New()
+	for _, cert := range certificates {
+		h.Write([]byte(cert))
+		h.Write([]byte{'|'})
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// rootsFingerprint identifies a set of trusted roots, in order.
+func rootsFingerprint(roots []*x509.Certificate) [sha256.Size]byte {
+	h := sha256.New()
+	for _, root := range roots {
+		sum := sha256.Sum256(root.Raw)
+		h.Write(sum[:])
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// ChainCacheStats returns the stats of the cache of verified certificate chains that the verifier uses.
+func (v *SignedDataVerifier) ChainCacheStats() ChainCacheStats {
+	return v.chainVerifier.cache.Stats()
+}
@@ -0,0 +1,188 @@
+package appstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainCacheIsUsedOffline(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	cv, err := newChainVerifier([][]byte{pki.root.Raw})
+	assert.NoError(err, "Failed to create chain verifier")
+
+	pubKey, err := cv.verifyChain(pki.chain(), false, time.Now())
+	assert.NoError(err, "Expected valid chain")
+	cached, err := cv.verifyChain(pki.chain(), false, time.Now())
+	assert.NoError(err, "Expected valid chain")
+	assert.Same(pubKey, cached, "Public key comes from the cache")
+	assert.Equal(ChainCacheStats{Hits: 1, Misses: 1, Entries: 1}, cv.cache.Stats(), "Stats")
+
+	_, err = cv.verifyChain(pki.chain(), false, pki.leaf.NotAfter.Add(time.Hour))
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+
+	_, err = cv.verifyChain(pki.chain(), true, time.Now())
+	assert.Error(err, "Online verification doesn't reuse a chain verified offline")
+}
+
+func TestChainCacheExpiry(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	cv, err := newChainVerifier([][]byte{pki.root.Raw})
+	assert.NoError(err, "Failed to create chain verifier")
+	now := time.Now()
+	cv.now = func() time.Time { return now }
+
+	_, err = cv.verifyChain(pki.chain(), false, now)
+	assert.NoError(err, "Expected valid chain")
+	now = now.Add(cacheTimeLimit)
+	_, err = cv.verifyChain(pki.chain(), false, now)
+	assert.NoError(err, "Expected valid chain")
+	assert.Equal(ChainCacheStats{Misses: 2, Entries: 1}, cv.cache.Stats(), "Expired chain is verified again")
+}
+
+func TestSharedChainCache(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	cache := NewChainCache(8, time.Minute)
+	responder := newTestOCSPResponder(t, pki)
+
+	_, err := NewSignedDataVerifierWithOptions([][]byte{pki.root.Raw}, WithEnvironments(ENVIRONMENT_SANDBOX), WithSharedChainCache(nil))
+	assert.Error(err, "Shared cache must not be nil")
+
+	first := createTestReportVerifier(t, pki, WithOCSPFetcher(responder), WithSharedChainCache(cache))
+	second := createTestReportVerifier(t, pki, WithOCSPFetcher(responder), WithSharedChainCache(cache), WithBundleID("com.other"))
+	_, err = first.VerifyAndDecodeSignedTransaction(createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox"}))
+	assert.NoError(err, "Expected valid transaction")
+	_, err = second.VerifyAndDecodeSignedTransaction(createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.other", "environment": "Sandbox"}))
+	assert.NoError(err, "Expected valid transaction")
+	assert.Equal(2, responder.requests, "The second verifier reuses the chain")
+	assert.Equal(ChainCacheStats{Hits: 1, Misses: 1, Entries: 1}, second.ChainCacheStats(), "Stats are shared")
+
+	other := createTestPKI(t)
+	untrusting := createTestReportVerifier(t, other, WithOCSPFetcher(responder), WithSharedChainCache(cache))
+	_, err = untrusting.VerifyAndDecodeSignedTransaction(createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox"}))
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+}
+
+func TestChainCacheWithoutCapacity(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	cache := NewChainCache(0, time.Minute)
+	verifier := createTestReportVerifier(t, pki, WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED), WithSharedChainCache(cache))
+
+	signed := createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox"})
+	_, err := verifier.VerifyAndDecodeSignedTransaction(signed)
+	assert.NoError(err, "Expected valid transaction")
+	_, err = verifier.VerifyAndDecodeSignedTransaction(signed)
+	assert.NoError(err, "Expected valid transaction")
+	assert.Equal(ChainCacheStats{Misses: 2}, cache.Stats(), "Nothing is cached")
+
+	cache.Purge()
+	assert.Equal(ChainCacheStats{Misses: 2}, cache.Stats(), "Purge keeps the stats")
+}
+
+// blockingOCSPFetcher holds the first OCSP request until release is closed.
+type blockingOCSPFetcher struct {
+	*testOCSPResponder
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newBlockingOCSPFetcher(responder *testOCSPResponder) *blockingOCSPFetcher {
+	return &blockingOCSPFetcher{testOCSPResponder: responder, started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (f *blockingOCSPFetcher) FetchOCSP(server string, request []byte) ([]byte, error) {
+	f.once.Do(func() {
+		close(f.started)
+		<-f.release
+	})
+	return f.testOCSPResponder.FetchOCSP(server, request)
+}
+
+// verifyConcurrently verifies the chain of pki count times at once, while the first verification is held in its
+// first OCSP request, and returns the errors.
+func verifyConcurrently(cv *chainVerifier, fetcher *blockingOCSPFetcher, pki *testPKI, count int) []error {
+	now := time.Now()
+	results := make(chan error, count)
+	verify := func() {
+		_, err := cv.verifyChain(pki.chain(), true, now)
+		results <- err
+	}
+	go verify()
+	<-fetcher.started
+	for range count - 1 {
+		go verify()
+	}
+	// Let the others start waiting for the first
+	time.Sleep(50 * time.Millisecond)
+	close(fetcher.release)
+
+	errs := make([]error, count)
+	for i := range errs {
+		errs[i] = <-results
+	}
+	return errs
+}
+
+func TestConcurrentVerificationsShareTheResult(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	responder := newTestOCSPResponder(t, pki)
+	responder.err = errors.New("connection refused")
+	fetcher := newBlockingOCSPFetcher(responder)
+	// Revocation can't be confirmed, so the chain isn't cached even with capacity
+	cv := createTestOCSPChainVerifier(t, pki, fetcher, OCSPFailurePolicy{SoftFail: true, MaxStaleness: -1})
+	cv.cache = NewChainCache(maxCacheSize, cacheTimeLimit)
+
+	for _, err := range verifyConcurrently(cv, fetcher, pki, 5) {
+		assert.NoError(err, "Expected valid chain")
+	}
+	assert.Equal(2, responder.requests, "Revocation is checked once")
+	assert.Equal(0, cv.cache.Stats().Entries, "Degraded chains are not cached")
+}
+
+func TestConcurrentVerificationsShareTheError(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	responder := newTestOCSPResponder(t, pki)
+	responder.err = errors.New("connection refused")
+	fetcher := newBlockingOCSPFetcher(responder)
+	cv := createTestOCSPChainVerifier(t, pki, fetcher, OCSPFailurePolicy{})
+
+	for _, err := range verifyConcurrently(cv, fetcher, pki, 5) {
+		assertVerificationStatus(t, RETRYABLE_VERIFICATION_FAILURE, err)
+	}
+	assert.Equal(1, responder.requests, "Revocation is checked once")
+}
+
+func TestWaitingForConcurrentVerificationIsCancelled(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	fetcher := newBlockingOCSPFetcher(newTestOCSPResponder(t, pki))
+	cv := createTestOCSPChainVerifier(t, pki, fetcher, OCSPFailurePolicy{})
+
+	leader := make(chan error, 1)
+	go func() {
+		_, err := cv.verifyChain(pki.chain(), true, time.Now())
+		leader <- err
+	}()
+	<-fetcher.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := cv.verifyChainWithReport(ctx, pki.chain(), true, time.Now(), nil)
+	assertVerificationStatus(t, RETRYABLE_VERIFICATION_FAILURE, err)
+	assert.ErrorIs(err, context.Canceled, "The context error is kept")
+
+	close(fetcher.release)
+	assert.NoError(<-leader, "The first verification completes")
+}
@@ -0,0 +1,241 @@
+package appstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ConsumptionResponseWindow is how long after a CONSUMPTION_REQUEST notification the App Store accepts consumption information.
+//
+// https://developer.apple.com/documentation/appstoreserverapi/send-consumption-information
+const ConsumptionResponseWindow = 12 * time.Hour
+
+// maxConsumptionPercentage is 100%, expressed in milliunits.
+const maxConsumptionPercentage = 100000
+
+// Validate checks that the consumption request contains values the App Store accepts.
+// It returns a *ValidationException that lists every problem found.
+//
+// https://developer.apple.com/documentation/appstoreserverapi/consumptionrequest
+func (r ConsumptionRequest) Validate() error {
+	v := &validator{}
+	if !r.CustomerConsented {
+		v.add("customerConsented", API_ERROR_INVALID_CUSTOMER_CONSENTED, "the customer must consent before consumption information is sent")
+	}
+	if !r.DeliveryStatus.IsValid() {
+		v.add("deliveryStatus", API_ERROR_INVALID_DELIVERY_STATUS, "unknown delivery status %d", r.DeliveryStatus)
+	}
+	if r.ConsumptionPercentage < 0 || r.ConsumptionPercentage > maxConsumptionPercentage {
+		v.add("consumptionPercentage", API_ERROR_GENERAL_BAD_REQUEST, "%d is outside the range 0 to %d milliunits", r.ConsumptionPercentage, maxConsumptionPercentage)
+	}
+	if !r.RefundPreference.IsValid() {
+		v.add("refundPreference", API_ERROR_GENERAL_BAD_REQUEST, "unknown refund preference %d", r.RefundPreference)
+	}
+	return v.err()
+}
+
+// ConsumptionFacts are the usage facts about a purchase that a ConsumptionInfoProvider supplies.
+type ConsumptionFacts struct {
+	// Whether the customer consented to provide consumption data to the App Store.
+	// When false, no consumption information is sent.
+	CustomerConsented bool
+
+	// Whether you provided, prior to its purchase, a free sample or trial of the content, or information about its functionality.
+	SampleContentProvided bool
+
+	// Whether the app successfully delivered an in-app purchase that works properly.
+	DeliveryStatus DeliveryStatus
+
+	// The percentage, in milliunits, of the In-App Purchase the customer consumed, from 0 to 100000.
+	ConsumptionPercentage int32
+
+	// Your preferred outcome for the refund request.
+	RefundPreference RefundPreference
+}
+
+// ConsumptionInfoProvider supplies the usage facts for a purchase that is the subject of a consumption request.
+type ConsumptionInfoProvider interface {
+	ConsumptionFacts(ctx context.Context, transaction *JWSTransactionDecodedPayload, reason *ConsumptionRequestReason) (*ConsumptionFacts, error)
+}
+
+// SignedTransactionVerifier verifies and decodes a signed transaction. *SignedDataVerifier implements it.
+type SignedTransactionVerifier interface {
+	VerifyAndDecodeSignedTransaction(signedTransaction string) (*JWSTransactionDecodedPayload, error)
+}
+
+// ConsumptionInformationSender sends consumption information to the App Store. *APIClient implements it.
+type ConsumptionInformationSender interface {
+	SendConsumptionInformation(transactionID string, consumptionRequest ConsumptionRequest) error
+}
+
+// ConsumptionOutcome is the final result of responding to a consumption request.
+type ConsumptionOutcome string
+
+const (
+	CONSUMPTION_OUTCOME_SUBMITTED         ConsumptionOutcome = "SUBMITTED"
+	CONSUMPTION_OUTCOME_NO_CONSENT        ConsumptionOutcome = "NO_CONSENT"
+	CONSUMPTION_OUTCOME_INVALID           ConsumptionOutcome = "INVALID"
+	CONSUMPTION_OUTCOME_FAILED            ConsumptionOutcome = "FAILED"
+	CONSUMPTION_OUTCOME_DEADLINE_EXCEEDED ConsumptionOutcome = "DEADLINE_EXCEEDED"
+)
+
+// ConsumptionAuditRecord describes how a consumption request was handled.
+type ConsumptionAuditRecord struct {
+	NotificationUUID string
+	TransactionID    string
+	Reason           *ConsumptionRequestReason
+	Request          *ConsumptionRequest
+	Outcome          ConsumptionOutcome
+	Attempts         int
+	Deadline         time.Time
+	Err              error
+}
+
+// ConsumptionAuditSink receives the outcome of every consumption request the responder handles.
+type ConsumptionAuditSink interface {
+	RecordConsumptionResponse(ctx context.Context, record ConsumptionAuditRecord)
+}
+
+// ConsumptionResponder answers CONSUMPTION_REQUEST notifications by collecting usage facts from a provider
+// and sending them to the App Store, retrying transient failures until the response window closes.
+type ConsumptionResponder struct {
+	sender   ConsumptionInformationSender
+	verifier SignedTransactionVerifier
+	provider ConsumptionInfoProvider
+	audit    ConsumptionAuditSink
+
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	now            func() time.Time
+}
+
+// NewConsumptionResponder creates a new consumption responder.
+// The verifier decodes the signed transaction in each notification; the audit sink is optional and may be nil.
+func NewConsumptionResponder(sender ConsumptionInformationSender, verifier SignedTransactionVerifier, provider ConsumptionInfoProvider, audit ConsumptionAuditSink) (*ConsumptionResponder, error) {
+	if sender == nil || verifier == nil || provider == nil {
+		return nil, errors.New("sender, verifier and provider are required")
+	}
+	return &ConsumptionResponder{
+		sender:         sender,
+		verifier:       verifier,
+		provider:       provider,
+		audit:          audit,
+		initialBackoff: time.Second,
+		maxBackoff:     5 * time.Minute,
+		now:            time.Now,
+	}, nil
+}
+
+// Respond handles a verified CONSUMPTION_REQUEST notification.
+// It returns nil when consumption information was submitted, or when the customer didn't consent and nothing was sent.
+func (r *ConsumptionResponder) Respond(ctx context.Context, notification *ResponseBodyV2DecodedPayload) error {
+	if notification.NotificationType != NOTIFICATION_TYPE_CONSUMPTION_REQUEST {
+		return fmt.Errorf("unexpected notification type %s", notification.NotificationType)
+	}
+	if notification.Data == nil || notification.Data.SignedTransactionInfo == "" {
+		return errors.New("consumption request notification has no signed transaction")
+	}
+
+	record := ConsumptionAuditRecord{
+		NotificationUUID: notification.NotificationUUID,
+		Reason:           notification.Data.ConsumptionRequestReason,
+		Deadline:         notification.SignedDate.Time().Add(ConsumptionResponseWindow),
+	}
+	if notification.SignedDate.IsZero() {
+		record.Deadline = r.now().Add(ConsumptionResponseWindow)
+	}
+
+	err := r.respond(ctx, notification, &record)
+	record.Err = err
+	if r.audit != nil {
+		r.audit.RecordConsumptionResponse(ctx, record)
+	}
+	return err
+}
+
+func (r *ConsumptionResponder) respond(ctx context.Context, notification *ResponseBodyV2DecodedPayload, record *ConsumptionAuditRecord) error {
+	transaction, err := r.verifier.VerifyAndDecodeSignedTransaction(notification.Data.SignedTransactionInfo)
+	if err != nil {
+		record.Outcome = CONSUMPTION_OUTCOME_INVALID
+		return err
+	}
+	record.TransactionID = transaction.TransactionId
+
+	// The provider shares the response window with the sends
+	ctx, cancel := context.WithDeadline(ctx, record.Deadline)
+	defer cancel()
+
+	facts, err := r.provider.ConsumptionFacts(ctx, transaction, notification.Data.ConsumptionRequestReason)
+	if err != nil {
+		record.Outcome = contextOutcome(ctx)
+		return err
+	}
+	if !facts.CustomerConsented {
+		record.Outcome = CONSUMPTION_OUTCOME_NO_CONSENT
+		return nil
+	}
+
+	request := ConsumptionRequest{
+		CustomerConsented:     facts.CustomerConsented,
+		SampleContentProvided: facts.SampleContentProvided,
+		DeliveryStatus:        facts.DeliveryStatus,
+		ConsumptionPercentage: facts.ConsumptionPercentage,
+		RefundPreference:      facts.RefundPreference,
+	}
+	record.Request = &request
+	if err := request.Validate(); err != nil {
+		record.Outcome = CONSUMPTION_OUTCOME_INVALID
+		return err
+	}
+
+	backoff := r.initialBackoff
+	for {
+		record.Attempts++
+		err = r.sender.SendConsumptionInformation(transaction.TransactionId, request)
+		if err == nil {
+			record.Outcome = CONSUMPTION_OUTCOME_SUBMITTED
+			return nil
+		}
+		if !isRetryableSendError(err) {
+			record.Outcome = CONSUMPTION_OUTCOME_FAILED
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			record.Outcome = contextOutcome(ctx)
+			return fmt.Errorf("consumption information not sent after %d attempts: %w", record.Attempts, err)
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, r.maxBackoff)
+	}
+}
+
+// contextOutcome returns DEADLINE_EXCEEDED if the response window has closed, and FAILED otherwise.
+func contextOutcome(ctx context.Context) ConsumptionOutcome {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return CONSUMPTION_OUTCOME_DEADLINE_EXCEEDED
+	}
+	return CONSUMPTION_OUTCOME_FAILED
+}
+
+// isRetryableSendError returns true for network errors, rate limiting, and server-side errors.
+func isRetryableSendError(err error) bool {
+	var apiErr *APIException
+	if errors.As(err, &apiErr) {
+		if apiErr.APIError != nil {
+			switch *apiErr.APIError {
+			case API_ERROR_ACCOUNT_NOT_FOUND_RETRYABLE, API_ERROR_APP_NOT_FOUND_RETRYABLE, API_ERROR_ORIGINAL_TRANSACTION_ID_NOT_FOUND_RETRYABLE, API_ERROR_GENERAL_INTERNAL_RETRYABLE:
+				return true
+			}
+		}
+		return apiErr.HTTPStatusCode == 429 || apiErr.HTTPStatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,234 @@
+package appstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubConsumptionProvider struct {
+	facts    *ConsumptionFacts
+	err      error
+	deadline time.Time
+}
+
+func (p *stubConsumptionProvider) ConsumptionFacts(ctx context.Context, transaction *JWSTransactionDecodedPayload, reason *ConsumptionRequestReason) (*ConsumptionFacts, error) {
+	p.deadline, _ = ctx.Deadline()
+	if p.err != nil {
+		<-ctx.Done()
+	}
+	return p.facts, p.err
+}
+
+type stubTransactionVerifier struct {
+	transaction *JWSTransactionDecodedPayload
+}
+
+func (v stubTransactionVerifier) VerifyAndDecodeSignedTransaction(signedTransaction string) (*JWSTransactionDecodedPayload, error) {
+	return v.transaction, nil
+}
+
+type recordingConsumptionSender struct {
+	errs          []error
+	calls         int
+	transactionID string
+	request       ConsumptionRequest
+}
+
+func (s *recordingConsumptionSender) SendConsumptionInformation(transactionID string, consumptionRequest ConsumptionRequest) error {
+	s.calls++
+	s.transactionID = transactionID
+	s.request = consumptionRequest
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	if len(s.errs) > 1 {
+		s.errs = s.errs[1:]
+	}
+	return err
+}
+
+type recordingAuditSink struct {
+	records []ConsumptionAuditRecord
+}
+
+func (s *recordingAuditSink) RecordConsumptionResponse(ctx context.Context, record ConsumptionAuditRecord) {
+	s.records = append(s.records, record)
+}
+
+func createTestConsumptionNotification(t *testing.T, signedDate time.Time) *ResponseBodyV2DecodedPayload {
+	signedTransaction, err := createSignedDataFromJSON("models/signedTransaction.json")
+	assert.NoError(t, err, "Failed to create signed transaction")
+	reason := CONSUMPTION_REQUEST_REASON_UNINTENDED_PURCHASE
+	return &ResponseBodyV2DecodedPayload{
+		NotificationType: NOTIFICATION_TYPE_CONSUMPTION_REQUEST,
+		NotificationUUID: "002e14d5-51f5-4503-b5a8-c3a1af68eb20",
+		SignedDate:       Timestamp(signedDate.UnixMilli()),
+		Data: &Data{
+			SignedTransactionInfo:    signedTransaction,
+			ConsumptionRequestReason: &reason,
+		},
+	}
+}
+
+func createTestConsumptionResponder(t *testing.T, sender ConsumptionInformationSender, provider ConsumptionInfoProvider, audit ConsumptionAuditSink) *ConsumptionResponder {
+	verifier, err := createDefaultTestSignedDataVerifier()
+	assert.NoError(t, err, "Failed to create verifier")
+	responder, err := NewConsumptionResponder(sender, verifier, provider, audit)
+	assert.NoError(t, err, "Failed to create responder")
+	responder.initialBackoff = time.Millisecond
+	responder.maxBackoff = 5 * time.Millisecond
+	return responder
+}
+
+func TestConsumptionRequestValidate(t *testing.T) {
+	assert := assert.New(t)
+	valid := ConsumptionRequest{
+		CustomerConsented:     true,
+		DeliveryStatus:        DELIVERY_STATUS_DELIVERED_AND_WORKING_PROPERLY,
+		ConsumptionPercentage: 100000,
+		RefundPreference:      REFUND_PREFERENCE_PREFER_NO_REFUND,
+	}
+	assert.NoError(valid.Validate(), "Valid request")
+
+	invalid := ConsumptionRequest{
+		DeliveryStatus:        DeliveryStatus(9),
+		ConsumptionPercentage: 100001,
+		RefundPreference:      RefundPreference(-1),
+	}
+	err := invalid.Validate()
+	var validationErr *ValidationException
+	assert.True(errors.As(err, &validationErr), "Expected ValidationException")
+	assert.Equal(4, len(validationErr.Violations), "Violations")
+	assert.True(validationErr.HasAPIError(API_ERROR_INVALID_CUSTOMER_CONSENTED), "customerConsented")
+	assert.True(validationErr.HasAPIError(API_ERROR_INVALID_DELIVERY_STATUS), "deliveryStatus")
+
+	negative := valid
+	negative.ConsumptionPercentage = -1
+	assert.Error(negative.Validate(), "Negative percentage")
+}
+
+func TestConsumptionResponderSubmits(t *testing.T) {
+	assert := assert.New(t)
+	sender := &recordingConsumptionSender{errs: []error{
+		&APIException{HTTPStatusCode: 500},
+		&APIException{HTTPStatusCode: 429},
+		nil,
+	}}
+	audit := &recordingAuditSink{}
+	provider := &stubConsumptionProvider{facts: &ConsumptionFacts{
+		CustomerConsented:     true,
+		SampleContentProvided: true,
+		DeliveryStatus:        DELIVERY_STATUS_DELIVERED_AND_WORKING_PROPERLY,
+		ConsumptionPercentage: 50000,
+		RefundPreference:      REFUND_PREFERENCE_PREFER_NO_REFUND,
+	}}
+	responder := createTestConsumptionResponder(t, sender, provider, audit)
+
+	err := responder.Respond(context.Background(), createTestConsumptionNotification(t, time.Now()))
+	assert.NoError(err, "Respond failed")
+	assert.Equal(3, sender.calls, "Attempts")
+	assert.Equal("23456", sender.transactionID, "TransactionID")
+	assert.Equal(int32(50000), sender.request.ConsumptionPercentage, "ConsumptionPercentage")
+	assert.True(sender.request.SampleContentProvided, "SampleContentProvided")
+
+	assert.Equal(1, len(audit.records), "Audit records")
+	record := audit.records[0]
+	assert.Equal(CONSUMPTION_OUTCOME_SUBMITTED, record.Outcome, "Outcome")
+	assert.Equal(3, record.Attempts, "Attempts")
+	assert.Equal("23456", record.TransactionID, "TransactionID")
+	assert.Equal("002e14d5-51f5-4503-b5a8-c3a1af68eb20", record.NotificationUUID, "NotificationUUID")
+	assert.Equal(CONSUMPTION_REQUEST_REASON_UNINTENDED_PURCHASE, *record.Reason, "Reason")
+	assert.Nil(record.Err, "Err")
+}
+
+func TestConsumptionResponderNoConsent(t *testing.T) {
+	assert := assert.New(t)
+	sender := &recordingConsumptionSender{}
+	audit := &recordingAuditSink{}
+	provider := &stubConsumptionProvider{facts: &ConsumptionFacts{CustomerConsented: false}}
+	responder := createTestConsumptionResponder(t, sender, provider, audit)
+
+	err := responder.Respond(context.Background(), createTestConsumptionNotification(t, time.Now()))
+	assert.NoError(err, "Respond failed")
+	assert.Equal(0, sender.calls, "Nothing should be sent")
+	assert.Equal(CONSUMPTION_OUTCOME_NO_CONSENT, audit.records[0].Outcome, "Outcome")
+}
+
+func TestConsumptionResponderInvalidFacts(t *testing.T) {
+	assert := assert.New(t)
+	sender := &recordingConsumptionSender{}
+	audit := &recordingAuditSink{}
+	provider := &stubConsumptionProvider{facts: &ConsumptionFacts{
+		CustomerConsented:     true,
+		DeliveryStatus:        DELIVERY_STATUS_DELIVERED_AND_WORKING_PROPERLY,
+		ConsumptionPercentage: 150000,
+	}}
+	responder := createTestConsumptionResponder(t, sender, provider, audit)
+
+	err := responder.Respond(context.Background(), createTestConsumptionNotification(t, time.Now()))
+	var validationErr *ValidationException
+	assert.True(errors.As(err, &validationErr), "Expected ValidationException")
+	assert.Equal(0, sender.calls, "Nothing should be sent")
+	assert.Equal(CONSUMPTION_OUTCOME_INVALID, audit.records[0].Outcome, "Outcome")
+	assert.Equal(err, audit.records[0].Err, "Err")
+}
+
+func TestConsumptionResponderPermanentFailure(t *testing.T) {
+	assert := assert.New(t)
+	apiError := API_ERROR_INVALID_TRANSACTION_NOT_CONSUMABLE
+	sender := &recordingConsumptionSender{errs: []error{&APIException{HTTPStatusCode: 400, APIError: &apiError}}}
+	audit := &recordingAuditSink{}
+	provider := &stubConsumptionProvider{facts: &ConsumptionFacts{CustomerConsented: true}}
+	responder := createTestConsumptionResponder(t, sender, provider, audit)
+
+	err := responder.Respond(context.Background(), createTestConsumptionNotification(t, time.Now()))
+	assert.Error(err, "Expected error")
+	assert.Equal(1, sender.calls, "Permanent errors are not retried")
+	assert.Equal(CONSUMPTION_OUTCOME_FAILED, audit.records[0].Outcome, "Outcome")
+}
+
+func TestConsumptionResponderDeadlineExceeded(t *testing.T) {
+	assert := assert.New(t)
+	sender := &recordingConsumptionSender{errs: []error{&APIException{HTTPStatusCode: 503}}}
+	audit := &recordingAuditSink{}
+	provider := &stubConsumptionProvider{facts: &ConsumptionFacts{CustomerConsented: true}}
+	responder := createTestConsumptionResponder(t, sender, provider, audit)
+
+	signedDate := time.Now().Add(-ConsumptionResponseWindow).Add(20 * time.Millisecond)
+	err := responder.Respond(context.Background(), createTestConsumptionNotification(t, signedDate))
+	var apiErr *APIException
+	assert.True(errors.As(err, &apiErr), "Expected last APIException to be wrapped")
+	assert.Greater(sender.calls, 1, "Retryable errors are retried")
+	assert.Equal(CONSUMPTION_OUTCOME_DEADLINE_EXCEEDED, audit.records[0].Outcome, "Outcome")
+	assert.Equal(sender.calls, audit.records[0].Attempts, "Attempts")
+}
+
+func TestConsumptionResponderProviderSharesTheDeadline(t *testing.T) {
+	assert := assert.New(t)
+	sender := &recordingConsumptionSender{}
+	audit := &recordingAuditSink{}
+	provider := &stubConsumptionProvider{err: errors.New("database unavailable")}
+	responder, err := NewConsumptionResponder(sender, stubTransactionVerifier{&JWSTransactionDecodedPayload{TransactionId: "23456"}}, provider, audit)
+	assert.NoError(err, "Failed to create responder")
+
+	signedDate := time.Now().Add(-ConsumptionResponseWindow).Add(20 * time.Millisecond)
+	err = responder.Respond(context.Background(), createTestConsumptionNotification(t, signedDate))
+	assert.Error(err, "Expected provider error")
+	assert.Equal(audit.records[0].Deadline, provider.deadline, "The provider's context ends with the response window")
+	assert.Equal(0, sender.calls, "Nothing should be sent")
+	assert.Equal(CONSUMPTION_OUTCOME_DEADLINE_EXCEEDED, audit.records[0].Outcome, "Outcome")
+	assert.Equal("23456", audit.records[0].TransactionID, "TransactionID")
+}
+
+func TestConsumptionResponderWrongType(t *testing.T) {
+	assert := assert.New(t)
+	responder := createTestConsumptionResponder(t, &recordingConsumptionSender{}, &stubConsumptionProvider{}, nil)
+	notification := createTestConsumptionNotification(t, time.Now())
+	notification.NotificationType = NOTIFICATION_TYPE_REFUND
+	assert.Error(responder.Respond(context.Background(), notification), "Expected error")
+}
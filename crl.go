@@ -0,0 +1,212 @@
+package appstore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RevocationMode selects how certificate revocation is checked when online checks are enabled.
+type RevocationMode int
+
+const (
+	// REVOCATION_MODE_OCSP queries each certificate's OCSP responders. This is the default.
+	REVOCATION_MODE_OCSP RevocationMode = 0
+
+	// REVOCATION_MODE_CRL checks each certificate against its issuer's certificate revocation list,
+	// taken from a local CRL bundle or downloaded from the certificate's CRL distribution points.
+	REVOCATION_MODE_CRL RevocationMode = 1
+)
+
+// CRLFetcher downloads a certificate revocation list and returns it in DER or PEM form.
+// Implementations must be safe for concurrent use.
+type CRLFetcher interface {
+	FetchCRL(url string) ([]byte, error)
+}
+
+// HTTPCRLFetcher is a CRLFetcher that downloads revocation lists over HTTP.
+type HTTPCRLFetcher struct {
+	httpClient HTTPClient
+}
+
+// NewHTTPCRLFetcher creates a CRL fetcher that uses the given HTTP client.
+// If httpClient is nil, a client with a 30 second timeout is used.
+func NewHTTPCRLFetcher(httpClient HTTPClient) *HTTPCRLFetcher {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &HTTPCRLFetcher{httpClient: httpClient}
+}
+
+// FetchCRL downloads the revocation list at url.
+func (f *HTTPCRLFetcher) FetchCRL(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CRL server returned status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// parseCRL parses a DER or PEM encoded certificate revocation list.
+func parseCRL(data []byte) (*x509.RevocationList, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	return x509.ParseRevocationList(data)
+}
+
+// parseCRLBundle parses locally supplied revocation lists.
+func parseCRLBundle(bundle [][]byte) ([]*x509.RevocationList, error) {
+	crls := make([]*x509.RevocationList, 0, len(bundle))
+	for _, data := range bundle {
+		crl, err := parseCRL(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CRL in bundle: %w", err)
+		}
+		crls = append(crls, crl)
+	}
+	return crls, nil
+}
+
+// defaultCRLCacheTTL is how long a downloaded revocation list without a NextUpdate is cached.
+const defaultCRLCacheTTL = time.Hour
+
+type crlCacheEntry struct {
+	crl    *x509.RevocationList
+	expiry time.Time
+}
+
+// crlCache holds downloaded revocation lists by URL until their NextUpdate, or for defaultCRLCacheTTL
+// if they don't have one.
+type crlCache struct {
+	mutex   sync.Mutex
+	entries map[string]crlCacheEntry
+}
+
+func newCRLCache() *crlCache {
+	return &crlCache{entries: make(map[string]crlCacheEntry)}
+}
+
+func (c *crlCache) get(url string, now time.Time) (*x509.RevocationList, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[url]
+	if !ok || now.After(entry.expiry) {
+		delete(c.entries, url)
+		return nil, false
+	}
+	return entry.crl, true
+}
+
+func (c *crlCache) put(url string, crl *x509.RevocationList, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	expiry := crl.NextUpdate
+	if expiry.IsZero() {
+		expiry = now.Add(defaultCRLCacheTTL)
+	}
+	c.entries[url] = crlCacheEntry{crl: crl, expiry: expiry}
+}
+
+func crlExpired(crl *x509.RevocationList, now time.Time) bool {
+	return !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate)
+}
+
+// checkCRL confirms that a certificate doesn't appear on its issuer's revocation list.
+// A CRL from the local bundle takes precedence over the certificate's distribution points.
+func (cv *chainVerifier) checkCRL(cert, issuer *x509.Certificate, report *VerificationReport) error {
+	crl, err := cv.findCRL(cert, issuer, report)
+	if err != nil {
+		return err
+	}
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			err := errors.New("certificate is revoked")
+			if report != nil {
+				last := &report.RevocationChecks[len(report.RevocationChecks)-1]
+				last.Status = REVOCATION_STATUS_REVOKED
+				last.Err = err
+			}
+			return NewVerificationException(VERIFICATION_FAILURE, err)
+		}
+	}
+	return nil
+}
+
+// findCRL returns the revocation list for a certificate. Every list it tries is recorded in report,
+// with a Good status that checkCRL overwrites if the certificate turns out to be revoked.
+func (cv *chainVerifier) findCRL(cert, issuer *x509.Certificate, report *VerificationReport) (*x509.RevocationList, error) {
+	now := cv.now()
+	record := func(url string, status RevocationStatus, cached bool, start time.Time, err error) {
+		check := RevocationCheck{Subject: cert.Subject.String(), Mode: REVOCATION_MODE_CRL, URL: url, Status: status, Cached: cached, Err: err}
+		if !cached {
+			check.ResponseTime = time.Since(start)
+		}
+		report.addRevocationCheck(check)
+	}
+
+	for _, crl := range cv.crlBundle {
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) || crl.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+		if crlExpired(crl, now) {
+			err := errors.New("CRL in bundle has expired")
+			record("", REVOCATION_STATUS_INVALID_RESPONSE, true, now, err)
+			return nil, NewVerificationException(VERIFICATION_FAILURE, err)
+		}
+		record("", REVOCATION_STATUS_GOOD, true, now, nil)
+		return crl, nil
+	}
+
+	if len(cert.CRLDistributionPoints) == 0 {
+		return nil, NewVerificationException(VERIFICATION_FAILURE, errors.New("no CRL available for certificate"))
+	}
+
+	var lastErr error
+	for _, url := range cert.CRLDistributionPoints {
+		if crl, ok := cv.crlCache.get(url, now); ok && crl.CheckSignatureFrom(issuer) == nil {
+			record(url, REVOCATION_STATUS_GOOD, true, now, nil)
+			return crl, nil
+		}
+		start := time.Now()
+		data, err := cv.crlFetcher.FetchCRL(url)
+		if err != nil {
+			record(url, REVOCATION_STATUS_UNAVAILABLE, false, start, err)
+			lastErr = NewVerificationException(RETRYABLE_VERIFICATION_FAILURE, err)
+			continue
+		}
+		crl, err := parseCRL(data)
+		if err == nil {
+			if sigErr := crl.CheckSignatureFrom(issuer); sigErr != nil {
+				err = fmt.Errorf("invalid CRL signature: %w", sigErr)
+			} else if crlExpired(crl, now) {
+				err = errors.New("CRL has expired")
+			}
+		}
+		if err != nil {
+			record(url, REVOCATION_STATUS_INVALID_RESPONSE, false, start, err)
+			lastErr = NewVerificationException(VERIFICATION_FAILURE, err)
+			continue
+		}
+		record(url, REVOCATION_STATUS_GOOD, false, start, nil)
+		cv.crlCache.put(url, crl, now)
+		return crl, nil
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,172 @@
+package appstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testCRLFetcher serves CRLs by URL and counts downloads
+type testCRLFetcher struct {
+	crls     map[string][]byte
+	err      error
+	requests int
+}
+
+func (f *testCRLFetcher) FetchCRL(url string) ([]byte, error) {
+	f.requests++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.crls[url], nil
+}
+
+func createTestCRL(t *testing.T, issuer *x509.Certificate, key *ecdsa.PrivateKey, nextUpdate time.Time, revoked ...*big.Int) []byte {
+	t.Helper()
+	template := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: nextUpdate,
+	}
+	for _, serial := range revoked {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, template, issuer, key)
+	assert.NoError(t, err, "Failed to create CRL")
+	return crl
+}
+
+func createTestCRLChainVerifier(t *testing.T, pki *testPKI, fetcher CRLFetcher, bundle ...[]byte) *chainVerifier {
+	cv, err := newChainVerifier([][]byte{pki.root.Raw})
+	assert.NoError(t, err, "Failed to create chain verifier")
+	cv.revocationMode = REVOCATION_MODE_CRL
+	cv.crlFetcher = fetcher
+	cv.crlBundle, err = parseCRLBundle(bundle)
+	assert.NoError(t, err, "Failed to parse CRL bundle")
+	cv.ocspFetcher = &recordingOCSPFetcher{}
+	cv.cache = NewChainCache(0, 0)
+	return cv
+}
+
+func TestCRLFromDistributionPointsIsCachedUntilNextUpdate(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	nextUpdate := time.Now().Add(time.Hour)
+	fetcher := &testCRLFetcher{crls: map[string][]byte{
+		"http://crl.example.com/root.crl":         createTestCRL(t, pki.root, pki.rootKey, nextUpdate),
+		"http://crl.example.com/intermediate.crl": createTestCRL(t, pki.intermediate, pki.intermediateKey, nextUpdate, big.NewInt(99)),
+	}}
+	cv := createTestCRLChainVerifier(t, pki, fetcher)
+	now := time.Now()
+	cv.now = func() time.Time { return now }
+
+	_, err := cv.verifyChain(pki.chain(), true, now)
+	assert.NoError(err, "Expected valid chain")
+	assert.Equal(2, fetcher.requests, "One download per certificate")
+	assert.Empty(cv.ocspFetcher.(*recordingOCSPFetcher).servers, "OCSP is not used in CRL mode")
+
+	_, err = cv.verifyChain(pki.chain(), true, now)
+	assert.NoError(err, "Expected valid chain")
+	assert.Equal(2, fetcher.requests, "CRLs are cached")
+
+	now = nextUpdate.Add(time.Second)
+	fetcher.err = errors.New("connection refused")
+	_, err = cv.verifyChain(pki.chain(), true, now)
+	assertVerificationStatus(t, RETRYABLE_VERIFICATION_FAILURE, err)
+}
+
+func TestCRLWithoutNextUpdateIsCachedForTheDefaultTTL(t *testing.T) {
+	assert := assert.New(t)
+	cache := newCRLCache()
+	now := time.Now()
+	crl := &x509.RevocationList{Number: big.NewInt(1)}
+	cache.put("http://crl.example.com/root.crl", crl, now)
+
+	cached, ok := cache.get("http://crl.example.com/root.crl", now.Add(defaultCRLCacheTTL-time.Second))
+	assert.True(ok, "Cached within the TTL")
+	assert.Same(crl, cached, "CRL")
+	_, ok = cache.get("http://crl.example.com/root.crl", now.Add(defaultCRLCacheTTL+time.Second))
+	assert.False(ok, "Fetched again after the TTL")
+}
+
+func TestCRLRevokedLeaf(t *testing.T) {
+	pki := createTestPKI(t)
+	nextUpdate := time.Now().Add(time.Hour)
+	fetcher := &testCRLFetcher{crls: map[string][]byte{
+		"http://crl.example.com/root.crl":         createTestCRL(t, pki.root, pki.rootKey, nextUpdate),
+		"http://crl.example.com/intermediate.crl": createTestCRL(t, pki.intermediate, pki.intermediateKey, nextUpdate, pki.leaf.SerialNumber),
+	}}
+	cv := createTestCRLChainVerifier(t, pki, fetcher)
+
+	_, err := cv.verifyChain(pki.chain(), true, time.Now())
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+}
+
+func TestCRLRevokedIntermediateFromBundle(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	nextUpdate := time.Now().Add(time.Hour)
+	rootCRL := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: createTestCRL(t, pki.root, pki.rootKey, nextUpdate, pki.intermediate.SerialNumber)})
+	intermediateCRL := createTestCRL(t, pki.intermediate, pki.intermediateKey, nextUpdate)
+	fetcher := &testCRLFetcher{err: errors.New("egress blocked")}
+	cv := createTestCRLChainVerifier(t, pki, fetcher, rootCRL, intermediateCRL)
+
+	_, err := cv.verifyChain(pki.chain(), true, time.Now())
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+	assert.Equal(0, fetcher.requests, "Bundled CRLs are used without downloading")
+}
+
+func TestCRLWithInvalidSignature(t *testing.T) {
+	pki := createTestPKI(t)
+	other := createTestPKI(t)
+	nextUpdate := time.Now().Add(time.Hour)
+	fetcher := &testCRLFetcher{crls: map[string][]byte{
+		"http://crl.example.com/root.crl":         createTestCRL(t, other.root, other.rootKey, nextUpdate),
+		"http://crl.example.com/intermediate.crl": createTestCRL(t, pki.intermediate, pki.intermediateKey, nextUpdate),
+	}}
+	cv := createTestCRLChainVerifier(t, pki, fetcher)
+
+	_, err := cv.verifyChain(pki.chain(), true, time.Now())
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+}
+
+func TestCRLBundleExpired(t *testing.T) {
+	pki := createTestPKI(t)
+	expired := time.Now().Add(-time.Minute)
+	cv := createTestCRLChainVerifier(t, pki, &testCRLFetcher{},
+		createTestCRL(t, pki.root, pki.rootKey, expired),
+		createTestCRL(t, pki.intermediate, pki.intermediateKey, expired),
+	)
+
+	_, err := cv.verifyChain(pki.chain(), true, time.Now())
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+}
+
+func TestRevocationModeOption(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier, err := NewSignedDataVerifierWithOptions([][]byte{pki.root.Raw},
+		WithEnvironments(ENVIRONMENT_SANDBOX),
+		WithRevocationMode(REVOCATION_MODE_CRL),
+		WithCRLBundle(createTestCRL(t, pki.root, pki.rootKey, time.Now().Add(time.Hour))),
+	)
+	assert.NoError(err, "Failed to create verifier")
+	assert.Equal(REVOCATION_MODE_CRL, verifier.chainVerifier.revocationMode, "RevocationMode")
+	assert.Equal(1, len(verifier.chainVerifier.crlBundle), "CRL bundle")
+
+	_, err = NewSignedDataVerifierWithOptions([][]byte{pki.root.Raw},
+		WithEnvironments(ENVIRONMENT_SANDBOX),
+		WithCRLBundle([]byte("not a crl")),
+	)
+	assert.Error(err, "Expected error for invalid CRL bundle")
+}
@@ -1,8 +1,12 @@
 package appstore
 
 import (
-	"github.com/stretchr/testify/assert"
+	"encoding/base64"
+	"encoding/json"
 	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
 )
 
 // createDefaultTestSignedDataVerifier creates a verifier with default test settings
@@ -206,12 +210,11 @@ func TestVerifyAndDecodeSummaryNotification(t *testing.T) {
 
 func TestVerifyAndDecodeExternalPurchaseTokenNotification(t *testing.T) {
 	assert := assert.New(t)
-	verifier, err := createDefaultTestSignedDataVerifier()
-	assert.NoError(err, "Failed to create verifier")
-	verifier.allowAnyEnvironment = true
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki, WithAnyEnvironment(), WithAppAppleID(55555),
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED), WithEffectiveDatePolicy(EFFECTIVE_DATE_POLICY_CURRENT_TIME))
 
-	signedExternalPurchaseTokenNotification, err := createSignedDataFromJSON("models/signedExternalPurchaseTokenNotification.json")
-	assert.NoError(err, "Failed to create signed data")
+	signedExternalPurchaseTokenNotification := createTestSignedPayloadFromJSON(t, pki, "models/signedExternalPurchaseTokenNotification.json", nil)
 
 	notification, err := verifier.VerifyAndDecodeNotification(signedExternalPurchaseTokenNotification)
 	assert.NoError(err, "Failed to verify and decode notification")
@@ -235,12 +238,11 @@ func TestVerifyAndDecodeExternalPurchaseTokenNotification(t *testing.T) {
 
 func TestVerifyAndDecodeExternalPurchaseTokenSandboxNotification(t *testing.T) {
 	assert := assert.New(t)
-	verifier, err := createDefaultTestSignedDataVerifier()
-	assert.NoError(err, "Failed to create verifier")
-	verifier.allowAnyEnvironment = true
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki, WithAnyEnvironment(),
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED), WithEffectiveDatePolicy(EFFECTIVE_DATE_POLICY_CURRENT_TIME))
 
-	signedExternalPurchaseTokenNotification, err := createSignedDataFromJSON("models/signedExternalPurchaseTokenSandboxNotification.json")
-	assert.NoError(err, "Failed to create signed data")
+	signedExternalPurchaseTokenNotification := createTestSignedPayloadFromJSON(t, pki, "models/signedExternalPurchaseTokenSandboxNotification.json", nil)
 
 	notification, err := verifier.VerifyAndDecodeNotification(signedExternalPurchaseTokenNotification)
 	assert.NoError(err, "Failed to verify and decode notification")
@@ -315,3 +317,76 @@ func TestVerifyAndDecodeRealtimeRequest(t *testing.T) {
 	assert.Equal(ENVIRONMENT_LOCAL_TESTING, request.Environment, "Environment")
 	assert.Equal(Timestamp(1698148900000), request.SignedDate, "SignedDate")
 }
+
+// Test that large integers survive decoding without a round trip through float64
+func TestVerifyAndDecodePreservesLargeIntegers(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createDefaultTestSignedDataVerifier()
+	assert.NoError(err, "Failed to create verifier")
+
+	const large = int64(1<<53 + 1)
+	signedTransaction, err := createSignedDataFromJSONWithOverrides("models/signedTransaction.json", map[string]any{"price": large})
+	assert.NoError(err, "Failed to create signed data")
+	transaction, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	assert.NoError(err, "Failed to verify and decode transaction")
+	assert.Equal(large, transaction.Price, "Price")
+
+	signedAppTransaction, err := createSignedDataFromJSONWithOverrides("models/appTransaction.json", map[string]any{"appAppleId": large})
+	assert.NoError(err, "Failed to create signed data")
+	appTransaction, err := verifier.VerifyAndDecodeAppTransaction(signedAppTransaction)
+	assert.NoError(err, "Failed to verify and decode app transaction")
+	assert.Equal(large, *appTransaction.AppAppleId, "AppAppleId")
+}
+
+// Test that malformed signed data is rejected
+func TestVerifyAndDecodeMalformedSignedData(t *testing.T) {
+	verifier, err := createDefaultTestSignedDataVerifier()
+	assert.NoError(t, err, "Failed to create verifier")
+
+	for _, signedObj := range []string{"", "a.b", "a.b.c.d", "a.!!!.c", "a." + base64.RawURLEncoding.EncodeToString([]byte("not json")) + ".c"} {
+		_, err = verifier.VerifyAndDecodeSignedTransaction(signedObj)
+		assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+	}
+}
+
+// decodeViaMapClaims is the previous decoding approach, kept as a baseline for the benchmarks
+func decodeViaMapClaims(signedObj string, destination any) error {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(signedObj, &claims); err != nil {
+		return err
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, destination)
+}
+
+// BenchmarkDecodeNotification measures the verified path: a cached chain, the signature and decoding
+func BenchmarkDecodeNotification(b *testing.B) {
+	pki := createTestPKI(b)
+	verifier := createTestReportVerifier(b, pki, WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED),
+		WithEffectiveDatePolicy(EFFECTIVE_DATE_POLICY_CURRENT_TIME))
+	signedNotification := createTestSignedPayloadFromJSON(b, pki, "models/signedNotification.json", map[string]any{
+		"data": map[string]any{"environment": "Sandbox", "bundleId": "com.example"},
+	})
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := verifier.VerifyAndDecodeNotification(signedNotification); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeNotificationViaMapClaims(b *testing.B) {
+	signedNotification, err := createSignedDataFromJSON("models/signedNotification.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := decodeViaMapClaims(signedNotification, &ResponseBodyV2DecodedPayload{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
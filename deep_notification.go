@@ -0,0 +1,152 @@
+package appstore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DecodedNotification is a notification whose nested signed objects have been verified and decoded along with it.
+type DecodedNotification struct {
+	// The decoded notification. Its nested signed objects are kept in their signed form.
+	Notification *ResponseBodyV2DecodedPayload
+
+	// The decoded Data.SignedTransactionInfo, or nil if the notification has none.
+	Transaction *JWSTransactionDecodedPayload
+
+	// The decoded Data.SignedRenewalInfo, or nil if the notification has none.
+	RenewalInfo *JWSRenewalInfoDecodedPayload
+
+	// The decoded AppData.SignedAppTransactionInfo, or nil if the notification has none.
+	AppTransaction *AppTransaction
+}
+
+// VerifyAndDecodeNotificationDeep verifies and decodes an App Store Server Notification signedPayload like
+// VerifyAndDecodeNotification, and verifies and decodes its signed transaction, renewal info and app transaction
+// in the same pass, with the same checks as their own VerifyAndDecode methods.
+//
+// The nested objects must agree with the notification and with each other on the bundle ID, environment,
+// original transaction ID and app transaction ID, otherwise verification fails with INCONSISTENT_PAYLOAD.
+// Freshness and replay are checked last, so a notification that fails is not recorded as seen.
+func (v *SignedDataVerifier) VerifyAndDecodeNotificationDeep(signedPayload string) (*DecodedNotification, error) {
+	payload := &ResponseBodyV2DecodedPayload{}
+	if _, err := v.decodeSignedObject(signedPayload, payload, nil); err != nil {
+		return nil, err
+	}
+	if err := v.checkIdentity(notificationIdentity(payload), nil); err != nil {
+		return nil, err
+	}
+
+	decoded, err := v.decodeNestedObjects(payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.checkFreshnessAndReplay(payload); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// decodeNestedObjects verifies and decodes the signed objects nested in a verified notification, and checks that
+// they are consistent with it.
+func (v *SignedDataVerifier) decodeNestedObjects(payload *ResponseBodyV2DecodedPayload) (*DecodedNotification, error) {
+	decoded := &DecodedNotification{Notification: payload}
+	if data := payload.Data; data != nil {
+		if data.SignedTransactionInfo != "" {
+			decoded.Transaction = &JWSTransactionDecodedPayload{}
+			if err := v.verifyNested("signedTransactionInfo", data.SignedTransactionInfo, decoded.Transaction); err != nil {
+				return nil, err
+			}
+		}
+		if data.SignedRenewalInfo != "" {
+			decoded.RenewalInfo = &JWSRenewalInfoDecodedPayload{}
+			if err := v.verifyNested("signedRenewalInfo", data.SignedRenewalInfo, decoded.RenewalInfo); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if appData := payload.AppData; appData != nil && appData.SignedAppTransactionInfo != "" {
+		decoded.AppTransaction = &AppTransaction{}
+		if err := v.verifyNested("signedAppTransactionInfo", appData.SignedAppTransactionInfo, decoded.AppTransaction); err != nil {
+			return nil, err
+		}
+	}
+	if err := decoded.checkConsistency(); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// verifyNested verifies and decodes a signed object nested in a notification, naming its field in any error.
+func (v *SignedDataVerifier) verifyNested(field, signedObj string, destination any) error {
+	if _, err := v.decodeSignedObject(signedObj, destination, nil); err != nil {
+		return nestedError(field, err)
+	}
+	if err := v.verifyDecoded(destination, nil); err != nil {
+		return nestedError(field, err)
+	}
+	return nil
+}
+
+func nestedError(field string, err error) error {
+	var vErr *VerificationException
+	if errors.As(err, &vErr) {
+		return NewVerificationException(vErr.Status, fmt.Errorf("%s: %w", field, vErr.Err))
+	}
+	return fmt.Errorf("%s: %w", field, err)
+}
+
+// checkConsistency checks that the nested objects belong to the notification's app, environment and subscription.
+func (d *DecodedNotification) checkConsistency() error {
+	if data := d.Notification.Data; data != nil {
+		if t := d.Transaction; t != nil {
+			if err := agree("bundleId", "data", data.BundleId, "signedTransactionInfo", t.BundleId); err != nil {
+				return err
+			}
+			if err := agree("environment", "data", string(data.Environment), "signedTransactionInfo", string(t.Environment)); err != nil {
+				return err
+			}
+		}
+		if r := d.RenewalInfo; r != nil {
+			if err := agree("environment", "data", string(data.Environment), "signedRenewalInfo", string(r.Environment)); err != nil {
+				return err
+			}
+		}
+	}
+	if t, r := d.Transaction, d.RenewalInfo; t != nil && r != nil {
+		if err := agree("originalTransactionId", "signedTransactionInfo", t.OriginalTransactionId, "signedRenewalInfo", r.OriginalTransactionId); err != nil {
+			return err
+		}
+		if err := agreeIfPresent("appTransactionId", "signedTransactionInfo", t.AppTransactionId, "signedRenewalInfo", r.AppTransactionId); err != nil {
+			return err
+		}
+	}
+
+	if appData, a := d.Notification.AppData, d.AppTransaction; appData != nil && a != nil {
+		if err := agree("bundleId", "appData", appData.BundleId, "signedAppTransactionInfo", a.BundleId); err != nil {
+			return err
+		}
+		if err := agree("environment", "appData", string(appData.Environment), "signedAppTransactionInfo", string(a.ReceiptType)); err != nil {
+			return err
+		}
+		if a.AppAppleId != nil && appData.AppAppleId != 0 && *a.AppAppleId != appData.AppAppleId {
+			return NewVerificationException(INCONSISTENT_PAYLOAD, fmt.Errorf("appAppleId of appData (%d) and signedAppTransactionInfo (%d) differ", appData.AppAppleId, *a.AppAppleId))
+		}
+	}
+	return nil
+}
+
+// agree fails with INCONSISTENT_PAYLOAD when two objects have different values for a field.
+func agree(field, firstName, first, secondName, second string) error {
+	if first != second {
+		return NewVerificationException(INCONSISTENT_PAYLOAD, fmt.Errorf("%s of %s (%q) and %s (%q) differ", field, firstName, first, secondName, second))
+	}
+	return nil
+}
+
+// agreeIfPresent is like agree, but accepts the values when either object doesn't have the field.
+func agreeIfPresent(field, firstName, first, secondName, second string) error {
+	if first == "" || second == "" {
+		return nil
+	}
+	return agree(field, firstName, first, secondName, second)
+}
@@ -0,0 +1,129 @@
+package appstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestDeepNotification(t *testing.T, pki *testPKI, transaction, renewalInfo jwt.MapClaims) string {
+	t.Helper()
+	data := map[string]any{"environment": "Sandbox", "bundleId": "com.example"}
+	if transaction != nil {
+		data["signedTransactionInfo"] = createTestSignedPayload(t, pki, transaction)
+	}
+	if renewalInfo != nil {
+		data["signedRenewalInfo"] = createTestSignedPayload(t, pki, renewalInfo)
+	}
+	return createTestSignedPayload(t, pki, jwt.MapClaims{
+		"notificationType": "DID_RENEW",
+		"notificationUUID": "002e14d5-51f5-4503-b5a8-c3a1af68eb20",
+		"data":             data,
+	})
+}
+
+func TestVerifyAndDecodeNotificationDeep(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki, WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED))
+
+	signed := createTestDeepNotification(t, pki,
+		jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox", "originalTransactionId": "12345", "transactionId": "23456"},
+		jwt.MapClaims{"environment": "Sandbox", "originalTransactionId": "12345", "autoRenewProductId": "com.example.monthly"},
+	)
+	decoded, err := verifier.VerifyAndDecodeNotificationDeep(signed)
+	assert.NoError(err, "Expected valid notification")
+	assert.Equal(NOTIFICATION_TYPE_DID_RENEW, decoded.Notification.NotificationType, "NotificationType")
+	if assert.NotNil(decoded.Transaction, "Transaction") {
+		assert.Equal("23456", decoded.Transaction.TransactionId, "TransactionId")
+	}
+	if assert.NotNil(decoded.RenewalInfo, "RenewalInfo") {
+		assert.Equal("com.example.monthly", decoded.RenewalInfo.AutoRenewProductId, "AutoRenewProductId")
+	}
+	assert.Nil(decoded.AppTransaction, "AppTransaction")
+
+	decoded, err = verifier.VerifyAndDecodeNotificationDeep(createTestDeepNotification(t, pki, nil, nil))
+	assert.NoError(err, "Expected valid notification without nested objects")
+	assert.Nil(decoded.Transaction, "Transaction")
+	assert.Nil(decoded.RenewalInfo, "RenewalInfo")
+}
+
+func TestVerifyAndDecodeNotificationDeep_Inconsistent(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki,
+		WithEnvironments(ENVIRONMENT_SANDBOX, ENVIRONMENT_PRODUCTION),
+		WithAppAppleID(1234),
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED),
+	)
+
+	_, err := verifier.VerifyAndDecodeNotificationDeep(createTestDeepNotification(t, pki,
+		jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox", "originalTransactionId": "12345"},
+		jwt.MapClaims{"environment": "Sandbox", "originalTransactionId": "99999"},
+	))
+	assertVerificationStatus(t, INCONSISTENT_PAYLOAD, err)
+	assert.Contains(err.Error(), "originalTransactionId", "Error names the field")
+	assert.Equal("INCONSISTENT_PAYLOAD", INCONSISTENT_PAYLOAD.String(), "String")
+
+	_, err = verifier.VerifyAndDecodeNotificationDeep(createTestDeepNotification(t, pki,
+		jwt.MapClaims{"bundleId": "com.example", "environment": "Production", "originalTransactionId": "12345"},
+		nil,
+	))
+	assertVerificationStatus(t, INCONSISTENT_PAYLOAD, err)
+
+	_, err = verifier.VerifyAndDecodeNotificationDeep(createTestDeepNotification(t, pki,
+		jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox", "originalTransactionId": "12345", "appTransactionId": "1"},
+		jwt.MapClaims{"environment": "Sandbox", "originalTransactionId": "12345", "appTransactionId": "2"},
+	))
+	assertVerificationStatus(t, INCONSISTENT_PAYLOAD, err)
+
+	signed := createTestSignedPayload(t, pki, jwt.MapClaims{
+		"notificationType": "RESCIND_CONSENT",
+		"appData": map[string]any{
+			"appAppleId":  1234,
+			"bundleId":    "com.example",
+			"environment": "Sandbox",
+			"signedAppTransactionInfo": createTestSignedPayload(t, pki, jwt.MapClaims{
+				"bundleId": "com.example", "receiptType": "Production", "appAppleId": 1234,
+			}),
+		},
+	})
+	_, err = verifier.VerifyAndDecodeNotificationDeep(signed)
+	assertVerificationStatus(t, INCONSISTENT_PAYLOAD, err)
+}
+
+func TestVerifyAndDecodeNotificationDeep_NestedFailures(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	replayStore := NewMemoryReplayStore(time.Hour)
+	verifier := createTestReportVerifier(t, pki, WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED), WithReplayStore(replayStore))
+
+	other := createTestPKI(t)
+	forged := createTestSignedPayload(t, pki, jwt.MapClaims{
+		"notificationType": "DID_RENEW",
+		"notificationUUID": "002e14d5-51f5-4503-b5a8-c3a1af68eb20",
+		"data": map[string]any{
+			"environment":           "Sandbox",
+			"bundleId":              "com.example",
+			"signedTransactionInfo": createTestSignedPayload(t, other, jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox"}),
+		},
+	})
+	_, err := verifier.VerifyAndDecodeNotificationDeep(forged)
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+	assert.Contains(err.Error(), "signedTransactionInfo", "Error names the nested object")
+	assert.Equal(0, replayStore.Len(), "A failed notification isn't recorded as seen")
+
+	_, err = verifier.VerifyAndDecodeNotificationDeep(createTestDeepNotification(t, pki,
+		jwt.MapClaims{"bundleId": "com.other", "environment": "Sandbox"},
+		nil,
+	))
+	assertVerificationStatus(t, INVALID_APP_IDENTIFIER, err)
+
+	signed := createTestDeepNotification(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox"}, nil)
+	_, err = verifier.VerifyAndDecodeNotificationDeep(signed)
+	assert.NoError(err, "Expected valid notification")
+	_, err = verifier.VerifyAndDecodeNotificationDeep(signed)
+	assertVerificationStatus(t, REPLAYED_PAYLOAD, err)
+}
@@ -0,0 +1,88 @@
+package appstore
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// DeviceVerificationFailure is the reason an AppTransaction couldn't be bound to a device.
+type DeviceVerificationFailure int
+
+const (
+	// DEVICE_VERIFICATION_MISSING means the AppTransaction has no device verification value or nonce.
+	DEVICE_VERIFICATION_MISSING DeviceVerificationFailure = 1
+
+	// DEVICE_VERIFICATION_NONCE_MISMATCH means the AppTransaction was created for another nonce,
+	// so it may have been replayed from an earlier request.
+	DEVICE_VERIFICATION_NONCE_MISMATCH DeviceVerificationFailure = 2
+
+	// DEVICE_VERIFICATION_DEVICE_MISMATCH means the AppTransaction was created on another device.
+	DEVICE_VERIFICATION_DEVICE_MISMATCH DeviceVerificationFailure = 3
+)
+
+func (f DeviceVerificationFailure) String() string {
+	switch f {
+	case DEVICE_VERIFICATION_MISSING:
+		return "DEVICE_VERIFICATION_MISSING"
+	case DEVICE_VERIFICATION_NONCE_MISMATCH:
+		return "DEVICE_VERIFICATION_NONCE_MISMATCH"
+	case DEVICE_VERIFICATION_DEVICE_MISMATCH:
+		return "DEVICE_VERIFICATION_DEVICE_MISMATCH"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", f)
+	}
+}
+
+// DeviceVerificationException is an error that indicates an AppTransaction doesn't belong to the expected device and nonce.
+type DeviceVerificationException struct {
+	Reason DeviceVerificationFailure
+	Err    error
+}
+
+func (e *DeviceVerificationException) Error() string {
+	return fmt.Sprintf("Device verification failed with reason %s: %v", e.Reason, e.Err)
+}
+
+// VerifyAppTransactionDevice checks that a verified AppTransaction was created on the device with the given
+// identifierForVendor, in response to expectedNonce. Both are UUID strings, in any case.
+//
+// The SHA-384 hash of the lower-case nonce followed by the lower-case device identifier must equal the
+// AppTransaction's deviceVerification value. It returns a *DeviceVerificationException if it doesn't.
+//
+// See https://developer.apple.com/documentation/storekit/apptransaction/deviceverification
+func VerifyAppTransactionDevice(appTransaction *AppTransaction, identifierForVendor string, expectedNonce string) error {
+	if appTransaction == nil || appTransaction.DeviceVerification == "" || appTransaction.DeviceVerificationNonce == "" {
+		return &DeviceVerificationException{Reason: DEVICE_VERIFICATION_MISSING, Err: errors.New("app transaction has no device verification")}
+	}
+
+	nonce, err := uuid.Parse(appTransaction.DeviceVerificationNonce)
+	if err != nil {
+		return &DeviceVerificationException{Reason: DEVICE_VERIFICATION_NONCE_MISMATCH, Err: fmt.Errorf("invalid deviceVerificationNonce: %w", err)}
+	}
+	expected, err := uuid.Parse(expectedNonce)
+	if err != nil {
+		return &DeviceVerificationException{Reason: DEVICE_VERIFICATION_NONCE_MISMATCH, Err: fmt.Errorf("invalid expected nonce: %w", err)}
+	}
+	if subtle.ConstantTimeCompare(nonce[:], expected[:]) != 1 {
+		return &DeviceVerificationException{Reason: DEVICE_VERIFICATION_NONCE_MISMATCH, Err: errors.New("deviceVerificationNonce differs from the expected nonce")}
+	}
+
+	deviceID, err := uuid.Parse(identifierForVendor)
+	if err != nil {
+		return &DeviceVerificationException{Reason: DEVICE_VERIFICATION_DEVICE_MISMATCH, Err: fmt.Errorf("invalid identifierForVendor: %w", err)}
+	}
+	deviceVerification, err := base64.StdEncoding.DecodeString(appTransaction.DeviceVerification)
+	if err != nil {
+		return &DeviceVerificationException{Reason: DEVICE_VERIFICATION_DEVICE_MISMATCH, Err: fmt.Errorf("invalid deviceVerification: %w", err)}
+	}
+	hash := sha512.Sum384([]byte(nonce.String() + deviceID.String()))
+	if subtle.ConstantTimeCompare(hash[:], deviceVerification) != 1 {
+		return &DeviceVerificationException{Reason: DEVICE_VERIFICATION_DEVICE_MISMATCH, Err: errors.New("deviceVerification doesn't match the device")}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package appstore
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testDeviceVerificationNonce = "48c8b92d-ce0d-4229-bedf-e61b4f9cfc92"
+	testIdentifierForVendor     = "7f2a9c3e-1b4d-4e8f-a6c5-0d9e8b7a6f51"
+)
+
+func createTestDeviceAppTransaction(nonce, deviceID string) *AppTransaction {
+	hash := sha512.Sum384([]byte(nonce + deviceID))
+	return &AppTransaction{
+		DeviceVerification:      base64.StdEncoding.EncodeToString(hash[:]),
+		DeviceVerificationNonce: nonce,
+	}
+}
+
+func assertDeviceVerificationFailure(t *testing.T, expected DeviceVerificationFailure, err error) {
+	t.Helper()
+	var dErr *DeviceVerificationException
+	if assert.True(t, errors.As(err, &dErr), "Expected DeviceVerificationException, got %v", err) {
+		assert.Equal(t, expected, dErr.Reason, "Device verification failure")
+	}
+}
+
+func TestVerifyAppTransactionDevice(t *testing.T) {
+	assert := assert.New(t)
+	appTransaction := createTestDeviceAppTransaction(testDeviceVerificationNonce, testIdentifierForVendor)
+
+	assert.NoError(VerifyAppTransactionDevice(appTransaction, testIdentifierForVendor, testDeviceVerificationNonce), "Expected matching device")
+	assert.NoError(VerifyAppTransactionDevice(appTransaction, "7F2A9C3E-1B4D-4E8F-A6C5-0D9E8B7A6F51", "48C8B92D-CE0D-4229-BEDF-E61B4F9CFC92"),
+		"UUIDs are compared in lower case, as Apple hashes them")
+
+	err := VerifyAppTransactionDevice(appTransaction, "00000000-0000-0000-0000-000000000000", testDeviceVerificationNonce)
+	assertDeviceVerificationFailure(t, DEVICE_VERIFICATION_DEVICE_MISMATCH, err)
+	err = VerifyAppTransactionDevice(appTransaction, "not a uuid", testDeviceVerificationNonce)
+	assertDeviceVerificationFailure(t, DEVICE_VERIFICATION_DEVICE_MISMATCH, err)
+
+	err = VerifyAppTransactionDevice(appTransaction, testIdentifierForVendor, "00000000-0000-0000-0000-000000000000")
+	assertDeviceVerificationFailure(t, DEVICE_VERIFICATION_NONCE_MISMATCH, err)
+	err = VerifyAppTransactionDevice(appTransaction, testIdentifierForVendor, "")
+	assertDeviceVerificationFailure(t, DEVICE_VERIFICATION_NONCE_MISMATCH, err)
+
+	err = VerifyAppTransactionDevice(&AppTransaction{DeviceVerificationNonce: testDeviceVerificationNonce}, testIdentifierForVendor, testDeviceVerificationNonce)
+	assertDeviceVerificationFailure(t, DEVICE_VERIFICATION_MISSING, err)
+	err = VerifyAppTransactionDevice(nil, testIdentifierForVendor, testDeviceVerificationNonce)
+	assertDeviceVerificationFailure(t, DEVICE_VERIFICATION_MISSING, err)
+	assert.Equal("DEVICE_VERIFICATION_MISSING", DEVICE_VERIFICATION_MISSING.String(), "String")
+}
+
+func TestVerifyXcodeAppTransactionDevice(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createXcodeTestSignedDataVerifier()
+	assert.NoError(err, "Failed to create verifier")
+	encodedAppTransaction, err := readTestDataString("xcode/xcode-signed-app-transaction")
+	assert.NoError(err, "Failed to read test data")
+	appTransaction, err := verifier.VerifyAndDecodeAppTransaction(encodedAppTransaction)
+	assert.NoError(err, "Failed to verify and decode app transaction")
+
+	// The test data doesn't record the device it was created on
+	err = VerifyAppTransactionDevice(appTransaction, testIdentifierForVendor, testDeviceVerificationNonce)
+	assertDeviceVerificationFailure(t, DEVICE_VERIFICATION_DEVICE_MISMATCH, err)
+}
@@ -760,3 +760,89 @@ func (a APIError) IsValid() bool {
 		return false
 	}
 }
+
+// VerifyReceiptStatus is the status code the legacy verifyReceipt endpoint returns.
+//
+// https://developer.apple.com/documentation/appstorereceipts/status
+type VerifyReceiptStatus int32
+
+const (
+	VERIFY_RECEIPT_STATUS_OK                            VerifyReceiptStatus = 0
+	VERIFY_RECEIPT_STATUS_INVALID_REQUEST               VerifyReceiptStatus = 21000
+	VERIFY_RECEIPT_STATUS_MALFORMED_RECEIPT             VerifyReceiptStatus = 21002
+	VERIFY_RECEIPT_STATUS_NOT_AUTHENTICATED             VerifyReceiptStatus = 21003
+	VERIFY_RECEIPT_STATUS_SHARED_SECRET_MISMATCH        VerifyReceiptStatus = 21004
+	VERIFY_RECEIPT_STATUS_SERVER_UNAVAILABLE            VerifyReceiptStatus = 21005
+	VERIFY_RECEIPT_STATUS_SUBSCRIPTION_EXPIRED          VerifyReceiptStatus = 21006
+	VERIFY_RECEIPT_STATUS_SANDBOX_RECEIPT_IN_PRODUCTION VerifyReceiptStatus = 21007
+	VERIFY_RECEIPT_STATUS_PRODUCTION_RECEIPT_IN_SANDBOX VerifyReceiptStatus = 21008
+	VERIFY_RECEIPT_STATUS_INTERNAL_DATA_ACCESS_ERROR    VerifyReceiptStatus = 21009
+	VERIFY_RECEIPT_STATUS_RECEIPT_NOT_AUTHORIZED        VerifyReceiptStatus = 21010
+)
+
+// Status codes 21100-21199 are various internal data access errors.
+const (
+	verifyReceiptInternalErrorMin VerifyReceiptStatus = 21100
+	verifyReceiptInternalErrorMax VerifyReceiptStatus = 21199
+)
+
+// Raw returns the underlying int32 value of the VerifyReceiptStatus.
+func (v VerifyReceiptStatus) Raw() int32 {
+	return int32(v)
+}
+
+// IsValid returns true if the VerifyReceiptStatus is a known value.
+func (v VerifyReceiptStatus) IsValid() bool {
+	switch v {
+	case VERIFY_RECEIPT_STATUS_OK, VERIFY_RECEIPT_STATUS_INVALID_REQUEST, VERIFY_RECEIPT_STATUS_MALFORMED_RECEIPT, VERIFY_RECEIPT_STATUS_NOT_AUTHENTICATED, VERIFY_RECEIPT_STATUS_SHARED_SECRET_MISMATCH, VERIFY_RECEIPT_STATUS_SERVER_UNAVAILABLE, VERIFY_RECEIPT_STATUS_SUBSCRIPTION_EXPIRED, VERIFY_RECEIPT_STATUS_SANDBOX_RECEIPT_IN_PRODUCTION, VERIFY_RECEIPT_STATUS_PRODUCTION_RECEIPT_IN_SANDBOX, VERIFY_RECEIPT_STATUS_INTERNAL_DATA_ACCESS_ERROR, VERIFY_RECEIPT_STATUS_RECEIPT_NOT_AUTHORIZED:
+		return true
+	default:
+		return v >= verifyReceiptInternalErrorMin && v <= verifyReceiptInternalErrorMax
+	}
+}
+
+// IsRetryable returns true if the status indicates a temporary server-side issue and the request can be retried.
+func (v VerifyReceiptStatus) IsRetryable() bool {
+	switch v {
+	case VERIFY_RECEIPT_STATUS_SERVER_UNAVAILABLE, VERIFY_RECEIPT_STATUS_INTERNAL_DATA_ACCESS_ERROR:
+		return true
+	default:
+		return v >= verifyReceiptInternalErrorMin && v <= verifyReceiptInternalErrorMax
+	}
+}
+
+// NotificationTypeV1 is the type that describes the in-app purchase event for which the App Store sends the version 1 notification.
+//
+// https://developer.apple.com/documentation/appstoreservernotifications/notification_type_v1
+type NotificationTypeV1 string
+
+const (
+	NOTIFICATION_TYPE_V1_CANCEL                    NotificationTypeV1 = "CANCEL"
+	NOTIFICATION_TYPE_V1_CONSUMPTION_REQUEST       NotificationTypeV1 = "CONSUMPTION_REQUEST"
+	NOTIFICATION_TYPE_V1_DID_CHANGE_RENEWAL_PREF   NotificationTypeV1 = "DID_CHANGE_RENEWAL_PREF"
+	NOTIFICATION_TYPE_V1_DID_CHANGE_RENEWAL_STATUS NotificationTypeV1 = "DID_CHANGE_RENEWAL_STATUS"
+	NOTIFICATION_TYPE_V1_DID_FAIL_TO_RENEW         NotificationTypeV1 = "DID_FAIL_TO_RENEW"
+	NOTIFICATION_TYPE_V1_DID_RECOVER               NotificationTypeV1 = "DID_RECOVER"
+	NOTIFICATION_TYPE_V1_DID_RENEW                 NotificationTypeV1 = "DID_RENEW"
+	NOTIFICATION_TYPE_V1_INITIAL_BUY               NotificationTypeV1 = "INITIAL_BUY"
+	NOTIFICATION_TYPE_V1_INTERACTIVE_RENEWAL       NotificationTypeV1 = "INTERACTIVE_RENEWAL"
+	NOTIFICATION_TYPE_V1_PRICE_INCREASE_CONSENT    NotificationTypeV1 = "PRICE_INCREASE_CONSENT"
+	NOTIFICATION_TYPE_V1_REFUND                    NotificationTypeV1 = "REFUND"
+	NOTIFICATION_TYPE_V1_RENEWAL                   NotificationTypeV1 = "RENEWAL"
+	NOTIFICATION_TYPE_V1_REVOKE                    NotificationTypeV1 = "REVOKE"
+)
+
+// Raw returns the underlying string value of the NotificationTypeV1.
+func (n NotificationTypeV1) Raw() string {
+	return string(n)
+}
+
+// IsValid returns true if the NotificationTypeV1 is a known value.
+func (n NotificationTypeV1) IsValid() bool {
+	switch n {
+	case NOTIFICATION_TYPE_V1_CANCEL, NOTIFICATION_TYPE_V1_CONSUMPTION_REQUEST, NOTIFICATION_TYPE_V1_DID_CHANGE_RENEWAL_PREF, NOTIFICATION_TYPE_V1_DID_CHANGE_RENEWAL_STATUS, NOTIFICATION_TYPE_V1_DID_FAIL_TO_RENEW, NOTIFICATION_TYPE_V1_DID_RECOVER, NOTIFICATION_TYPE_V1_DID_RENEW, NOTIFICATION_TYPE_V1_INITIAL_BUY, NOTIFICATION_TYPE_V1_INTERACTIVE_RENEWAL, NOTIFICATION_TYPE_V1_PRICE_INCREASE_CONSENT, NOTIFICATION_TYPE_V1_REFUND, NOTIFICATION_TYPE_V1_RENEWAL, NOTIFICATION_TYPE_V1_REVOKE:
+		return true
+	default:
+		return false
+	}
+}
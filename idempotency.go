@@ -0,0 +1,434 @@
+package appstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ClaimStatus is the outcome of claiming a notification for processing.
+type ClaimStatus int
+
+const (
+	// CLAIM_STATUS_CLAIMED means the caller now holds the claim and must complete or release it.
+	CLAIM_STATUS_CLAIMED ClaimStatus = 1
+
+	// CLAIM_STATUS_IN_PROGRESS means another caller holds an unexpired claim.
+	CLAIM_STATUS_IN_PROGRESS ClaimStatus = 2
+
+	// CLAIM_STATUS_COMPLETED means the notification has already been processed successfully.
+	CLAIM_STATUS_COMPLETED ClaimStatus = 3
+)
+
+func (s ClaimStatus) String() string {
+	switch s {
+	case CLAIM_STATUS_CLAIMED:
+		return "CLAIMED"
+	case CLAIM_STATUS_IN_PROGRESS:
+		return "IN_PROGRESS"
+	case CLAIM_STATUS_COMPLETED:
+		return "COMPLETED"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", s)
+	}
+}
+
+// IdempotencyStore tracks which notifications are being processed and which have been processed successfully.
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Claim claims id for processing. Checking and claiming must be atomic, so that concurrent calls with the
+	// same id return CLAIM_STATUS_CLAIMED at most once until the claim is released or expires.
+	// With CLAIM_STATUS_CLAIMED it returns a token that identifies the claim.
+	Claim(id string) (status ClaimStatus, token string, err error)
+
+	// Complete records that id was processed successfully under the claim identified by token.
+	// Later claims return CLAIM_STATUS_COMPLETED. It returns ErrClaimLost if the claim has expired and id has
+	// been claimed again since.
+	Complete(id, token string) error
+
+	// Release gives up the claim identified by token after processing failed, so id can be claimed again.
+	// It returns ErrClaimLost, and leaves id alone, if the claim has expired and id has been claimed again since.
+	Release(id, token string) error
+}
+
+// LeasedIdempotencyStore is an IdempotencyStore whose claims expire after a lease.
+// IdempotentNotificationCallback gives callbacks a context that expires with the lease of their claim.
+type LeasedIdempotencyStore interface {
+	IdempotencyStore
+
+	// Lease returns how long a claim lasts.
+	Lease() time.Duration
+}
+
+// ErrNotificationInProgress is returned by an idempotent NotificationCallback for a notification that is being
+// processed by another call, so the App Store sends it again later.
+var ErrNotificationInProgress = errors.New("notification is already being processed")
+
+// ErrClaimLost is returned by an IdempotencyStore when a claim is completed or released after it expired and
+// the notification was claimed again.
+var ErrClaimLost = errors.New("claim has expired and the notification was claimed again")
+
+// IdempotentNotificationCallback wraps callback so each notificationUUID is processed successfully at most once,
+// even when the App Store delivers it several times or concurrently:
+//
+//   - A notification that was already processed successfully is acknowledged without calling callback.
+//   - A notification that is being processed returns ErrNotificationInProgress.
+//   - A notification whose callback fails is released, so the App Store's retry processes it again.
+//
+// Claims expire after the store's lease, so callbacks must finish within it. When the store is a
+// LeasedIdempotencyStore, the callback's context expires with the lease. A callback that finishes after its
+// claim was taken over by another delivery can't complete or release it, and ErrClaimLost is returned.
+// If the store fails to record a completion, the error is returned and the notification can be processed again
+// once its claim expires.
+//
+// Prefer it to WithReplayStore for notifications: a replay store records a notification as seen before it is
+// processed, so a notification whose processing failed can't be retried.
+func IdempotentNotificationCallback(store IdempotencyStore, callback NotificationCallback) NotificationCallback {
+	return func(ctx context.Context, notification *ResponseBodyV2DecodedPayload) error {
+		id := notification.NotificationUUID
+		if id == "" {
+			return &PermanentNotificationError{Err: errors.New("notification has no notificationUUID")}
+		}
+		status, token, err := store.Claim(id)
+		if err != nil {
+			return fmt.Errorf("failed to claim notification %s: %w", id, err)
+		}
+		switch status {
+		case CLAIM_STATUS_COMPLETED:
+			return nil
+		case CLAIM_STATUS_IN_PROGRESS:
+			return ErrNotificationInProgress
+		}
+
+		if leased, ok := store.(LeasedIdempotencyStore); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, leased.Lease())
+			defer cancel()
+		}
+		if err := callback(ctx, notification); err != nil {
+			if releaseErr := store.Release(id, token); releaseErr != nil {
+				return errors.Join(err, fmt.Errorf("failed to release notification %s: %w", id, releaseErr))
+			}
+			return err
+		}
+		if err := store.Complete(id, token); err != nil {
+			return fmt.Errorf("notification %s was processed but not recorded as complete: %w", id, err)
+		}
+		return nil
+	}
+}
+
+type idempotencyEntry struct {
+	Token     string
+	Completed bool
+	Expiry    time.Time
+}
+
+// idempotencyTable keeps the claims and completions of an IdempotencyStore in memory.
+type idempotencyTable struct {
+	mutex     sync.Mutex
+	lease     time.Duration
+	retention time.Duration
+	entries   map[string]idempotencyEntry
+	now       func() time.Time
+	sweepAt   time.Time
+
+	// persist records a change before it is applied; a nil entry removes id. It is nil for stores kept in memory.
+	persist func(id string, entry *idempotencyEntry) error
+}
+
+func newIdempotencyTable(lease, retention time.Duration) idempotencyTable {
+	return idempotencyTable{lease: lease, retention: retention, entries: make(map[string]idempotencyEntry), now: time.Now}
+}
+
+func (t *idempotencyTable) claim(id string) (ClaimStatus, string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	t.sweep(now)
+	if entry, ok := t.entries[id]; ok && now.Before(entry.Expiry) {
+		if entry.Completed {
+			return CLAIM_STATUS_COMPLETED, "", nil
+		}
+		return CLAIM_STATUS_IN_PROGRESS, "", nil
+	}
+	token := uuid.New().String()
+	if err := t.set(id, &idempotencyEntry{Token: token, Expiry: now.Add(t.lease)}); err != nil {
+		return 0, "", err
+	}
+	return CLAIM_STATUS_CLAIMED, token, nil
+}
+
+// complete and release act on a claim that has expired, as long as id hasn't been claimed again since.
+func (t *idempotencyTable) complete(id, token string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	entry, ok := t.entries[id]
+	switch {
+	case ok && entry.Completed:
+		return nil
+	case ok && entry.Token != token:
+		return ErrClaimLost
+	}
+	return t.set(id, &idempotencyEntry{Completed: true, Expiry: t.now().Add(t.retention)})
+}
+
+func (t *idempotencyTable) release(id, token string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	entry, ok := t.entries[id]
+	switch {
+	case !ok || entry.Completed:
+		return nil
+	case entry.Token != token:
+		return ErrClaimLost
+	}
+	return t.set(id, nil)
+}
+
+func (t *idempotencyTable) set(id string, entry *idempotencyEntry) error {
+	if t.persist != nil {
+		if err := t.persist(id, entry); err != nil {
+			return err
+		}
+	}
+	if entry == nil {
+		delete(t.entries, id)
+	} else {
+		t.entries[id] = *entry
+	}
+	return nil
+}
+
+func (t *idempotencyTable) sweep(now time.Time) {
+	if now.Before(t.sweepAt) {
+		return
+	}
+	for id, entry := range t.entries {
+		if !now.Before(entry.Expiry) {
+			delete(t.entries, id)
+		}
+	}
+	t.sweepAt = now.Add(min(t.lease, t.retention))
+}
+
+func (t *idempotencyTable) len() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.entries)
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore that keeps claims in memory.
+// It suits a single server that can afford to process notifications again after a restart.
+type MemoryIdempotencyStore struct {
+	table idempotencyTable
+}
+
+// NewMemoryIdempotencyStore creates a store whose claims expire after lease, and which remembers completed
+// notifications for retention. The App Store retries a notification for several days, so retention should cover that.
+func NewMemoryIdempotencyStore(lease, retention time.Duration) (*MemoryIdempotencyStore, error) {
+	if lease <= 0 || retention <= 0 {
+		return nil, errors.New("lease and retention must be positive")
+	}
+	return &MemoryIdempotencyStore{table: newIdempotencyTable(lease, retention)}, nil
+}
+
+// Claim claims id for processing.
+func (s *MemoryIdempotencyStore) Claim(id string) (ClaimStatus, string, error) {
+	return s.table.claim(id)
+}
+
+// Complete records that id was processed successfully under the claim identified by token.
+func (s *MemoryIdempotencyStore) Complete(id, token string) error {
+	return s.table.complete(id, token)
+}
+
+// Release gives up the claim identified by token.
+func (s *MemoryIdempotencyStore) Release(id, token string) error {
+	return s.table.release(id, token)
+}
+
+// Lease returns how long a claim lasts.
+func (s *MemoryIdempotencyStore) Lease() time.Duration {
+	return s.table.lease
+}
+
+// Len returns the number of claimed and completed notifications remembered, including any that have expired but not yet been swept.
+func (s *MemoryIdempotencyStore) Len() int {
+	return s.table.len()
+}
+
+// idempotencyRecord is a line of a FileIdempotencyStore's log.
+type idempotencyRecord struct {
+	ID        string    `json:"id"`
+	Token     string    `json:"token,omitempty"`
+	Released  bool      `json:"released,omitempty"`
+	Completed bool      `json:"completed,omitempty"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+// FileIdempotencyStore is an IdempotencyStore that appends every change to a file, so completed notifications are
+// remembered across restarts. Only one process may use a file at a time.
+type FileIdempotencyStore struct {
+	table   idempotencyTable
+	path    string
+	file    *os.File
+	records int
+}
+
+// NewFileIdempotencyStore opens the store logged in path, creating it if it doesn't exist.
+// Claims expire after lease, and completed notifications are remembered for retention.
+func NewFileIdempotencyStore(path string, lease, retention time.Duration) (*FileIdempotencyStore, error) {
+	if lease <= 0 || retention <= 0 {
+		return nil, errors.New("lease and retention must be positive")
+	}
+	s := &FileIdempotencyStore{table: newIdempotencyTable(lease, retention), path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	s.table.persist = s.append
+	return s, nil
+}
+
+// Claim claims id for processing.
+func (s *FileIdempotencyStore) Claim(id string) (ClaimStatus, string, error) {
+	return s.table.claim(id)
+}
+
+// Complete records that id was processed successfully under the claim identified by token.
+func (s *FileIdempotencyStore) Complete(id, token string) error {
+	return s.table.complete(id, token)
+}
+
+// Release gives up the claim identified by token.
+func (s *FileIdempotencyStore) Release(id, token string) error {
+	return s.table.release(id, token)
+}
+
+// Lease returns how long a claim lasts.
+func (s *FileIdempotencyStore) Lease() time.Duration {
+	return s.table.lease
+}
+
+// Close closes the file.
+func (s *FileIdempotencyStore) Close() error {
+	s.table.mutex.Lock()
+	defer s.table.mutex.Unlock()
+	return s.file.Close()
+}
+
+// load replays the log. A malformed last line, from a write interrupted by a crash, is ignored.
+func (s *FileIdempotencyStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := s.table.now()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		var record idempotencyRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			if !scanner.Scan() {
+				break
+			}
+			return fmt.Errorf("%s:%d: %w", s.path, line, err)
+		}
+		if record.Released || !now.Before(record.Expiry) {
+			delete(s.table.entries, record.ID)
+		} else {
+			s.table.entries[record.ID] = idempotencyEntry{Token: record.Token, Completed: record.Completed, Expiry: record.Expiry}
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the log with one line per remembered notification, and opens it for appending.
+func (s *FileIdempotencyStore) compact() error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for id, entry := range s.table.entries {
+		if err := encoder.Encode(idempotencyRecord{ID: id, Token: entry.Token, Completed: entry.Completed, Expiry: entry.Expiry}); err != nil {
+			return err
+		}
+	}
+
+	tmp := s.path + ".tmp"
+	if err := writeFileSync(tmp, buf.Bytes()); err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.records = len(s.table.entries)
+	return nil
+}
+
+// append logs a change and syncs it to disk. It is called with the table locked, before the change is applied.
+func (s *FileIdempotencyStore) append(id string, entry *idempotencyEntry) error {
+	// Swept and superseded lines are dropped once they outnumber the live ones
+	if s.records > 2*len(s.table.entries)+1024 {
+		s.table.sweep(s.table.now())
+		if err := s.compact(); err != nil {
+			return fmt.Errorf("failed to compact %s: %w", s.path, err)
+		}
+	}
+
+	record := idempotencyRecord{ID: id, Released: entry == nil}
+	if entry != nil {
+		record.Token = entry.Token
+		record.Completed = entry.Completed
+		record.Expiry = entry.Expiry
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.records++
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
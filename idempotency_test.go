@@ -0,0 +1,230 @@
+package appstore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testNotificationUUID = "002e14d5-51f5-4503-b5a8-c3a1af68eb20"
+
+func TestIdempotentNotificationCallback(t *testing.T) {
+	assert := assert.New(t)
+	store, err := NewMemoryIdempotencyStore(time.Minute, time.Hour)
+	assert.NoError(err, "Failed to create store")
+	notification := &ResponseBodyV2DecodedPayload{NotificationUUID: testNotificationUUID}
+	ctx := context.Background()
+
+	calls := 0
+	callbackErr := errors.New("database unavailable")
+	callback := IdempotentNotificationCallback(store, func(ctx context.Context, n *ResponseBodyV2DecodedPayload) error {
+		calls++
+		return callbackErr
+	})
+
+	assert.ErrorIs(callback(ctx, notification), callbackErr, "Callback error returned")
+	callbackErr = nil
+	assert.NoError(callback(ctx, notification), "A failed notification is released, so the retry is processed")
+	assert.NoError(callback(ctx, notification), "A processed notification is acknowledged")
+	assert.Equal(2, calls, "Processed notifications aren't processed again")
+
+	status, _, err := store.Claim("d5a4b9d1-8b2b-4a8b-9f6a-6f1c1a2b3c4d")
+	assert.NoError(err, "Claim")
+	assert.Equal(CLAIM_STATUS_CLAIMED, status, "Claim status")
+	assert.ErrorIs(callback(ctx, &ResponseBodyV2DecodedPayload{NotificationUUID: "d5a4b9d1-8b2b-4a8b-9f6a-6f1c1a2b3c4d"}), ErrNotificationInProgress,
+		"A notification claimed by another call is in progress")
+	assert.Equal(2, calls, "Callback not called for notifications in progress")
+
+	var permanentErr *PermanentNotificationError
+	assert.ErrorAs(callback(ctx, &ResponseBodyV2DecodedPayload{}), &permanentErr, "notificationUUID is required")
+	assert.Equal("IN_PROGRESS", CLAIM_STATUS_IN_PROGRESS.String(), "String")
+}
+
+func TestIdempotentNotificationCallbackConcurrent(t *testing.T) {
+	store, err := NewMemoryIdempotencyStore(time.Minute, time.Hour)
+	assert.NoError(t, err, "Failed to create store")
+	var calls atomic.Int32
+	release := make(chan struct{})
+	callback := IdempotentNotificationCallback(store, func(ctx context.Context, n *ResponseBodyV2DecodedPayload) error {
+		calls.Add(1)
+		<-release
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	var inProgress atomic.Int32
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if errors.Is(callback(context.Background(), &ResponseBodyV2DecodedPayload{NotificationUUID: testNotificationUUID}), ErrNotificationInProgress) {
+				inProgress.Add(1)
+			}
+		}()
+	}
+	for inProgress.Load() < 9 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load(), "Only one delivery is processed")
+}
+
+func TestIdempotentNotificationCallbackIsBoundedByTheLease(t *testing.T) {
+	assert := assert.New(t)
+	store, err := NewMemoryIdempotencyStore(20*time.Millisecond, time.Hour)
+	assert.NoError(err, "Failed to create store")
+
+	var deadline time.Time
+	callback := IdempotentNotificationCallback(store, func(ctx context.Context, n *ResponseBodyV2DecodedPayload) error {
+		deadline, _ = ctx.Deadline()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	start := time.Now()
+	err = callback(context.Background(), &ResponseBodyV2DecodedPayload{NotificationUUID: testNotificationUUID})
+	assert.ErrorIs(err, context.DeadlineExceeded, "The callback's context expires with the lease")
+	assert.WithinDuration(start.Add(20*time.Millisecond), deadline, 10*time.Millisecond, "Deadline")
+
+	status, _, _ := store.Claim(testNotificationUUID)
+	assert.Equal(CLAIM_STATUS_CLAIMED, status, "A callback that ran out of time is released")
+}
+
+func TestIdempotentNotificationCallbackAfterItsClaimWasTakenOver(t *testing.T) {
+	assert := assert.New(t)
+	store, err := NewMemoryIdempotencyStore(time.Minute, time.Hour)
+	assert.NoError(err, "Failed to create store")
+	now := time.Now()
+	store.table.now = func() time.Time { return now }
+	notification := &ResponseBodyV2DecodedPayload{NotificationUUID: testNotificationUUID}
+
+	var takeoverToken string
+	callbackErr := errors.New("database unavailable")
+	callback := IdempotentNotificationCallback(store, func(ctx context.Context, n *ResponseBodyV2DecodedPayload) error {
+		// The lease expires while the first delivery is processed, and a second delivery claims the notification
+		now = now.Add(2 * time.Minute)
+		var status ClaimStatus
+		status, takeoverToken, _ = store.Claim(testNotificationUUID)
+		assert.Equal(CLAIM_STATUS_CLAIMED, status, "The expired claim is taken over")
+		return callbackErr
+	})
+
+	err = callback(context.Background(), notification)
+	assert.ErrorIs(err, callbackErr, "Callback error returned")
+	assert.ErrorIs(err, ErrClaimLost, "The late release fails")
+	status, _, _ := store.Claim(testNotificationUUID)
+	assert.Equal(CLAIM_STATUS_IN_PROGRESS, status, "The late release leaves the second claim alone")
+
+	now = now.Add(2 * time.Minute)
+	_, lateToken, _ := store.Claim(testNotificationUUID)
+	now = now.Add(2 * time.Minute)
+	_, takeoverToken, _ = store.Claim(testNotificationUUID)
+	assert.ErrorIs(store.Complete(testNotificationUUID, lateToken), ErrClaimLost, "The late completion fails")
+	assert.NoError(store.Complete(testNotificationUUID, takeoverToken), "The second claim completes")
+	assert.NoError(store.Release(testNotificationUUID, lateToken), "Releasing a completed notification does nothing")
+	status, _, _ = store.Claim(testNotificationUUID)
+	assert.Equal(CLAIM_STATUS_COMPLETED, status, "Completed")
+}
+
+func TestNewMemoryIdempotencyStoreErrors(t *testing.T) {
+	_, err := NewMemoryIdempotencyStore(0, time.Hour)
+	assert.Error(t, err, "Lease must be positive")
+	_, err = NewMemoryIdempotencyStore(time.Minute, -time.Hour)
+	assert.Error(t, err, "Retention must be positive")
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	assert := assert.New(t)
+	store, err := NewMemoryIdempotencyStore(time.Minute, time.Hour)
+	assert.NoError(err, "Failed to create store")
+	now := time.Now()
+	store.table.now = func() time.Time { return now }
+
+	status, _, _ := store.Claim(testNotificationUUID)
+	assert.Equal(CLAIM_STATUS_CLAIMED, status, "First claim")
+	now = now.Add(2 * time.Minute)
+	status, token, _ := store.Claim(testNotificationUUID)
+	assert.Equal(CLAIM_STATUS_CLAIMED, status, "An expired claim can be claimed again")
+
+	assert.NoError(store.Complete(testNotificationUUID, token), "Complete")
+	assert.NoError(store.Release(testNotificationUUID, token), "Releasing a completed notification does nothing")
+	status, _, _ = store.Claim(testNotificationUUID)
+	assert.Equal(CLAIM_STATUS_COMPLETED, status, "Completed")
+
+	now = now.Add(2 * time.Hour)
+	status, _, _ = store.Claim(testNotificationUUID)
+	assert.Equal(CLAIM_STATUS_CLAIMED, status, "Completed notifications are forgotten after the retention")
+	assert.Equal(1, store.Len(), "Expired entries are swept")
+}
+
+func TestFileIdempotencyStore(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	store, err := NewFileIdempotencyStore(path, time.Minute, time.Hour)
+	assert.NoError(err, "Failed to open store")
+
+	const claimed, released = "1b0c1d2e-0000-4000-8000-000000000001", "1b0c1d2e-0000-4000-8000-000000000002"
+	tokens := map[string]string{}
+	for _, id := range []string{testNotificationUUID, claimed, released} {
+		status, token, err := store.Claim(id)
+		assert.NoError(err, "Claim")
+		assert.Equal(CLAIM_STATUS_CLAIMED, status, "Claim status")
+		tokens[id] = token
+	}
+	assert.NoError(store.Complete(testNotificationUUID, tokens[testNotificationUUID]), "Complete")
+	assert.NoError(store.Release(released, tokens[released]), "Release")
+	assert.NoError(store.Close(), "Close")
+
+	store, err = NewFileIdempotencyStore(path, time.Minute, time.Hour)
+	assert.NoError(err, "Failed to reopen store")
+	status, _, _ := store.Claim(testNotificationUUID)
+	assert.Equal(CLAIM_STATUS_COMPLETED, status, "Completions survive a restart")
+	status, _, _ = store.Claim(claimed)
+	assert.Equal(CLAIM_STATUS_IN_PROGRESS, status, "Claims survive a restart until they expire")
+	assert.ErrorIs(store.Release(claimed, tokens[released]), ErrClaimLost, "Claim tokens survive a restart")
+	assert.NoError(store.Release(claimed, tokens[claimed]), "Release with the persisted token")
+	status, _, _ = store.Claim(released)
+	assert.Equal(CLAIM_STATUS_CLAIMED, status, "Released notifications can be claimed")
+	assert.NoError(store.Close(), "Close")
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(err, "Failed to open log")
+	_, err = file.WriteString(`{"id":"interrupted`)
+	assert.NoError(err, "Failed to write log")
+	file.Close()
+	store, err = NewFileIdempotencyStore(path, time.Minute, time.Hour)
+	assert.NoError(err, "An interrupted last line is ignored")
+	status, _, _ = store.Claim(testNotificationUUID)
+	assert.Equal(CLAIM_STATUS_COMPLETED, status, "Completed")
+	assert.NoError(store.Close(), "Close")
+
+	assert.NoError(os.WriteFile(path, []byte("not json\n{}\n"), 0o600), "Failed to write log")
+	_, err = NewFileIdempotencyStore(path, time.Minute, time.Hour)
+	assert.Error(err, "Expected corrupt log error")
+	_, err = NewFileIdempotencyStore(path, 0, time.Hour)
+	assert.Error(err, "Lease must be positive")
+}
+
+func TestFileIdempotencyStoreCompaction(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "notifications.log")
+	store, err := NewFileIdempotencyStore(path, time.Minute, time.Hour)
+	assert.NoError(err, "Failed to open store")
+	defer store.Close()
+
+	for range 2000 {
+		_, token, err := store.Claim(testNotificationUUID)
+		assert.NoError(err, "Claim")
+		assert.NoError(store.Release(testNotificationUUID, token), "Release")
+	}
+	assert.Less(store.records, 2000, "The log is compacted")
+	status, _, _ := store.Claim(testNotificationUUID)
+	assert.Equal(CLAIM_STATUS_CLAIMED, status, "Claim after compaction")
+}
@@ -0,0 +1,140 @@
+package appstore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// InspectedPayloadKind is the kind of signed object Inspect detected from its claims.
+type InspectedPayloadKind string
+
+const (
+	INSPECTED_PAYLOAD_KIND_TRANSACTION      InspectedPayloadKind = "TRANSACTION"
+	INSPECTED_PAYLOAD_KIND_RENEWAL_INFO     InspectedPayloadKind = "RENEWAL_INFO"
+	INSPECTED_PAYLOAD_KIND_NOTIFICATION     InspectedPayloadKind = "NOTIFICATION"
+	INSPECTED_PAYLOAD_KIND_APP_TRANSACTION  InspectedPayloadKind = "APP_TRANSACTION"
+	INSPECTED_PAYLOAD_KIND_REALTIME_REQUEST InspectedPayloadKind = "REALTIME_REQUEST"
+	INSPECTED_PAYLOAD_KIND_UNKNOWN          InspectedPayloadKind = "UNKNOWN"
+)
+
+// UnverifiedJWS is the decoded content of a JWS whose signature and certificate chain have NOT been verified.
+// Anyone can create a JWS with any content, so never use it to grant access or entitlements; use a
+// SignedDataVerifier for that.
+type UnverifiedJWS struct {
+	// The decoded protected header.
+	UnverifiedHeader map[string]any
+
+	// The certificates of the x5c header, leaf first. They haven't been validated.
+	UnverifiedCertificates []CertificateSummary
+
+	// The kind of payload, detected from the claims it contains.
+	Kind InspectedPayloadKind
+
+	// The payload decoded into the model for Kind: a *JWSTransactionDecodedPayload, *JWSRenewalInfoDecodedPayload,
+	// *ResponseBodyV2DecodedPayload, *AppTransaction or *DecodedRealtimeRequestBody. For INSPECTED_PAYLOAD_KIND_UNKNOWN
+	// it is the map of claims.
+	UnverifiedPayload any
+
+	// The raw claims of the payload.
+	UnverifiedClaims map[string]json.RawMessage
+}
+
+// Inspect decodes a JWS for debugging WITHOUT verifying its signature or certificate chain, and without
+// checking the bundle ID, environment or any other claim. The header, certificates and payload are only as
+// trustworthy as whoever sent the JWS.
+//
+// Inspect only fails if the JWS can't be decoded at all.
+func Inspect(jws string) (*UnverifiedJWS, error) {
+	headerSegment, payloadSegment, _, err := splitJWS(jws)
+	if err != nil {
+		return nil, err
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(headerSegment)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header encoding: %w", err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadSegment)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload encoding: %w", err)
+	}
+
+	result := &UnverifiedJWS{}
+	if err := json.Unmarshal(headerJSON, &result.UnverifiedHeader); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("invalid x5c header format: %w", err)
+	}
+	for i, certStr := range header.X5c {
+		certBytes, err := base64.StdEncoding.DecodeString(certStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x5c certificate %d: %w", i, err)
+		}
+		cert, err := x509.ParseCertificate(certBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x5c certificate %d: %w", i, err)
+		}
+		result.UnverifiedCertificates = append(result.UnverifiedCertificates, summarizeCertificate(cert))
+	}
+
+	if err := json.Unmarshal(payload, &result.UnverifiedClaims); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	result.Kind = detectPayloadKind(result.UnverifiedClaims)
+	switch result.Kind {
+	case INSPECTED_PAYLOAD_KIND_NOTIFICATION:
+		result.UnverifiedPayload = &ResponseBodyV2DecodedPayload{}
+	case INSPECTED_PAYLOAD_KIND_REALTIME_REQUEST:
+		result.UnverifiedPayload = &DecodedRealtimeRequestBody{}
+	case INSPECTED_PAYLOAD_KIND_APP_TRANSACTION:
+		result.UnverifiedPayload = &AppTransaction{}
+	case INSPECTED_PAYLOAD_KIND_RENEWAL_INFO:
+		result.UnverifiedPayload = &JWSRenewalInfoDecodedPayload{}
+	case INSPECTED_PAYLOAD_KIND_TRANSACTION:
+		result.UnverifiedPayload = &JWSTransactionDecodedPayload{}
+	default:
+		var claims map[string]any
+		decoder := json.NewDecoder(bytes.NewReader(payload))
+		decoder.UseNumber()
+		if err := decoder.Decode(&claims); err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		result.UnverifiedPayload = claims
+		return result, nil
+	}
+	if err := json.Unmarshal(payload, result.UnverifiedPayload); err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", result.Kind, err)
+	}
+	return result, nil
+}
+
+// detectPayloadKind identifies a payload by claims only its kind carries. Transactions and renewal info
+// share several claims, so the more specific kinds are checked first.
+func detectPayloadKind(claims map[string]json.RawMessage) InspectedPayloadKind {
+	has := func(names ...string) bool {
+		for _, name := range names {
+			if _, ok := claims[name]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case has("notificationType"):
+		return INSPECTED_PAYLOAD_KIND_NOTIFICATION
+	case has("requestIdentifier"):
+		return INSPECTED_PAYLOAD_KIND_REALTIME_REQUEST
+	case has("receiptType", "originalApplicationVersion"):
+		return INSPECTED_PAYLOAD_KIND_APP_TRANSACTION
+	case has("autoRenewStatus", "autoRenewProductId", "renewalDate"):
+		return INSPECTED_PAYLOAD_KIND_RENEWAL_INFO
+	case has("transactionId"):
+		return INSPECTED_PAYLOAD_KIND_TRANSACTION
+	default:
+		return INSPECTED_PAYLOAD_KIND_UNKNOWN
+	}
+}
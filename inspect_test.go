@@ -0,0 +1,70 @@
+package appstore
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspectDetectsPayloadKind(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		path string
+		kind InspectedPayloadKind
+	}{
+		{"models/signedTransaction.json", INSPECTED_PAYLOAD_KIND_TRANSACTION},
+		{"models/signedRenewalInfo.json", INSPECTED_PAYLOAD_KIND_RENEWAL_INFO},
+		{"models/signedNotification.json", INSPECTED_PAYLOAD_KIND_NOTIFICATION},
+		{"models/appTransaction.json", INSPECTED_PAYLOAD_KIND_APP_TRANSACTION},
+		{"models/decodedRealtimeRequest.json", INSPECTED_PAYLOAD_KIND_REALTIME_REQUEST},
+	}
+	for _, test := range tests {
+		signed, err := createSignedDataFromJSON(test.path)
+		assert.NoError(err, "Failed to create signed data for %s", test.path)
+		inspected, err := Inspect(signed)
+		assert.NoError(err, "Failed to inspect %s", test.path)
+		assert.Equal(test.kind, inspected.Kind, "Kind of %s", test.path)
+		assert.Equal("ES256", inspected.UnverifiedHeader["alg"], "Algorithm of %s", test.path)
+	}
+
+	signed, err := createSignedDataFromJSON("models/signedTransaction.json")
+	assert.NoError(err, "Failed to create signed data")
+	inspected, err := Inspect(signed)
+	assert.NoError(err, "Failed to inspect transaction")
+	if transaction, ok := inspected.UnverifiedPayload.(*JWSTransactionDecodedPayload); assert.True(ok, "Payload type") {
+		assert.Equal("23456", transaction.TransactionId, "TransactionId")
+	}
+	assert.Contains(inspected.UnverifiedClaims, "transactionId", "Raw claims")
+}
+
+func TestInspectCertificatesAndUnknownPayloads(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	other := createTestPKI(t)
+	signed := createTestSignedPayload(t, other, jwt.MapClaims{"customClaim": 12345678901234567})
+
+	inspected, err := Inspect(signed)
+	assert.NoError(err, "Inspect doesn't verify the signer")
+	assert.Equal(INSPECTED_PAYLOAD_KIND_UNKNOWN, inspected.Kind, "Kind")
+	if claims, ok := inspected.UnverifiedPayload.(map[string]any); assert.True(ok, "Payload type") {
+		assert.Equal(json.Number("12345678901234567"), claims["customClaim"], "Numbers keep their precision")
+	}
+	if assert.Len(inspected.UnverifiedCertificates, 3, "Certificates") {
+		assert.Equal(summarizeCertificate(other.leaf).SHA256Fingerprint, inspected.UnverifiedCertificates[0].SHA256Fingerprint, "Leaf first")
+		assert.NotEqual(summarizeCertificate(pki.leaf).SHA256Fingerprint, inspected.UnverifiedCertificates[0].SHA256Fingerprint, "Leaf of the signer")
+	}
+
+	encodedTransaction, err := readTestDataString("xcode/xcode-signed-transaction")
+	assert.NoError(err, "Failed to read test data")
+	inspected, err = Inspect(encodedTransaction)
+	assert.NoError(err, "Failed to inspect Xcode transaction")
+	assert.Equal(INSPECTED_PAYLOAD_KIND_TRANSACTION, inspected.Kind, "Kind")
+	assert.Len(inspected.UnverifiedCertificates, 1, "Xcode signs with a single certificate")
+
+	_, err = Inspect("not a jws")
+	assert.Error(err, "Expected malformed token error")
+	_, err = Inspect("e30.bm90IGpzb24.")
+	assert.Error(err, "Expected invalid payload error")
+}
@@ -0,0 +1,145 @@
+package appstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// WithLocalTestCertificates verifies signed data for the Xcode and LocalTesting environments against the given
+// DER encoded certificates, such as the certificate exported from Xcode's transaction manager with
+// Editor > Save Public Certificate, or the root of a local test PKI. The x5c chain must end at one of them,
+// and the data is validated at its signing time, because StoreKit testing certificates are short-lived.
+// Anyone with Xcode can sign data with such a certificate, so data for any other environment is rejected
+// with INVALID_ENVIRONMENT.
+func WithLocalTestCertificates(certificates ...[]byte) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.localTestCerts = append(c.localTestCerts, certificates...)
+	}
+}
+
+// WithUnverifiedLocalTesting decodes signed data for the Xcode and LocalTesting environments without verifying its
+// signature. Anyone can forge such data, so only use it in tests.
+func WithUnverifiedLocalTesting() SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.unverifiedLocal = true
+	}
+}
+
+func isLocalEnvironment(environment Environment) bool {
+	return environment == ENVIRONMENT_XCODE || environment == ENVIRONMENT_LOCAL_TESTING
+}
+
+func parseLocalTestCertificates(certificates [][]byte) (*x509.CertPool, error) {
+	if len(certificates) == 0 {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	for _, der := range certificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, NewVerificationException(INVALID_CERTIFICATE, err)
+		}
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// verifyLocalSignature verifies the x5c chain against the local test certificates, at the signing time if the data has one,
+// and the ES256 signature over the header and payload. Apple's certificate OIDs and revocation aren't checked, so the
+// payload must then pass checkLocalPayloadEnvironment.
+func (v *SignedDataVerifier) verifyLocalSignature(headerSegment, payloadSegment, signatureSegment string, payload []byte, report *VerificationReport) (ValidationTime, error) {
+	validationTime := ValidationTime{Policy: v.effectiveDatePolicy}
+	header, signature, err := parseJWS(headerSegment, signatureSegment)
+	if err != nil {
+		return validationTime, err
+	}
+	signingTime, source, err := signingTimeOf(payload)
+	if err != nil {
+		return validationTime, err
+	}
+	effectiveDate := signingTime
+	if source == SIGNING_TIME_SOURCE_NONE {
+		validationTime.CurrentTime = v.now()
+		effectiveDate = validationTime.CurrentTime
+	} else {
+		validationTime.SigningTime = signingTime
+		validationTime.SigningTimeSource = source
+	}
+
+	certs := make([]*x509.Certificate, len(header.X5c))
+	for i, certStr := range header.X5c {
+		certBytes, err := base64.StdEncoding.DecodeString(certStr)
+		if err != nil {
+			return validationTime, NewVerificationException(INVALID_CERTIFICATE, err)
+		}
+		if certs[i], err = x509.ParseCertificate(certBytes); err != nil {
+			return validationTime, NewVerificationException(INVALID_CERTIFICATE, err)
+		}
+	}
+	report.setChain(certs)
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         v.localRoots,
+		Intermediates: intermediates,
+		CurrentTime:   effectiveDate,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return validationTime, fmt.Errorf("chain doesn't verify against the local test certificates: %w", err)
+	}
+	report.setMatchedRoot(chains[0][len(chains[0])-1])
+
+	publicKey, ok := certs[0].PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return validationTime, errors.New("not an ECDSA public key")
+	}
+	if err := jwt.SigningMethodES256.Verify(headerSegment+"."+payloadSegment, signature, publicKey); err != nil {
+		return validationTime, err
+	}
+	return validationTime, nil
+}
+
+// localPayloadClaims holds the claims that name the environment of any payload the verifier decodes.
+type localPayloadClaims struct {
+	Environment           Environment            `json:"environment"`
+	ReceiptType           Environment            `json:"receiptType"`
+	Data                  *Data                  `json:"data"`
+	Summary               *Summary               `json:"summary"`
+	ExternalPurchaseToken *ExternalPurchaseToken `json:"externalPurchaseToken"`
+	AppData               *AppData               `json:"appData"`
+}
+
+// checkLocalPayloadEnvironment rejects a payload decoded on the local path that wasn't signed for the Xcode or
+// LocalTesting environment, so data for other environments can't skip Apple's signature checks.
+func checkLocalPayloadEnvironment(payload []byte) error {
+	var claims localPayloadClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return NewVerificationException(VERIFICATION_FAILURE, err)
+	}
+	environment := claims.Environment
+	if environment == "" {
+		environment = claims.ReceiptType
+	}
+	if environment == "" {
+		_, _, environment = notificationAppIdentifier(&ResponseBodyV2DecodedPayload{
+			Data:                  claims.Data,
+			Summary:               claims.Summary,
+			ExternalPurchaseToken: claims.ExternalPurchaseToken,
+			AppData:               claims.AppData,
+		})
+	}
+	if !isLocalEnvironment(environment) {
+		return NewVerificationException(INVALID_ENVIRONMENT, fmt.Errorf("environment %q isn't a local testing environment", environment))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package appstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalTestingOptions(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+
+	_, err := NewSignedDataVerifier(nil, false, ENVIRONMENT_XCODE, XCODE_BUNDLE_ID, 0)
+	assert.Error(err, "Xcode verifiers must choose how signatures are checked")
+
+	_, err = NewSignedDataVerifierWithOptions(nil, WithEnvironments(ENVIRONMENT_LOCAL_TESTING),
+		WithLocalTestCertificates(pki.root.Raw), WithUnverifiedLocalTesting())
+	assert.Error(err, "Expected error for both local test certificates and unverified local testing")
+
+	_, err = NewSignedDataVerifierWithOptions(nil, WithEnvironments(ENVIRONMENT_LOCAL_TESTING), WithLocalTestCertificates([]byte("invalid")))
+	assertVerificationStatus(t, INVALID_CERTIFICATE, err)
+
+	_, err = NewSignedDataVerifierWithOptions([][]byte{pki.root.Raw}, WithEnvironments(ENVIRONMENT_SANDBOX))
+	assert.NoError(err, "Local test options aren't needed for other environments")
+}
+
+func TestLocalTestCertificatesVerifySignatures(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier, err := NewSignedDataVerifierWithOptions(nil,
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING),
+		WithBundleID("com.example"),
+		WithLocalTestCertificates(pki.root.Raw),
+	)
+	assert.NoError(err, "Failed to create verifier")
+
+	signed := createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": "LocalTesting"})
+	report, err := verifier.VerifyWithReport(signed, &JWSTransactionDecodedPayload{})
+	assert.NoError(err, "Expected valid transaction")
+	assert.True(report.SignatureVerified, "SignatureVerified")
+	assert.False(report.OnlineChecks, "OnlineChecks")
+	assert.Len(report.Chain, 3, "Chain")
+	assert.NotNil(report.MatchedRoot, "MatchedRoot")
+
+	other := createTestPKI(t)
+	_, err = verifier.VerifyAndDecodeSignedTransaction(createTestSignedPayload(t, other, jwt.MapClaims{"bundleId": "com.example", "environment": "LocalTesting"}))
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+
+	unsigned, err := createSignedDataFromJSON("models/signedTransaction.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeSignedTransaction(unsigned)
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+}
+
+func TestLocalTestCertificatesRejectOtherEnvironments(t *testing.T) {
+	pki := createTestPKI(t)
+	verifier, err := NewSignedDataVerifierWithOptions(nil,
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING, ENVIRONMENT_XCODE),
+		WithBundleID("com.example"),
+		WithLocalTestCertificates(pki.root.Raw),
+	)
+	assert.NoError(t, err, "Failed to create verifier")
+
+	for _, environment := range []string{"Production", "Sandbox", ""} {
+		signed := createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": environment})
+		_, err = verifier.VerifyAndDecodeSignedTransaction(signed)
+		assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+		_, err = VerifyAndDecode[Claims](verifier, signed)
+		assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+	}
+
+	signed := createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "receiptType": "Production", "appAppleId": 1234})
+	_, err = verifier.VerifyAndDecodeAppTransaction(signed)
+	assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+
+	signed = createTestSignedPayload(t, pki, jwt.MapClaims{"notificationType": "TEST", "data": map[string]any{"bundleId": "com.example", "environment": "Production"}})
+	_, err = verifier.VerifyAndDecodeNotification(signed)
+	assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+}
+
+func TestXcodeSignedDataIsVerified(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createXcodeTestSignedDataVerifier()
+	assert.NoError(err, "Failed to create verifier")
+	xcodeCert, err := readTestData("xcode/StoreKitTestCertificate.cer")
+	assert.NoError(err, "Failed to read test data")
+
+	// Claim Xcode's certificate, but sign with another key
+	forgeryKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err, "Failed to generate key")
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"bundleId":    XCODE_BUNDLE_ID,
+		"environment": "Xcode",
+		"signedDate":  1697679936056,
+	})
+	token.Header["x5c"] = []string{base64.StdEncoding.EncodeToString(xcodeCert)}
+	forged, err := token.SignedString(forgeryKey)
+	assert.NoError(err, "Failed to sign payload")
+	_, err = verifier.VerifyAndDecodeSignedTransaction(forged)
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+
+	encodedTransaction, err := readTestDataString("xcode/xcode-signed-transaction")
+	assert.NoError(err, "Failed to read test data")
+	validationTime, err := verifier.VerifyAndDecodeWithValidationTime(encodedTransaction, &JWSTransactionDecodedPayload{})
+	assert.NoError(err, "Xcode signed data verifies against Xcode's certificate")
+	assert.Equal(SIGNING_TIME_SOURCE_SIGNED_DATE, validationTime.SigningTimeSource, "Validated at the signing time")
+
+	unverified, err := NewSignedDataVerifierWithOptions(nil,
+		WithEnvironments(ENVIRONMENT_XCODE),
+		WithBundleID(XCODE_BUNDLE_ID),
+		WithUnverifiedLocalTesting(),
+	)
+	assert.NoError(err, "Failed to create verifier")
+	_, err = unverified.VerifyAndDecodeSignedTransaction(forged)
+	assert.NoError(err, "Unverified local testing accepts any signature")
+}
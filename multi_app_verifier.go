@@ -0,0 +1,140 @@
+package appstore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AppIdentity identifies an app, and the environment, that signed data is accepted for.
+type AppIdentity struct {
+	BundleID string
+
+	// The App Apple ID. Required when the environment is Production.
+	AppAppleID int64
+
+	Environment Environment
+}
+
+// MultiAppSignedDataVerifier verifies App Store signed data for several apps behind a single endpoint.
+// Each payload's signature is verified once, with a certificate chain cache shared by all identities,
+// and the payload is then matched against the allowed identities in the order they were given.
+type MultiAppSignedDataVerifier struct {
+	decoder    *SignedDataVerifier
+	identities []AppIdentity
+	verifiers  []*SignedDataVerifier
+}
+
+// NewMultiAppSignedDataVerifier creates a verifier that accepts signed data for any of the given identities.
+// The options configure online checks, clock, OCSP and caching; environment, bundle ID and App Apple ID options are
+// replaced by the identities.
+//
+// Signed data is verified against the root certificates, or, when the identities are in the Xcode or LocalTesting
+// environment, as WithLocalTestCertificates or WithUnverifiedLocalTesting decides. Identities in those environments
+// can't be combined with identities in other environments.
+func NewMultiAppSignedDataVerifier(rootCertificates [][]byte, identities []AppIdentity, opts ...SignedDataVerifierOption) (*MultiAppSignedDataVerifier, error) {
+	if len(identities) == 0 {
+		return nil, errors.New("at least one app identity is required")
+	}
+
+	decodeIdentity := identities[0]
+	for _, identity := range identities {
+		if identity.Environment == ENVIRONMENT_PRODUCTION && identity.AppAppleID == 0 {
+			return nil, fmt.Errorf("appAppleId is required for %s in the Production environment", identity.BundleID)
+		}
+		// Signatures are verified once, on either the local or the Apple path
+		if isLocalEnvironment(identity.Environment) != isLocalEnvironment(decodeIdentity.Environment) {
+			return nil, errors.New("identities in the Xcode and LocalTesting environments must not be combined with identities in other environments")
+		}
+	}
+
+	opts = append(opts[:len(opts):len(opts)],
+		WithEnvironments(decodeIdentity.Environment),
+		WithBundleID(decodeIdentity.BundleID),
+		WithAppAppleID(decodeIdentity.AppAppleID),
+	)
+	decoder, err := NewSignedDataVerifierWithOptions(rootCertificates, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	verifiers := make([]*SignedDataVerifier, len(identities))
+	for i, identity := range identities {
+		verifier := *decoder
+		verifier.environment = identity.Environment
+		verifier.environments = []Environment{identity.Environment}
+		verifier.bundleID = identity.BundleID
+		verifier.appAppleID = identity.AppAppleID
+		verifiers[i] = &verifier
+	}
+
+	return &MultiAppSignedDataVerifier{
+		decoder:    decoder,
+		identities: append([]AppIdentity(nil), identities...),
+		verifiers:  verifiers,
+	}, nil
+}
+
+// VerifyAndDecodeNotification verifies and decodes an App Store Server Notification signedPayload,
+// and returns the identity of the app it was sent for.
+//
+// See https://developer.apple.com/documentation/appstoreservernotifications/signedpayload
+func (m *MultiAppSignedDataVerifier) VerifyAndDecodeNotification(signedPayload string) (*ResponseBodyV2DecodedPayload, AppIdentity, error) {
+	return verifyAndMatch[ResponseBodyV2DecodedPayload](m, signedPayload)
+}
+
+// VerifyAndDecodeSignedTransaction verifies and decodes a signedTransaction, and returns the identity of the app it belongs to.
+//
+// See https://developer.apple.com/documentation/appstoreserverapi/jwstransaction
+func (m *MultiAppSignedDataVerifier) VerifyAndDecodeSignedTransaction(signedTransaction string) (*JWSTransactionDecodedPayload, AppIdentity, error) {
+	return verifyAndMatch[JWSTransactionDecodedPayload](m, signedTransaction)
+}
+
+// VerifyAndDecodeRenewalInfo verifies and decodes a signedRenewalInfo.
+// Renewal info doesn't carry a bundle ID, so the returned identity is the first one whose environment matches.
+//
+// See https://developer.apple.com/documentation/appstoreserverapi/jwsrenewalinfo
+func (m *MultiAppSignedDataVerifier) VerifyAndDecodeRenewalInfo(signedRenewalInfo string) (*JWSRenewalInfoDecodedPayload, AppIdentity, error) {
+	return verifyAndMatch[JWSRenewalInfoDecodedPayload](m, signedRenewalInfo)
+}
+
+// VerifyAndDecodeAppTransaction verifies and decodes a signed AppTransaction, and returns the identity of the app it belongs to.
+//
+// See https://developer.apple.com/documentation/storekit/apptransaction
+func (m *MultiAppSignedDataVerifier) VerifyAndDecodeAppTransaction(signedAppTransaction string) (*AppTransaction, AppIdentity, error) {
+	return verifyAndMatch[AppTransaction](m, signedAppTransaction)
+}
+
+// VerifyAndDecodeRealtimeRequest verifies and decodes a Retention Messaging API signedPayload.
+// Realtime requests don't carry a bundle ID, so outside Production the returned identity is the first one whose environment matches.
+//
+// See https://developer.apple.com/documentation/retentionmessaging/signedpayload
+func (m *MultiAppSignedDataVerifier) VerifyAndDecodeRealtimeRequest(signedPayload string) (*DecodedRealtimeRequestBody, AppIdentity, error) {
+	return verifyAndMatch[DecodedRealtimeRequestBody](m, signedPayload)
+}
+
+// verifyAndMatch decodes the signed object once and returns the first identity whose checks pass.
+// When no identity matches, an environment mismatch is reported in preference to an app identifier mismatch,
+// because it means the app itself was recognized.
+func verifyAndMatch[T any](m *MultiAppSignedDataVerifier, signedObj string) (*T, AppIdentity, error) {
+	payload := new(T)
+	if _, err := m.decoder.decodeSignedObject(signedObj, payload, nil); err != nil {
+		return nil, AppIdentity{}, err
+	}
+
+	var mismatch error
+	for i, verifier := range m.verifiers {
+		err := verifier.verifyDecoded(payload, nil)
+		if err == nil {
+			return payload, m.identities[i], nil
+		}
+		var vErr *VerificationException
+		if !errors.As(err, &vErr) || (vErr.Status != INVALID_ENVIRONMENT && vErr.Status != INVALID_APP_IDENTIFIER) {
+			// The payload belongs to this identity but failed a later check, such as freshness or replay
+			return nil, AppIdentity{}, err
+		}
+		if mismatch == nil || vErr.Status == INVALID_ENVIRONMENT {
+			mismatch = err
+		}
+	}
+	return nil, AppIdentity{}, mismatch
+}
@@ -0,0 +1,93 @@
+package appstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestMultiAppSignedDataVerifier(identities ...AppIdentity) (*MultiAppSignedDataVerifier, error) {
+	testCA, err := readTestData("certs/testCA.der")
+	if err != nil {
+		return nil, err
+	}
+	// Test data is signed with a throwaway key
+	return NewMultiAppSignedDataVerifier([][]byte{testCA}, identities, WithUnverifiedLocalTesting())
+}
+
+var testMultiAppIdentities = []AppIdentity{
+	{BundleID: "com.example.ios", Environment: ENVIRONMENT_LOCAL_TESTING},
+	{BundleID: "com.example", Environment: ENVIRONMENT_LOCAL_TESTING},
+	{BundleID: "com.example.macos", Environment: ENVIRONMENT_SANDBOX},
+}
+
+func TestMultiAppVerifier_MatchesTransaction(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createTestMultiAppSignedDataVerifier(testMultiAppIdentities[:2]...)
+	assert.NoError(err, "Failed to create verifier")
+
+	signedTransaction, err := createSignedDataFromJSON("models/signedTransaction.json")
+	assert.NoError(err, "Failed to create signed data")
+
+	transaction, identity, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	assert.NoError(err, "Failed to verify transaction")
+	assert.Equal("com.example", transaction.BundleId, "BundleId")
+	assert.Equal(testMultiAppIdentities[1], identity, "Identity")
+}
+
+func TestMultiAppVerifier_MatchesNotification(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createTestMultiAppSignedDataVerifier(testMultiAppIdentities[:2]...)
+	assert.NoError(err, "Failed to create verifier")
+
+	signedNotification, err := createSignedDataFromJSONWithOverrides("models/signedNotification.json", map[string]any{
+		"data": map[string]any{"environment": "LocalTesting", "bundleId": "com.example.ios"},
+	})
+	assert.NoError(err, "Failed to create signed data")
+
+	notification, identity, err := verifier.VerifyAndDecodeNotification(signedNotification)
+	assert.NoError(err, "Failed to verify notification")
+	assert.Equal(NOTIFICATION_TYPE_SUBSCRIBED, notification.NotificationType, "NotificationType")
+	assert.Equal(testMultiAppIdentities[0], identity, "Identity")
+}
+
+func TestMultiAppVerifier_NoMatch(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createTestMultiAppSignedDataVerifier(testMultiAppIdentities[:2]...)
+	assert.NoError(err, "Failed to create verifier")
+
+	signedTransaction, err := createSignedDataFromJSONWithOverrides("models/signedTransaction.json", map[string]any{"bundleId": "com.unknown"})
+	assert.NoError(err, "Failed to create signed data")
+	_, identity, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	assertVerificationStatus(t, INVALID_APP_IDENTIFIER, err)
+	assert.Equal(AppIdentity{}, identity, "Identity")
+
+	signedTransaction, err = createSignedDataFromJSONWithOverrides("models/signedTransaction.json", map[string]any{"environment": "Sandbox"})
+	assert.NoError(err, "Failed to create signed data")
+	_, _, err = verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+}
+
+func TestMultiAppVerifier_SharesChainVerifier(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createTestMultiAppSignedDataVerifier(testMultiAppIdentities[:2]...)
+	assert.NoError(err, "Failed to create verifier")
+
+	for _, v := range verifier.verifiers {
+		assert.Same(verifier.decoder.chainVerifier, v.chainVerifier, "Chain verifier is shared")
+	}
+}
+
+func TestNewMultiAppVerifier_Errors(t *testing.T) {
+	assert := assert.New(t)
+	_, err := createTestMultiAppSignedDataVerifier()
+	assert.Error(err, "Expected error without identities")
+
+	_, err = createTestMultiAppSignedDataVerifier(AppIdentity{BundleID: "com.example", Environment: ENVIRONMENT_PRODUCTION})
+	assert.Error(err, "Expected error for Production identity without appAppleId")
+
+	_, err = createTestMultiAppSignedDataVerifier(testMultiAppIdentities...)
+	assert.Error(err, "Expected error for local and non-local identities")
+	_, err = createTestMultiAppSignedDataVerifier(testMultiAppIdentities[2], testMultiAppIdentities[0])
+	assert.Error(err, "Expected error for non-local and local identities")
+}
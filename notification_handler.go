@@ -0,0 +1,144 @@
+package appstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultMaxNotificationBodyBytes is the largest request body a NotificationHandler reads by default.
+const DefaultMaxNotificationBodyBytes = 1 << 20
+
+// NotificationCallback handles a verified notification. If it returns an error the App Store sends the notification
+// again later, unless the error is marked with PermanentNotificationError.
+type NotificationCallback func(ctx context.Context, notification *ResponseBodyV2DecodedPayload) error
+
+// PermanentNotificationError is an error from a NotificationCallback for a notification that will never be handled,
+// so there is no point in the App Store sending it again.
+type PermanentNotificationError struct {
+	Err error
+}
+
+func (e *PermanentNotificationError) Error() string {
+	return fmt.Sprintf("permanent notification error: %v", e.Err)
+}
+
+func (e *PermanentNotificationError) Unwrap() error {
+	return e.Err
+}
+
+// NotificationHandlerOption configures a NotificationHandler.
+type NotificationHandlerOption func(*NotificationHandler)
+
+// WithMaxNotificationBodyBytes sets the largest request body the handler reads. Larger requests fail with 413.
+func WithMaxNotificationBodyBytes(n int64) NotificationHandlerOption {
+	return func(h *NotificationHandler) {
+		h.maxBodyBytes = n
+	}
+}
+
+// WithNotificationErrorHandler sets a function that is called with every request the handler rejects and the reason,
+// for logging.
+func WithNotificationErrorHandler(onError func(r *http.Request, status int, err error)) NotificationHandlerOption {
+	return func(h *NotificationHandler) {
+		h.onError = onError
+	}
+}
+
+// NotificationHandler is an http.Handler that receives App Store Server Notifications V2. It verifies each
+// notification, passes it to a callback, and answers the App Store so it only sends the notification again
+// when that could succeed:
+//
+//   - 200 when the callback succeeds.
+//   - 503 when verification fails with RETRYABLE_VERIFICATION_FAILURE, and 500 when the callback fails.
+//   - 400 when the body or the notification is invalid or verification fails for any other reason, 413 when
+//     the body is too large, and 422 when the callback fails with a *PermanentNotificationError.
+//
+// The App Store resends a notification with the same notificationUUID until the callback succeeds. A verifier
+// with a replay store would record the notification as seen before the callback runs and reject the resent
+// notification, so NewNotificationHandler doesn't accept one. Wrap the callback with IdempotentNotificationCallback
+// to handle each notification once.
+type NotificationHandler struct {
+	verifier     *SignedDataVerifier
+	callback     NotificationCallback
+	maxBodyBytes int64
+	onError      func(r *http.Request, status int, err error)
+}
+
+// NewNotificationHandler creates a handler that verifies notifications with verifier and passes them to callback.
+// It returns an error if verifier has a replay store.
+func NewNotificationHandler(verifier *SignedDataVerifier, callback NotificationCallback, opts ...NotificationHandlerOption) (*NotificationHandler, error) {
+	if verifier == nil || callback == nil {
+		return nil, errors.New("verifier and callback are required")
+	}
+	if verifier.replayStore != nil {
+		return nil, errors.New("verifier must not have a replay store, because notifications whose callback failed are sent again; use IdempotentNotificationCallback")
+	}
+	h := &NotificationHandler{
+		verifier:     verifier,
+		callback:     callback,
+		maxBodyBytes: DefaultMaxNotificationBodyBytes,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.maxBodyBytes <= 0 {
+		return nil, errors.New("max body bytes must be positive")
+	}
+	return h, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (h *NotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status, err := h.handle(w, r)
+	if err != nil && h.onError != nil {
+		h.onError(r, status, err)
+	}
+	if status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", http.MethodPost)
+	}
+	w.WriteHeader(status)
+}
+
+func (h *NotificationHandler) handle(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodPost {
+		return http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return http.StatusRequestEntityTooLarge, err
+		}
+		return http.StatusBadRequest, fmt.Errorf("failed to read body: %w", err)
+	}
+	var request ResponseBodyV2
+	if err := json.Unmarshal(body, &request); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid body: %w", err)
+	}
+	if request.SignedPayload == "" {
+		return http.StatusBadRequest, errors.New("signedPayload is missing")
+	}
+
+	notification, err := h.verifier.VerifyAndDecodeNotification(request.SignedPayload)
+	if err != nil {
+		var vErr *VerificationException
+		if errors.As(err, &vErr) && vErr.Status == RETRYABLE_VERIFICATION_FAILURE {
+			return http.StatusServiceUnavailable, err
+		}
+		return http.StatusBadRequest, err
+	}
+
+	if err := h.callback(r.Context(), notification); err != nil {
+		var permanentErr *PermanentNotificationError
+		if errors.As(err, &permanentErr) {
+			return http.StatusUnprocessableEntity, err
+		}
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
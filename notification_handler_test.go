@@ -0,0 +1,132 @@
+package appstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func postNotification(handler http.Handler, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/notifications", strings.NewReader(body)))
+	return recorder
+}
+
+func createTestHandlerNotification(t *testing.T, pki *testPKI) string {
+	t.Helper()
+	signed := createTestSignedPayload(t, pki, jwt.MapClaims{
+		"notificationType": "TEST",
+		"notificationUUID": "002e14d5-51f5-4503-b5a8-c3a1af68eb20",
+		"data":             map[string]any{"environment": "Sandbox", "bundleId": "com.example"},
+	})
+	return `{"signedPayload":"` + signed + `"}`
+}
+
+func TestNotificationHandler(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	responder := newTestOCSPResponder(t, pki)
+	verifier := createTestReportVerifier(t, pki, WithOCSPFetcher(responder))
+	body := createTestHandlerNotification(t, pki)
+
+	var received *ResponseBodyV2DecodedPayload
+	var callbackErr error
+	var rejected []int
+	handler, err := NewNotificationHandler(verifier, func(ctx context.Context, notification *ResponseBodyV2DecodedPayload) error {
+		received = notification
+		return callbackErr
+	}, WithNotificationErrorHandler(func(r *http.Request, status int, err error) {
+		rejected = append(rejected, status)
+	}))
+	assert.NoError(err, "Failed to create handler")
+
+	assert.Equal(http.StatusOK, postNotification(handler, body).Code, "Handled notification")
+	if assert.NotNil(received, "Callback called") {
+		assert.Equal(NOTIFICATION_TYPE_TEST, received.NotificationType, "NotificationType")
+	}
+	assert.Empty(rejected, "No error reported")
+
+	callbackErr = errors.New("database unavailable")
+	assert.Equal(http.StatusInternalServerError, postNotification(handler, body).Code, "Callback errors are retried")
+	callbackErr = &PermanentNotificationError{Err: errors.New("unknown account")}
+	assert.Equal(http.StatusUnprocessableEntity, postNotification(handler, body).Code, "Permanent callback errors aren't retried")
+	callbackErr = nil
+
+	received = nil
+	other := createTestPKI(t)
+	assert.Equal(http.StatusBadRequest, postNotification(handler, createTestHandlerNotification(t, other)).Code, "Verification failure")
+	assert.Nil(received, "Callback not called for invalid notifications")
+	assert.Equal([]int{500, 422, 400}, rejected, "Rejected requests reported")
+
+	unavailable := newTestOCSPResponder(t, pki)
+	unavailable.err = errors.New("connection refused")
+	handler, err = NewNotificationHandler(createTestReportVerifier(t, pki, WithOCSPFetcher(unavailable)), func(ctx context.Context, notification *ResponseBodyV2DecodedPayload) error {
+		received = notification
+		return nil
+	})
+	assert.NoError(err, "Failed to create handler")
+	assert.Equal(http.StatusServiceUnavailable, postNotification(handler, body).Code, "Retryable verification failure")
+	assert.Nil(received, "Callback not called")
+}
+
+func TestNotificationHandlerProcessesRetriesOfFailedNotifications(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki, WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED))
+	body := createTestHandlerNotification(t, pki)
+	store, err := NewMemoryIdempotencyStore(time.Minute, time.Hour)
+	assert.NoError(err, "Failed to create store")
+
+	calls := 0
+	callbackErr := errors.New("database unavailable")
+	handler, err := NewNotificationHandler(verifier, IdempotentNotificationCallback(store, func(ctx context.Context, notification *ResponseBodyV2DecodedPayload) error {
+		calls++
+		return callbackErr
+	}))
+	assert.NoError(err, "Failed to create handler")
+
+	assert.Equal(http.StatusInternalServerError, postNotification(handler, body).Code, "Failed delivery")
+	callbackErr = nil
+	assert.Equal(http.StatusOK, postNotification(handler, body).Code, "Retry is processed")
+	assert.Equal(http.StatusOK, postNotification(handler, body).Code, "Duplicate is acknowledged")
+	assert.Equal(2, calls, "Callback called for the failed delivery and the retry")
+
+	_, err = NewNotificationHandler(createTestReportVerifier(t, pki, WithReplayStore(NewMemoryReplayStore(time.Hour))), func(ctx context.Context, notification *ResponseBodyV2DecodedPayload) error { return nil })
+	assert.Error(err, "Verifiers with a replay store are rejected")
+}
+
+func TestNotificationHandlerRejectsInvalidRequests(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki, WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED))
+	called := false
+	handler, err := NewNotificationHandler(verifier, func(ctx context.Context, notification *ResponseBodyV2DecodedPayload) error {
+		called = true
+		return nil
+	}, WithMaxNotificationBodyBytes(64))
+	assert.NoError(err, "Failed to create handler")
+
+	assert.Equal(http.StatusRequestEntityTooLarge, postNotification(handler, createTestHandlerNotification(t, pki)).Code, "Body too large")
+	assert.Equal(http.StatusBadRequest, postNotification(handler, "not json").Code, "Invalid body")
+	assert.Equal(http.StatusBadRequest, postNotification(handler, "{}").Code, "Missing signedPayload")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/notifications", nil))
+	assert.Equal(http.StatusMethodNotAllowed, recorder.Code, "GET")
+	assert.Equal(http.MethodPost, recorder.Header().Get("Allow"), "Allow header")
+	assert.False(called, "Callback not called")
+
+	_, err = NewNotificationHandler(nil, func(ctx context.Context, notification *ResponseBodyV2DecodedPayload) error { return nil })
+	assert.Error(err, "Verifier is required")
+	_, err = NewNotificationHandler(verifier, nil)
+	assert.Error(err, "Callback is required")
+	_, err = NewNotificationHandler(verifier, func(ctx context.Context, notification *ResponseBodyV2DecodedPayload) error { return nil }, WithMaxNotificationBodyBytes(0))
+	assert.Error(err, "Body limit must be positive")
+}
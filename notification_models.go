@@ -1,5 +1,17 @@
 package appstore
 
+import "encoding/json"
+
+// ResponseBodyV2 is the body of the request the App Store sends to your server with a version 2 notification.
+//
+// https://developer.apple.com/documentation/appstoreservernotifications/responsebodyv2
+type ResponseBodyV2 struct {
+	// A cryptographically signed payload, in JSON Web Signature (JWS) format, containing the response body for a version 2 notification.
+	//
+	// https://developer.apple.com/documentation/appstoreservernotifications/signedpayload
+	SignedPayload string `json:"signedPayload,omitempty"`
+}
+
 // ResponseBodyV2DecodedPayload is a decoded payload containing the version 2 notification data.
 //
 // https://developer.apple.com/documentation/appstoreservernotifications/responsebodyv2decodedpayload
@@ -48,6 +60,21 @@ type ResponseBodyV2DecodedPayload struct {
 	//
 	// https://developer.apple.com/documentation/appstoreservernotifications/appdata
 	AppData *AppData `json:"appData,omitempty"`
+
+	// Properties of the payload that this library doesn't model yet, keyed by their JSON name.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes the payload, keeping unrecognized properties in Extra.
+func (p *ResponseBodyV2DecodedPayload) UnmarshalJSON(data []byte) error {
+	type plain ResponseBodyV2DecodedPayload
+	return unmarshalWithExtra(data, (*plain)(p), &p.Extra)
+}
+
+// MarshalJSON encodes the payload, including the properties in Extra.
+func (p ResponseBodyV2DecodedPayload) MarshalJSON() ([]byte, error) {
+	type plain ResponseBodyV2DecodedPayload
+	return marshalWithExtra(plain(p), p.Extra)
 }
 
 // Data is the app metadata and the signed renewal and transaction information.
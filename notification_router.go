@@ -0,0 +1,334 @@
+package appstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ANY_SUBTYPE registers a handler for every subtype of a notification type, including no subtype.
+// It is only used to register handlers; notifications never carry it.
+const ANY_SUBTYPE Subtype = "*"
+
+// NotificationRoute is a combination of notification type and subtype. An empty Subtype is a notification without one.
+type NotificationRoute struct {
+	Type    NotificationTypeV2
+	Subtype Subtype
+}
+
+func (r NotificationRoute) String() string {
+	if r.Subtype == "" {
+		return string(r.Type)
+	}
+	return string(r.Type) + "/" + string(r.Subtype)
+}
+
+// notificationContent is the part of a notification that carries its details.
+type notificationContent int
+
+const (
+	// notificationContentAny is for handlers that accept any notification.
+	notificationContentAny notificationContent = iota
+	notificationContentData
+	notificationContentTransaction
+	notificationContentSummary
+	notificationContentExternalPurchaseToken
+	notificationContentAppData
+)
+
+func (c notificationContent) String() string {
+	switch c {
+	case notificationContentTransaction:
+		return "transaction"
+	case notificationContentSummary:
+		return "summary"
+	case notificationContentExternalPurchaseToken:
+		return "external purchase token"
+	case notificationContentAppData:
+		return "app data"
+	default:
+		return "data"
+	}
+}
+
+// knownNotificationRoutes lists the combinations of notification type and subtype the App Store sends.
+//
+// https://developer.apple.com/documentation/appstoreservernotifications/notificationtype
+var knownNotificationRoutes = map[NotificationRoute]notificationContent{
+	{NOTIFICATION_TYPE_SUBSCRIBED, SUBTYPE_INITIAL_BUY}:                          notificationContentTransaction,
+	{NOTIFICATION_TYPE_SUBSCRIBED, SUBTYPE_RESUBSCRIBE}:                          notificationContentTransaction,
+	{NOTIFICATION_TYPE_DID_CHANGE_RENEWAL_PREF, ""}:                              notificationContentTransaction,
+	{NOTIFICATION_TYPE_DID_CHANGE_RENEWAL_PREF, SUBTYPE_UPGRADE}:                 notificationContentTransaction,
+	{NOTIFICATION_TYPE_DID_CHANGE_RENEWAL_PREF, SUBTYPE_DOWNGRADE}:               notificationContentTransaction,
+	{NOTIFICATION_TYPE_DID_CHANGE_RENEWAL_STATUS, SUBTYPE_AUTO_RENEW_ENABLED}:    notificationContentTransaction,
+	{NOTIFICATION_TYPE_DID_CHANGE_RENEWAL_STATUS, SUBTYPE_AUTO_RENEW_DISABLED}:   notificationContentTransaction,
+	{NOTIFICATION_TYPE_OFFER_REDEEMED, ""}:                                       notificationContentTransaction,
+	{NOTIFICATION_TYPE_OFFER_REDEEMED, SUBTYPE_INITIAL_BUY}:                      notificationContentTransaction,
+	{NOTIFICATION_TYPE_OFFER_REDEEMED, SUBTYPE_RESUBSCRIBE}:                      notificationContentTransaction,
+	{NOTIFICATION_TYPE_OFFER_REDEEMED, SUBTYPE_UPGRADE}:                          notificationContentTransaction,
+	{NOTIFICATION_TYPE_OFFER_REDEEMED, SUBTYPE_DOWNGRADE}:                        notificationContentTransaction,
+	{NOTIFICATION_TYPE_DID_RENEW, ""}:                                            notificationContentTransaction,
+	{NOTIFICATION_TYPE_DID_RENEW, SUBTYPE_BILLING_RECOVERY}:                      notificationContentTransaction,
+	{NOTIFICATION_TYPE_EXPIRED, SUBTYPE_VOLUNTARY}:                               notificationContentTransaction,
+	{NOTIFICATION_TYPE_EXPIRED, SUBTYPE_BILLING_RETRY}:                           notificationContentTransaction,
+	{NOTIFICATION_TYPE_EXPIRED, SUBTYPE_PRICE_INCREASE}:                          notificationContentTransaction,
+	{NOTIFICATION_TYPE_EXPIRED, SUBTYPE_PRODUCT_NOT_FOR_SALE}:                    notificationContentTransaction,
+	{NOTIFICATION_TYPE_DID_FAIL_TO_RENEW, ""}:                                    notificationContentTransaction,
+	{NOTIFICATION_TYPE_DID_FAIL_TO_RENEW, SUBTYPE_GRACE_PERIOD}:                  notificationContentTransaction,
+	{NOTIFICATION_TYPE_GRACE_PERIOD_EXPIRED, ""}:                                 notificationContentTransaction,
+	{NOTIFICATION_TYPE_PRICE_INCREASE, SUBTYPE_PENDING}:                          notificationContentTransaction,
+	{NOTIFICATION_TYPE_PRICE_INCREASE, SUBTYPE_ACCEPTED}:                         notificationContentTransaction,
+	{NOTIFICATION_TYPE_REFUND, ""}:                                               notificationContentTransaction,
+	{NOTIFICATION_TYPE_REFUND_DECLINED, ""}:                                      notificationContentTransaction,
+	{NOTIFICATION_TYPE_REFUND_REVERSED, ""}:                                      notificationContentTransaction,
+	{NOTIFICATION_TYPE_CONSUMPTION_REQUEST, ""}:                                  notificationContentTransaction,
+	{NOTIFICATION_TYPE_RENEWAL_EXTENDED, ""}:                                     notificationContentTransaction,
+	{NOTIFICATION_TYPE_RENEWAL_EXTENSION, SUBTYPE_SUMMARY}:                       notificationContentSummary,
+	{NOTIFICATION_TYPE_RENEWAL_EXTENSION, SUBTYPE_FAILURE}:                       notificationContentTransaction,
+	{NOTIFICATION_TYPE_REVOKE, ""}:                                               notificationContentTransaction,
+	{NOTIFICATION_TYPE_ONE_TIME_CHARGE, ""}:                                      notificationContentTransaction,
+	{NOTIFICATION_TYPE_EXTERNAL_PURCHASE_TOKEN_NOTIFICATION, SUBTYPE_UNREPORTED}: notificationContentExternalPurchaseToken,
+	{NOTIFICATION_TYPE_RESCIND_CONSENT, ""}:                                      notificationContentAppData,
+	{NOTIFICATION_TYPE_TEST, ""}:                                                 notificationContentData,
+}
+
+// KnownNotificationRoutes returns the combinations of notification type and subtype the App Store sends, sorted.
+func KnownNotificationRoutes() []NotificationRoute {
+	routes := make([]NotificationRoute, 0, len(knownNotificationRoutes))
+	for route := range knownNotificationRoutes {
+		routes = append(routes, route)
+	}
+	slices.SortFunc(routes, func(a, b NotificationRoute) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return routes
+}
+
+// DecodedNotificationHandler handles a notification whose nested signed objects have been verified and decoded.
+type DecodedNotificationHandler func(ctx context.Context, notification *DecodedNotification) error
+
+// TransactionNotificationHandler handles a notification about a transaction. The renewal info is nil for purchases
+// other than auto-renewable subscriptions.
+type TransactionNotificationHandler func(ctx context.Context, notification *ResponseBodyV2DecodedPayload, transaction *JWSTransactionDecodedPayload, renewalInfo *JWSRenewalInfoDecodedPayload) error
+
+// SummaryNotificationHandler handles a notification with the summary of a renewal date extension request.
+type SummaryNotificationHandler func(ctx context.Context, notification *ResponseBodyV2DecodedPayload, summary *Summary) error
+
+// ExternalPurchaseTokenNotificationHandler handles a notification about an external purchase token.
+type ExternalPurchaseTokenNotificationHandler func(ctx context.Context, notification *ResponseBodyV2DecodedPayload, token *ExternalPurchaseToken) error
+
+// AppDataNotificationHandler handles a notification about an app rather than a purchase. The app transaction is nil
+// if the notification doesn't carry one.
+type AppDataNotificationHandler func(ctx context.Context, notification *ResponseBodyV2DecodedPayload, appData *AppData, appTransaction *AppTransaction) error
+
+// NotificationRouter passes each notification to the handler registered for its type and subtype, with its nested
+// signed objects verified and decoded. Handlers are matched in this order:
+//
+//  1. The handler for the notification's exact type and subtype. A notification without a subtype only matches
+//     a handler registered without one.
+//  2. The handler for its type with ANY_SUBTYPE.
+//  3. The unknown handler, if the library doesn't know the combination of type and subtype.
+//  4. The default handler.
+//
+// Notifications no handler matches fail with a *PermanentNotificationError. Register every handler before
+// routing notifications; the router isn't safe for concurrent registration.
+type NotificationRouter struct {
+	verifier       *SignedDataVerifier
+	routes         map[NotificationRoute]DecodedNotificationHandler
+	defaultHandler DecodedNotificationHandler
+	unknownHandler DecodedNotificationHandler
+	errs           []error
+}
+
+// NewNotificationRouter creates a router that verifies nested signed objects with verifier.
+func NewNotificationRouter(verifier *SignedDataVerifier) (*NotificationRouter, error) {
+	if verifier == nil {
+		return nil, errors.New("verifier is required")
+	}
+	return &NotificationRouter{
+		verifier: verifier,
+		routes:   make(map[NotificationRoute]DecodedNotificationHandler),
+	}, nil
+}
+
+// Handle registers a handler for a notification type and subtype, which may be ANY_SUBTYPE or empty for no subtype.
+// Unlike the typed Handle methods, it accepts combinations the library doesn't know yet.
+func (r *NotificationRouter) Handle(notificationType NotificationTypeV2, subtype Subtype, handler DecodedNotificationHandler) {
+	r.register(NotificationRoute{Type: notificationType, Subtype: subtype}, notificationContentAny, handler)
+}
+
+// HandleTransaction registers a handler for notifications about a transaction, such as DID_RENEW.
+func (r *NotificationRouter) HandleTransaction(notificationType NotificationTypeV2, subtype Subtype, handler TransactionNotificationHandler) {
+	route := NotificationRoute{Type: notificationType, Subtype: subtype}
+	if handler == nil {
+		r.register(route, notificationContentTransaction, nil)
+		return
+	}
+	r.register(route, notificationContentTransaction, func(ctx context.Context, n *DecodedNotification) error {
+		if n.Transaction == nil {
+			return &PermanentNotificationError{Err: fmt.Errorf("%s notification has no signedTransactionInfo", routeOf(n.Notification))}
+		}
+		return handler(ctx, n.Notification, n.Transaction, n.RenewalInfo)
+	})
+}
+
+// HandleSummary registers a handler for notifications with a summary, such as RENEWAL_EXTENSION with SUBTYPE_SUMMARY.
+func (r *NotificationRouter) HandleSummary(notificationType NotificationTypeV2, subtype Subtype, handler SummaryNotificationHandler) {
+	route := NotificationRoute{Type: notificationType, Subtype: subtype}
+	if handler == nil {
+		r.register(route, notificationContentSummary, nil)
+		return
+	}
+	r.register(route, notificationContentSummary, func(ctx context.Context, n *DecodedNotification) error {
+		if n.Notification.Summary == nil {
+			return &PermanentNotificationError{Err: fmt.Errorf("%s notification has no summary", routeOf(n.Notification))}
+		}
+		return handler(ctx, n.Notification, n.Notification.Summary)
+	})
+}
+
+// HandleExternalPurchaseToken registers a handler for EXTERNAL_PURCHASE_TOKEN notifications.
+func (r *NotificationRouter) HandleExternalPurchaseToken(notificationType NotificationTypeV2, subtype Subtype, handler ExternalPurchaseTokenNotificationHandler) {
+	route := NotificationRoute{Type: notificationType, Subtype: subtype}
+	if handler == nil {
+		r.register(route, notificationContentExternalPurchaseToken, nil)
+		return
+	}
+	r.register(route, notificationContentExternalPurchaseToken, func(ctx context.Context, n *DecodedNotification) error {
+		if n.Notification.ExternalPurchaseToken == nil {
+			return &PermanentNotificationError{Err: fmt.Errorf("%s notification has no externalPurchaseToken", routeOf(n.Notification))}
+		}
+		return handler(ctx, n.Notification, n.Notification.ExternalPurchaseToken)
+	})
+}
+
+// HandleAppData registers a handler for notifications about an app, such as RESCIND_CONSENT.
+func (r *NotificationRouter) HandleAppData(notificationType NotificationTypeV2, subtype Subtype, handler AppDataNotificationHandler) {
+	route := NotificationRoute{Type: notificationType, Subtype: subtype}
+	if handler == nil {
+		r.register(route, notificationContentAppData, nil)
+		return
+	}
+	r.register(route, notificationContentAppData, func(ctx context.Context, n *DecodedNotification) error {
+		if n.Notification.AppData == nil {
+			return &PermanentNotificationError{Err: fmt.Errorf("%s notification has no appData", routeOf(n.Notification))}
+		}
+		return handler(ctx, n.Notification, n.Notification.AppData, n.AppTransaction)
+	})
+}
+
+// HandleDefault registers the handler for notifications no other handler matches.
+func (r *NotificationRouter) HandleDefault(handler DecodedNotificationHandler) {
+	if handler == nil {
+		r.errs = append(r.errs, errors.New("default handler is nil"))
+		return
+	}
+	r.defaultHandler = handler
+}
+
+// HandleUnknown registers the handler for combinations of type and subtype the library doesn't know,
+// such as types Apple added after this version of the library.
+func (r *NotificationRouter) HandleUnknown(handler DecodedNotificationHandler) {
+	if handler == nil {
+		r.errs = append(r.errs, errors.New("unknown handler is nil"))
+		return
+	}
+	r.unknownHandler = handler
+}
+
+// register adds a handler for route. Unless content is notificationContentAny, every known combination the route
+// matches must carry it.
+// Mistakes are reported by CheckCoverage.
+func (r *NotificationRouter) register(route NotificationRoute, content notificationContent, handler DecodedNotificationHandler) {
+	if handler == nil {
+		r.errs = append(r.errs, fmt.Errorf("handler for %s is nil", route))
+		return
+	}
+	if _, ok := r.routes[route]; ok {
+		r.errs = append(r.errs, fmt.Errorf("duplicate handler for %s", route))
+		return
+	}
+	if content != notificationContentAny {
+		matched := false
+		for known, knownContent := range knownNotificationRoutes {
+			if known.Type != route.Type || (route.Subtype != ANY_SUBTYPE && known.Subtype != route.Subtype) {
+				continue
+			}
+			matched = true
+			if knownContent != content {
+				r.errs = append(r.errs, fmt.Errorf("%s notifications carry %s, not %s", known, knownContent, content))
+				return
+			}
+		}
+		if !matched {
+			r.errs = append(r.errs, fmt.Errorf("unknown notification %s", route))
+			return
+		}
+	}
+	r.routes[route] = handler
+}
+
+// CheckCoverage returns an error listing the handlers that couldn't be registered and the known combinations of
+// type and subtype no handler matches. Call it at startup to make sure no notification goes unhandled.
+func (r *NotificationRouter) CheckCoverage() error {
+	errs := append([]error(nil), r.errs...)
+	if r.defaultHandler == nil {
+		for _, route := range KnownNotificationRoutes() {
+			if r.match(route) == nil {
+				errs = append(errs, fmt.Errorf("no handler for %s", route))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Route verifies and decodes the nested signed objects of a verified notification and passes it to its handler.
+// It is a NotificationCallback, so a router can be used with a NotificationHandler.
+//
+// Nested objects that fail verification are reported as a *PermanentNotificationError, unless the failure is
+// RETRYABLE_VERIFICATION_FAILURE.
+func (r *NotificationRouter) Route(ctx context.Context, notification *ResponseBodyV2DecodedPayload) error {
+	decoded, err := r.verifier.decodeNestedObjects(notification)
+	if err != nil {
+		var vErr *VerificationException
+		if errors.As(err, &vErr) && vErr.Status == RETRYABLE_VERIFICATION_FAILURE {
+			return err
+		}
+		return &PermanentNotificationError{Err: err}
+	}
+	return r.Dispatch(ctx, decoded)
+}
+
+// Dispatch passes a notification whose nested objects are already verified and decoded, such as one returned by
+// VerifyAndDecodeNotificationDeep, to its handler.
+func (r *NotificationRouter) Dispatch(ctx context.Context, notification *DecodedNotification) error {
+	route := routeOf(notification.Notification)
+	handler := r.match(route)
+	if handler == nil {
+		return &PermanentNotificationError{Err: fmt.Errorf("no handler for %s", route)}
+	}
+	return handler(ctx, notification)
+}
+
+func (r *NotificationRouter) match(route NotificationRoute) DecodedNotificationHandler {
+	if handler, ok := r.routes[route]; ok {
+		return handler
+	}
+	if handler, ok := r.routes[NotificationRoute{Type: route.Type, Subtype: ANY_SUBTYPE}]; ok {
+		return handler
+	}
+	if _, known := knownNotificationRoutes[route]; !known && r.unknownHandler != nil {
+		return r.unknownHandler
+	}
+	return r.defaultHandler
+}
+
+func routeOf(notification *ResponseBodyV2DecodedPayload) NotificationRoute {
+	route := NotificationRoute{Type: notification.NotificationType}
+	if notification.Subtype != nil {
+		route.Subtype = *notification.Subtype
+	}
+	return route
+}
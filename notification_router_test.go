@@ -0,0 +1,152 @@
+package appstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestRouterNotification(t *testing.T, pki *testPKI, notificationType NotificationTypeV2, subtype Subtype) *ResponseBodyV2DecodedPayload {
+	t.Helper()
+	notification := &ResponseBodyV2DecodedPayload{
+		NotificationType: notificationType,
+		Data: &Data{
+			Environment: ENVIRONMENT_SANDBOX,
+			BundleId:    "com.example",
+			SignedTransactionInfo: createTestSignedPayload(t, pki, jwt.MapClaims{
+				"bundleId": "com.example", "environment": "Sandbox", "originalTransactionId": "12345", "transactionId": "23456",
+			}),
+			SignedRenewalInfo: createTestSignedPayload(t, pki, jwt.MapClaims{
+				"environment": "Sandbox", "originalTransactionId": "12345", "autoRenewProductId": "com.example.monthly",
+			}),
+		},
+	}
+	if subtype != "" {
+		notification.Subtype = &subtype
+	}
+	return notification
+}
+
+func TestNotificationRouter(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	router, err := NewNotificationRouter(createTestReportVerifier(t, pki, WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED)))
+	assert.NoError(err, "Failed to create router")
+
+	var handled []string
+	router.HandleTransaction(NOTIFICATION_TYPE_DID_RENEW, "", func(ctx context.Context, n *ResponseBodyV2DecodedPayload, transaction *JWSTransactionDecodedPayload, renewalInfo *JWSRenewalInfoDecodedPayload) error {
+		handled = append(handled, "DID_RENEW:"+transaction.TransactionId+":"+renewalInfo.AutoRenewProductId)
+		return nil
+	})
+	router.HandleTransaction(NOTIFICATION_TYPE_EXPIRED, ANY_SUBTYPE, func(ctx context.Context, n *ResponseBodyV2DecodedPayload, transaction *JWSTransactionDecodedPayload, renewalInfo *JWSRenewalInfoDecodedPayload) error {
+		handled = append(handled, "EXPIRED:"+string(*n.Subtype))
+		return nil
+	})
+	router.HandleTransaction(NOTIFICATION_TYPE_EXPIRED, SUBTYPE_VOLUNTARY, func(ctx context.Context, n *ResponseBodyV2DecodedPayload, transaction *JWSTransactionDecodedPayload, renewalInfo *JWSRenewalInfoDecodedPayload) error {
+		handled = append(handled, "EXPIRED/VOLUNTARY")
+		return nil
+	})
+	router.HandleSummary(NOTIFICATION_TYPE_RENEWAL_EXTENSION, SUBTYPE_SUMMARY, func(ctx context.Context, n *ResponseBodyV2DecodedPayload, summary *Summary) error {
+		handled = append(handled, "SUMMARY:"+summary.RequestIdentifier)
+		return nil
+	})
+	router.HandleUnknown(func(ctx context.Context, n *DecodedNotification) error {
+		handled = append(handled, "unknown:"+string(n.Notification.NotificationType))
+		return nil
+	})
+	router.HandleDefault(func(ctx context.Context, n *DecodedNotification) error {
+		handled = append(handled, "default:"+string(n.Notification.NotificationType))
+		return nil
+	})
+	assert.NoError(router.CheckCoverage(), "The default handler covers every notification")
+
+	ctx := context.Background()
+	assert.NoError(router.Route(ctx, createTestRouterNotification(t, pki, NOTIFICATION_TYPE_DID_RENEW, "")), "DID_RENEW")
+	assert.NoError(router.Route(ctx, createTestRouterNotification(t, pki, NOTIFICATION_TYPE_EXPIRED, SUBTYPE_VOLUNTARY)), "EXPIRED/VOLUNTARY")
+	assert.NoError(router.Route(ctx, createTestRouterNotification(t, pki, NOTIFICATION_TYPE_EXPIRED, SUBTYPE_BILLING_RETRY)), "EXPIRED/BILLING_RETRY")
+	assert.NoError(router.Route(ctx, createTestRouterNotification(t, pki, NOTIFICATION_TYPE_DID_RENEW, SUBTYPE_BILLING_RECOVERY)), "DID_RENEW/BILLING_RECOVERY")
+	assert.NoError(router.Route(ctx, createTestRouterNotification(t, pki, "NEW_TYPE", "")), "Unknown type")
+	subtype := SUBTYPE_SUMMARY
+	assert.NoError(router.Route(ctx, &ResponseBodyV2DecodedPayload{
+		NotificationType: NOTIFICATION_TYPE_RENEWAL_EXTENSION,
+		Subtype:          &subtype,
+		Summary:          &Summary{RequestIdentifier: "efb27071-45a4-4aca-9854-2a1e9146f265"},
+	}), "RENEWAL_EXTENSION/SUMMARY")
+	assert.Equal([]string{
+		"DID_RENEW:23456:com.example.monthly",
+		"EXPIRED/VOLUNTARY",
+		"EXPIRED:BILLING_RETRY",
+		"default:DID_RENEW",
+		"unknown:NEW_TYPE",
+		"SUMMARY:efb27071-45a4-4aca-9854-2a1e9146f265",
+	}, handled, "Handlers called")
+
+	handlerErr := errors.New("database unavailable")
+	router.HandleTransaction(NOTIFICATION_TYPE_REFUND, "", func(ctx context.Context, n *ResponseBodyV2DecodedPayload, transaction *JWSTransactionDecodedPayload, renewalInfo *JWSRenewalInfoDecodedPayload) error {
+		return handlerErr
+	})
+	assert.ErrorIs(router.Route(ctx, createTestRouterNotification(t, pki, NOTIFICATION_TYPE_REFUND, "")), handlerErr, "Handler errors are returned")
+}
+
+func TestNotificationRouterRejectsInvalidNotifications(t *testing.T) {
+	pki := createTestPKI(t)
+	router, err := NewNotificationRouter(createTestReportVerifier(t, pki, WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED)))
+	assert.NoError(t, err, "Failed to create router")
+	router.HandleTransaction(NOTIFICATION_TYPE_DID_RENEW, "", func(ctx context.Context, n *ResponseBodyV2DecodedPayload, transaction *JWSTransactionDecodedPayload, renewalInfo *JWSRenewalInfoDecodedPayload) error {
+		t.Error("Handler called for invalid notification")
+		return nil
+	})
+
+	var permanentErr *PermanentNotificationError
+	notification := createTestRouterNotification(t, pki, NOTIFICATION_TYPE_DID_RENEW, "")
+	notification.Data.SignedTransactionInfo = createTestSignedPayload(t, createTestPKI(t), jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox"})
+	err = router.Route(context.Background(), notification)
+	assert.ErrorAs(t, err, &permanentErr, "Nested verification failures are permanent")
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+
+	notification = createTestRouterNotification(t, pki, NOTIFICATION_TYPE_DID_RENEW, "")
+	notification.Data.SignedTransactionInfo = ""
+	assert.ErrorAs(t, router.Route(context.Background(), notification), &permanentErr, "Missing transaction")
+
+	err = router.Route(context.Background(), createTestRouterNotification(t, pki, NOTIFICATION_TYPE_REFUND, ""))
+	assert.ErrorAs(t, err, &permanentErr, "Unhandled notifications are permanent failures")
+	assert.Contains(t, err.Error(), "no handler for REFUND", "Error names the notification")
+}
+
+func TestNotificationRouterCheckCoverage(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	router, err := NewNotificationRouter(createTestReportVerifier(t, pki))
+	assert.NoError(err, "Failed to create router")
+	handler := func(ctx context.Context, n *DecodedNotification) error { return nil }
+	transactionHandler := func(ctx context.Context, n *ResponseBodyV2DecodedPayload, transaction *JWSTransactionDecodedPayload, renewalInfo *JWSRenewalInfoDecodedPayload) error {
+		return nil
+	}
+
+	for _, route := range KnownNotificationRoutes() {
+		router.Handle(route.Type, route.Subtype, handler)
+	}
+	assert.NoError(router.CheckCoverage(), "Every known notification is handled")
+
+	router, _ = NewNotificationRouter(createTestReportVerifier(t, pki))
+	router.HandleTransaction(NOTIFICATION_TYPE_RENEWAL_EXTENSION, ANY_SUBTYPE, transactionHandler)
+	router.HandleTransaction(NOTIFICATION_TYPE_EXPIRED, "", transactionHandler)
+	router.HandleTransaction(NOTIFICATION_TYPE_DID_RENEW, "", transactionHandler)
+	router.HandleTransaction(NOTIFICATION_TYPE_DID_RENEW, "", transactionHandler)
+	router.Handle(NOTIFICATION_TYPE_TEST, "", nil)
+	err = router.CheckCoverage()
+	if assert.Error(err, "Expected coverage errors") {
+		assert.Contains(err.Error(), "RENEWAL_EXTENSION/SUMMARY notifications carry summary, not transaction", "Wrong handler type")
+		assert.Contains(err.Error(), "unknown notification EXPIRED", "Unknown combination")
+		assert.Contains(err.Error(), "duplicate handler for DID_RENEW", "Duplicate handler")
+		assert.Contains(err.Error(), "handler for TEST is nil", "Nil handler")
+		assert.Contains(err.Error(), "no handler for DID_RENEW/BILLING_RECOVERY", "Uncovered combination")
+		assert.NotContains(err.Error(), "no handler for DID_RENEW\n", "Covered combination")
+	}
+
+	_, err = NewNotificationRouter(nil)
+	assert.Error(err, "Verifier is required")
+}
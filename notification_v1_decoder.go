@@ -0,0 +1,120 @@
+package appstore
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+)
+
+// NotificationV1Decoder decodes legacy App Store Server Notifications V1.
+// Version 1 notifications aren't signed, so the decoder authenticates them by comparing the shared secret they carry.
+//
+// https://developer.apple.com/documentation/appstoreservernotifications/app_store_server_notifications_v1
+type NotificationV1Decoder struct {
+	sharedSecret string
+	bundleID     string
+}
+
+// NewNotificationV1Decoder creates a new decoder for version 1 notifications.
+// The bundleID is optional; when it is set, notifications for other apps are rejected.
+func NewNotificationV1Decoder(sharedSecret, bundleID string) (*NotificationV1Decoder, error) {
+	if sharedSecret == "" {
+		return nil, errors.New("sharedSecret is required to authenticate version 1 notifications")
+	}
+	return &NotificationV1Decoder{
+		sharedSecret: sharedSecret,
+		bundleID:     bundleID,
+	}, nil
+}
+
+// Decode decodes the body of a version 1 notification request and checks its shared secret and bundle ID.
+func (d *NotificationV1Decoder) Decode(body []byte) (*ResponseBodyV1, error) {
+	payload := &ResponseBodyV1{}
+	if err := json.Unmarshal(body, payload); err != nil {
+		return nil, NewVerificationException(VERIFICATION_FAILURE, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(payload.Password), []byte(d.sharedSecret)) != 1 {
+		return nil, NewVerificationException(VERIFICATION_FAILURE, errors.New("shared secret mismatch"))
+	}
+	if d.bundleID != "" && payload.Bid != d.bundleID {
+		return nil, NewVerificationException(INVALID_APP_IDENTIFIER, errors.New("bundleId mismatch"))
+	}
+	return payload, nil
+}
+
+// EnvironmentV2 returns the notification environment using the version 2 Environment values.
+// Version 1 notifications use PROD for the production environment.
+func (n *ResponseBodyV1) EnvironmentV2() Environment {
+	if n.Environment == "PROD" {
+		return ENVIRONMENT_PRODUCTION
+	}
+	return Environment(n.Environment)
+}
+
+// NotificationTypeV2 returns the version 2 notification type and subtype that most closely match this version 1 notification.
+// The returned bool is false if the version 1 notification type is unknown.
+//
+// https://developer.apple.com/documentation/appstoreservernotifications/app_store_server_notifications_changelog
+func (n *ResponseBodyV1) NotificationTypeV2() (NotificationTypeV2, *Subtype, bool) {
+	subtype := func(s Subtype) *Subtype { return &s }
+	switch n.NotificationType {
+	case NOTIFICATION_TYPE_V1_INITIAL_BUY:
+		return NOTIFICATION_TYPE_SUBSCRIBED, subtype(SUBTYPE_INITIAL_BUY), true
+	case NOTIFICATION_TYPE_V1_INTERACTIVE_RENEWAL:
+		return NOTIFICATION_TYPE_SUBSCRIBED, subtype(SUBTYPE_RESUBSCRIBE), true
+	case NOTIFICATION_TYPE_V1_DID_CHANGE_RENEWAL_PREF:
+		return NOTIFICATION_TYPE_DID_CHANGE_RENEWAL_PREF, nil, true
+	case NOTIFICATION_TYPE_V1_DID_CHANGE_RENEWAL_STATUS:
+		if n.AutoRenewStatus == "true" {
+			return NOTIFICATION_TYPE_DID_CHANGE_RENEWAL_STATUS, subtype(SUBTYPE_AUTO_RENEW_ENABLED), true
+		}
+		return NOTIFICATION_TYPE_DID_CHANGE_RENEWAL_STATUS, subtype(SUBTYPE_AUTO_RENEW_DISABLED), true
+	case NOTIFICATION_TYPE_V1_DID_FAIL_TO_RENEW:
+		if n.isInGracePeriod() {
+			return NOTIFICATION_TYPE_DID_FAIL_TO_RENEW, subtype(SUBTYPE_GRACE_PERIOD), true
+		}
+		return NOTIFICATION_TYPE_DID_FAIL_TO_RENEW, nil, true
+	case NOTIFICATION_TYPE_V1_DID_RECOVER, NOTIFICATION_TYPE_V1_RENEWAL:
+		return NOTIFICATION_TYPE_DID_RENEW, subtype(SUBTYPE_BILLING_RECOVERY), true
+	case NOTIFICATION_TYPE_V1_DID_RENEW:
+		return NOTIFICATION_TYPE_DID_RENEW, nil, true
+	case NOTIFICATION_TYPE_V1_PRICE_INCREASE_CONSENT:
+		return NOTIFICATION_TYPE_PRICE_INCREASE, subtype(SUBTYPE_PENDING), true
+	case NOTIFICATION_TYPE_V1_CANCEL, NOTIFICATION_TYPE_V1_REFUND:
+		return NOTIFICATION_TYPE_REFUND, nil, true
+	case NOTIFICATION_TYPE_V1_REVOKE:
+		return NOTIFICATION_TYPE_REVOKE, nil, true
+	case NOTIFICATION_TYPE_V1_CONSUMPTION_REQUEST:
+		return NOTIFICATION_TYPE_CONSUMPTION_REQUEST, nil, true
+	default:
+		return "", nil, false
+	}
+}
+
+func (n *ResponseBodyV1) isInGracePeriod() bool {
+	if n.UnifiedReceipt == nil {
+		return false
+	}
+	for _, info := range n.UnifiedReceipt.PendingRenewalInfo {
+		if info.OriginalTransactionId == n.OriginalTransactionId.String() && info.GracePeriodExpiresDateMs != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Transactions returns the transactions in unified_receipt mapped to JWSTransactionDecodedPayload.
+func (n *ResponseBodyV1) Transactions() ([]*JWSTransactionDecodedPayload, error) {
+	if n.UnifiedReceipt == nil {
+		return nil, nil
+	}
+	transactions := make([]*JWSTransactionDecodedPayload, 0, len(n.UnifiedReceipt.LatestReceiptInfo))
+	for i := range n.UnifiedReceipt.LatestReceiptInfo {
+		transaction, err := n.UnifiedReceipt.LatestReceiptInfo[i].ToJWSTransactionDecodedPayload(n.Bid, n.EnvironmentV2())
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+	return transactions, nil
+}
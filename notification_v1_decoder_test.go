@@ -0,0 +1,127 @@
+package appstore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationV1Decode(t *testing.T) {
+	assert := assert.New(t)
+	body, err := readTestData("models/notificationV1.json")
+	assert.NoError(err, "Failed to read test data")
+	decoder, err := NewNotificationV1Decoder("shared_secret", "com.example")
+	assert.NoError(err, "Failed to create decoder")
+
+	notification, err := decoder.Decode(body)
+	assert.NoError(err, "Decode failed")
+	assert.Equal(NOTIFICATION_TYPE_V1_DID_CHANGE_RENEWAL_STATUS, notification.NotificationType, "NotificationType")
+	assert.Equal("1000000000000002", notification.OriginalTransactionId.String(), "OriginalTransactionId")
+	assert.Equal(ENVIRONMENT_PRODUCTION, notification.EnvironmentV2(), "EnvironmentV2")
+	assert.Equal(ENVIRONMENT_PRODUCTION, notification.UnifiedReceipt.Environment, "UnifiedReceipt.Environment")
+	assert.Equal(VERIFY_RECEIPT_STATUS_OK, notification.UnifiedReceipt.Status, "UnifiedReceipt.Status")
+
+	notificationType, subtype, ok := notification.NotificationTypeV2()
+	assert.True(ok, "Known type")
+	assert.Equal(NOTIFICATION_TYPE_DID_CHANGE_RENEWAL_STATUS, notificationType, "NotificationTypeV2")
+	assert.Equal(SUBTYPE_AUTO_RENEW_DISABLED, *subtype, "Subtype")
+
+	transactions, err := notification.Transactions()
+	assert.NoError(err, "Transactions failed")
+	assert.Equal(1, len(transactions), "Transactions")
+	assert.Equal("com.example", transactions[0].BundleId, "BundleId")
+	assert.Equal(ENVIRONMENT_PRODUCTION, transactions[0].Environment, "Environment")
+}
+
+func TestNotificationV1Decode_SharedSecretMismatch(t *testing.T) {
+	assert := assert.New(t)
+	body, err := readTestData("models/notificationV1.json")
+	assert.NoError(err, "Failed to read test data")
+	decoder, err := NewNotificationV1Decoder("other_secret", "")
+	assert.NoError(err, "Failed to create decoder")
+
+	_, err = decoder.Decode(body)
+	vErr, ok := err.(*VerificationException)
+	assert.True(ok, "Expected VerificationException")
+	assert.Equal(VERIFICATION_FAILURE, vErr.Status, "Status")
+}
+
+func TestNotificationV1Decode_BundleIdMismatch(t *testing.T) {
+	assert := assert.New(t)
+	body, err := readTestData("models/notificationV1.json")
+	assert.NoError(err, "Failed to read test data")
+	decoder, err := NewNotificationV1Decoder("shared_secret", "com.other")
+	assert.NoError(err, "Failed to create decoder")
+
+	_, err = decoder.Decode(body)
+	vErr, ok := err.(*VerificationException)
+	assert.True(ok, "Expected VerificationException")
+	assert.Equal(INVALID_APP_IDENTIFIER, vErr.Status, "Status")
+}
+
+func TestNotificationV1Decode_InvalidJSON(t *testing.T) {
+	assert := assert.New(t)
+	decoder, err := NewNotificationV1Decoder("shared_secret", "")
+	assert.NoError(err, "Failed to create decoder")
+
+	_, err = decoder.Decode([]byte("not json"))
+	assert.Error(err, "Expected error for invalid JSON")
+
+	_, err = NewNotificationV1Decoder("", "")
+	assert.Error(err, "Expected error for empty shared secret")
+}
+
+func TestNotificationV1TypeMapping(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		notificationType NotificationTypeV1
+		autoRenewStatus  string
+		expectedType     NotificationTypeV2
+		expectedSubtype  Subtype
+	}{
+		{NOTIFICATION_TYPE_V1_INITIAL_BUY, "", NOTIFICATION_TYPE_SUBSCRIBED, SUBTYPE_INITIAL_BUY},
+		{NOTIFICATION_TYPE_V1_INTERACTIVE_RENEWAL, "", NOTIFICATION_TYPE_SUBSCRIBED, SUBTYPE_RESUBSCRIBE},
+		{NOTIFICATION_TYPE_V1_DID_CHANGE_RENEWAL_PREF, "", NOTIFICATION_TYPE_DID_CHANGE_RENEWAL_PREF, ""},
+		{NOTIFICATION_TYPE_V1_DID_CHANGE_RENEWAL_STATUS, "true", NOTIFICATION_TYPE_DID_CHANGE_RENEWAL_STATUS, SUBTYPE_AUTO_RENEW_ENABLED},
+		{NOTIFICATION_TYPE_V1_DID_FAIL_TO_RENEW, "", NOTIFICATION_TYPE_DID_FAIL_TO_RENEW, ""},
+		{NOTIFICATION_TYPE_V1_DID_RECOVER, "", NOTIFICATION_TYPE_DID_RENEW, SUBTYPE_BILLING_RECOVERY},
+		{NOTIFICATION_TYPE_V1_RENEWAL, "", NOTIFICATION_TYPE_DID_RENEW, SUBTYPE_BILLING_RECOVERY},
+		{NOTIFICATION_TYPE_V1_DID_RENEW, "", NOTIFICATION_TYPE_DID_RENEW, ""},
+		{NOTIFICATION_TYPE_V1_PRICE_INCREASE_CONSENT, "", NOTIFICATION_TYPE_PRICE_INCREASE, SUBTYPE_PENDING},
+		{NOTIFICATION_TYPE_V1_CANCEL, "", NOTIFICATION_TYPE_REFUND, ""},
+		{NOTIFICATION_TYPE_V1_REFUND, "", NOTIFICATION_TYPE_REFUND, ""},
+		{NOTIFICATION_TYPE_V1_REVOKE, "", NOTIFICATION_TYPE_REVOKE, ""},
+		{NOTIFICATION_TYPE_V1_CONSUMPTION_REQUEST, "", NOTIFICATION_TYPE_CONSUMPTION_REQUEST, ""},
+	}
+	for _, test := range tests {
+		assert.True(test.notificationType.IsValid(), "IsValid")
+		notification := &ResponseBodyV1{NotificationType: test.notificationType, AutoRenewStatus: test.autoRenewStatus}
+		notificationType, subtype, ok := notification.NotificationTypeV2()
+		assert.True(ok, "Known type "+test.notificationType.Raw())
+		assert.Equal(test.expectedType, notificationType, "NotificationTypeV2 for "+test.notificationType.Raw())
+		if test.expectedSubtype == "" {
+			assert.Nil(subtype, "Subtype for "+test.notificationType.Raw())
+		} else {
+			assert.Equal(test.expectedSubtype, *subtype, "Subtype for "+test.notificationType.Raw())
+		}
+	}
+
+	_, _, ok := (&ResponseBodyV1{NotificationType: "UNKNOWN"}).NotificationTypeV2()
+	assert.False(ok, "Unknown type")
+	assert.False(NotificationTypeV1("UNKNOWN").IsValid(), "IsValid")
+}
+
+func TestNotificationV1_GracePeriod(t *testing.T) {
+	assert := assert.New(t)
+	body, err := readTestData("models/notificationV1.json")
+	assert.NoError(err, "Failed to read test data")
+	body = []byte(strings.Replace(string(body), `"DID_CHANGE_RENEWAL_STATUS"`, `"DID_FAIL_TO_RENEW"`, 1))
+	decoder, _ := NewNotificationV1Decoder("shared_secret", "")
+
+	notification, err := decoder.Decode(body)
+	assert.NoError(err, "Decode failed")
+	notificationType, subtype, _ := notification.NotificationTypeV2()
+	assert.Equal(NOTIFICATION_TYPE_DID_FAIL_TO_RENEW, notificationType, "NotificationTypeV2")
+	assert.Equal(SUBTYPE_GRACE_PERIOD, *subtype, "Subtype")
+}
@@ -0,0 +1,69 @@
+package appstore
+
+import "encoding/json"
+
+// ResponseBodyV1 is the JSON data that the App Store sends in a version 1 server notification.
+// Version 1 notifications are unsigned; use a NotificationV1Decoder to check the shared secret before trusting one.
+//
+// https://developer.apple.com/documentation/appstoreservernotifications/responsebodyv1
+type ResponseBodyV1 struct {
+	// An identifier that App Store Connect generates and the App Store uses to uniquely identify the auto-renewable subscription that the user's subscription renews.
+	AutoRenewAdamId string `json:"auto_renew_adam_id,omitempty"`
+
+	// The product identifier of the auto-renewable subscription that the user's subscription renews.
+	AutoRenewProductId string `json:"auto_renew_product_id,omitempty"`
+
+	// The current renewal status for an auto-renewable subscription product, either "true" or "false".
+	AutoRenewStatus string `json:"auto_renew_status,omitempty"`
+
+	// The time at which the user turned on or off the renewal status for an auto-renewable subscription, in UNIX epoch time format, in milliseconds.
+	AutoRenewStatusChangeDateMs string `json:"auto_renew_status_change_date_ms,omitempty"`
+
+	// The environment for which the receipt was generated, either Sandbox or PROD.
+	Environment string `json:"environment,omitempty"`
+
+	// The reason a subscription expired.
+	ExpirationIntent *ExpirationIntent `json:"expiration_intent,omitempty"`
+
+	// The subscription event that triggered the notification.
+	//
+	// https://developer.apple.com/documentation/appstoreservernotifications/notification_type_v1
+	NotificationType NotificationTypeV1 `json:"notification_type,omitempty"`
+
+	// The same value as the shared secret you submit in the password field of the requestBody when validating receipts.
+	Password string `json:"password,omitempty"`
+
+	// An object that contains information about the most-recent, in-app purchase transactions for the app.
+	//
+	// https://developer.apple.com/documentation/appstoreservernotifications/unified_receipt
+	UnifiedReceipt *UnifiedReceipt `json:"unified_receipt,omitempty"`
+
+	// A string that contains the app bundle ID.
+	Bid string `json:"bid,omitempty"`
+
+	// A string that contains the app bundle version.
+	Bvrs string `json:"bvrs,omitempty"`
+
+	// The transaction identifier of the original purchase. The App Store sends it as a number or a string.
+	OriginalTransactionId json.Number `json:"original_transaction_id,omitempty"`
+}
+
+// UnifiedReceipt is an object that contains information about the most recent in-app purchase transactions for the app.
+//
+// https://developer.apple.com/documentation/appstoreservernotifications/unified_receipt
+type UnifiedReceipt struct {
+	// The environment for which the App Store generated the receipt.
+	Environment Environment `json:"environment,omitempty"`
+
+	// The latest Base64-encoded app receipt.
+	LatestReceipt string `json:"latest_receipt,omitempty"`
+
+	// An array that contains the latest 100 in-app purchase transactions of the decoded value in latest_receipt.
+	LatestReceiptInfo []LegacyInAppTransaction `json:"latest_receipt_info,omitempty"`
+
+	// An array where each element contains the pending renewal information for each auto-renewable subscription identified in product_id.
+	PendingRenewalInfo []LegacyPendingRenewalInfo `json:"pending_renewal_info,omitempty"`
+
+	// The status code, where 0 indicates that the notification is valid.
+	Status VerifyReceiptStatus `json:"status"`
+}
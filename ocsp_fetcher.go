@@ -0,0 +1,155 @@
+package appstore
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// OCSPFetcher sends a DER-encoded OCSP request to a responder and returns the DER-encoded response.
+// Implementations must be safe for concurrent use.
+type OCSPFetcher interface {
+	FetchOCSP(server string, request []byte) ([]byte, error)
+}
+
+// HTTPOCSPFetcher is an OCSPFetcher that posts requests to the responder over HTTP.
+type HTTPOCSPFetcher struct {
+	httpClient HTTPClient
+}
+
+// NewHTTPOCSPFetcher creates an OCSP fetcher that uses the given HTTP client.
+// If httpClient is nil, a client with a 30 second timeout is used.
+func NewHTTPOCSPFetcher(httpClient HTTPClient) *HTTPOCSPFetcher {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &HTTPOCSPFetcher{httpClient: httpClient}
+}
+
+// FetchOCSP posts the request to the responder and returns the response body.
+// Any error, including a non-200 status, means the responder is unavailable.
+func (f *HTTPOCSPFetcher) FetchOCSP(server string, request []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", server, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP server returned status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// OCSPFailurePolicy decides what happens when a certificate's revocation status can't be fetched.
+// The zero value is hard-fail: the signed data is rejected.
+type OCSPFailurePolicy struct {
+	// SoftFail accepts a certificate whose OCSP responders can't be reached, and reports it as degraded.
+	// A certificate that is known to be revoked is always rejected.
+	SoftFail bool
+
+	// MaxStaleness limits soft-fail to certificates with a Good response that expired no more than this long ago.
+	// A negative value also accepts certificates that have never had a Good response.
+	MaxStaleness time.Duration
+
+	// OnDegraded, if set, is called for every certificate accepted under soft-fail.
+	OnDegraded func(OCSPDegradation)
+}
+
+// OCSPDegradation describes a certificate that was accepted without a current OCSP response.
+type OCSPDegradation struct {
+	// The certificate whose revocation status couldn't be confirmed.
+	Certificate *x509.Certificate
+
+	// The NextUpdate of the last Good response for the certificate, or the zero time if there is none.
+	LastNextUpdate time.Time
+
+	// The error returned while fetching a fresh response.
+	Err error
+}
+
+const maxOCSPCacheSize = 256
+
+type ocspCacheEntry struct {
+	nextUpdate time.Time
+}
+
+type ocspCacheItem struct {
+	key   string
+	entry ocspCacheEntry
+}
+
+// ocspResponseCache remembers Good OCSP responses by issuer and serial number until their NextUpdate,
+// and for as long afterwards as the failure policy may need them. When full, it evicts the least recently used response.
+type ocspResponseCache struct {
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+func newOCSPResponseCache() *ocspResponseCache {
+	return &ocspResponseCache{entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func ocspCacheKey(cert, issuer *x509.Certificate) string {
+	issuerHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(issuerHash[:]) + ":" + cert.SerialNumber.String()
+}
+
+func (c *ocspResponseCache) get(key string) (ocspCacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return ocspCacheEntry{}, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*ocspCacheItem).entry, true
+}
+
+func (c *ocspResponseCache) put(key string, entry ocspCacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*ocspCacheItem).entry = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	for c.order.Len() >= maxOCSPCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*ocspCacheItem).key)
+	}
+	c.entries[key] = c.order.PushFront(&ocspCacheItem{key: key, entry: entry})
+}
+
+// ocspUnavailableError indicates that no response could be fetched from an OCSP responder.
+// Only this kind of failure is eligible for soft-fail.
+type ocspUnavailableError struct {
+	err error
+}
+
+func (e *ocspUnavailableError) Error() string {
+	return fmt.Sprintf("OCSP responder unavailable: %v", e.err)
+}
+
+func (e *ocspUnavailableError) Unwrap() error {
+	return e.err
+}
+
+var errOCSPRevoked = errors.New("certificate is revoked")
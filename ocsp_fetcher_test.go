@@ -0,0 +1,294 @@
+package appstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+// testPKI is a generated root, intermediate and leaf chain with the Apple OIDs, OCSP servers and CRL distribution points
+type testPKI struct {
+	root, intermediate, leaf          *x509.Certificate
+	rootKey, intermediateKey, leafKey *ecdsa.PrivateKey
+}
+
+func (p *testPKI) chain() []string {
+	return []string{
+		base64.StdEncoding.EncodeToString(p.leaf.Raw),
+		base64.StdEncoding.EncodeToString(p.intermediate.Raw),
+		base64.StdEncoding.EncodeToString(p.root.Raw),
+	}
+}
+
+func createTestPKI(t testing.TB) *testPKI {
+	t.Helper()
+	notBefore := time.Now().Add(-24 * time.Hour)
+	notAfter := time.Now().Add(365 * 24 * time.Hour)
+	extension := func(oid string) pkix.Extension {
+		id := asn1.ObjectIdentifier{}
+		for _, part := range []int{1, 2, 840, 113635, 100, 6} {
+			id = append(id, part)
+		}
+		switch oid {
+		case "leaf":
+			id = append(id, 11, 1)
+		case "intermediate":
+			id = append(id, 2, 1)
+		}
+		return pkix.Extension{Id: id, Value: []byte{0x05, 0x00}}
+	}
+	create := func(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err, "Failed to generate key")
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		assert.NoError(t, err, "Failed to create certificate")
+		cert, err := x509.ParseCertificate(der)
+		assert.NoError(t, err, "Failed to parse certificate")
+		return cert, key
+	}
+
+	pki := &testPKI{}
+	pki.root, pki.rootKey = create(&x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, nil, nil)
+	pki.intermediate, pki.intermediateKey = create(&x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test Intermediate"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		OCSPServer:            []string{"http://ocsp.example.com/root"},
+		CRLDistributionPoints: []string{"http://crl.example.com/root.crl"},
+		ExtraExtensions:       []pkix.Extension{extension("intermediate")},
+	}, pki.root, pki.rootKey)
+	pki.leaf, pki.leafKey = create(&x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "Test Leaf"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		OCSPServer:            []string{"http://ocsp.example.com/intermediate"},
+		CRLDistributionPoints: []string{"http://crl.example.com/intermediate.crl"},
+		ExtraExtensions:       []pkix.Extension{extension("leaf")},
+	}, pki.intermediate, pki.intermediateKey)
+	return pki
+}
+
+// testOCSPResponder answers OCSP requests for a testPKI, signing with the issuing CA key
+type testOCSPResponder struct {
+	t          *testing.T
+	pki        *testPKI
+	status     map[string]int
+	nextUpdate time.Time
+	err        error
+	mu         sync.Mutex
+	requests   int
+}
+
+func newTestOCSPResponder(t *testing.T, pki *testPKI) *testOCSPResponder {
+	return &testOCSPResponder{t: t, pki: pki, status: map[string]int{}, nextUpdate: time.Now().Add(time.Hour)}
+}
+
+func (r *testOCSPResponder) FetchOCSP(server string, request []byte) ([]byte, error) {
+	r.mu.Lock()
+	r.requests++
+	r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	req, err := ocsp.ParseRequest(request)
+	assert.NoError(r.t, err, "Failed to parse OCSP request")
+
+	issuer, issuerKey := r.pki.root, r.pki.rootKey
+	if req.SerialNumber.Cmp(r.pki.leaf.SerialNumber) == 0 {
+		issuer, issuerKey = r.pki.intermediate, r.pki.intermediateKey
+	}
+	template := ocsp.Response{
+		Status:       r.status[req.SerialNumber.String()],
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   r.nextUpdate,
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}
+	return ocsp.CreateResponse(issuer, issuer, template, issuerKey)
+}
+
+func createTestOCSPChainVerifier(t *testing.T, pki *testPKI, fetcher OCSPFetcher, policy OCSPFailurePolicy) *chainVerifier {
+	cv, err := newChainVerifier([][]byte{pki.root.Raw})
+	assert.NoError(t, err, "Failed to create chain verifier")
+	cv.ocspFetcher = fetcher
+	cv.ocspPolicy = policy
+	cv.cache = NewChainCache(0, 0)
+	return cv
+}
+
+func TestOCSPResponsesAreCachedUntilNextUpdate(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	responder := newTestOCSPResponder(t, pki)
+	cv := createTestOCSPChainVerifier(t, pki, responder, OCSPFailurePolicy{})
+	now := time.Now()
+	cv.now = func() time.Time { return now }
+
+	_, err := cv.verifyChain(pki.chain(), true, now)
+	assert.NoError(err, "Expected valid chain")
+	assert.Equal(2, responder.requests, "One request per certificate")
+
+	_, err = cv.verifyChain(pki.chain(), true, now)
+	assert.NoError(err, "Expected valid chain")
+	assert.Equal(2, responder.requests, "Responses are cached")
+
+	now = responder.nextUpdate.Add(time.Second)
+	responder.nextUpdate = now.Add(time.Hour)
+	_, err = cv.verifyChain(pki.chain(), true, now)
+	assert.NoError(err, "Expected valid chain")
+	assert.Equal(4, responder.requests, "Responses are fetched again after NextUpdate")
+}
+
+func TestOCSPResponseCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	assert := assert.New(t)
+	cache := newOCSPResponseCache()
+	for i := range maxOCSPCacheSize {
+		cache.put(strconv.Itoa(i), ocspCacheEntry{})
+	}
+	_, ok := cache.get("0")
+	assert.True(ok, "Cached")
+
+	cache.put("new", ocspCacheEntry{})
+	_, ok = cache.get("0")
+	assert.True(ok, "Recently used responses are kept")
+	_, ok = cache.get("1")
+	assert.False(ok, "The least recently used response is evicted")
+	assert.Equal(maxOCSPCacheSize, len(cache.entries), "Size is bounded")
+}
+
+func TestOCSPRevokedCertificate(t *testing.T) {
+	pki := createTestPKI(t)
+	responder := newTestOCSPResponder(t, pki)
+	responder.status[pki.leaf.SerialNumber.String()] = ocsp.Revoked
+	cv := createTestOCSPChainVerifier(t, pki, responder, OCSPFailurePolicy{SoftFail: true, MaxStaleness: -1})
+
+	_, err := cv.verifyChain(pki.chain(), true, time.Now())
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+}
+
+func TestOCSPHardFailWhenUnavailable(t *testing.T) {
+	pki := createTestPKI(t)
+	responder := newTestOCSPResponder(t, pki)
+	responder.err = errors.New("connection refused")
+	cv := createTestOCSPChainVerifier(t, pki, responder, OCSPFailurePolicy{})
+
+	_, err := cv.verifyChain(pki.chain(), true, time.Now())
+	assertVerificationStatus(t, RETRYABLE_VERIFICATION_FAILURE, err)
+}
+
+func TestOCSPSoftFailWithinMaxStaleness(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	responder := newTestOCSPResponder(t, pki)
+	var degraded []OCSPDegradation
+	cv := createTestOCSPChainVerifier(t, pki, responder, OCSPFailurePolicy{
+		SoftFail:     true,
+		MaxStaleness: time.Hour,
+		OnDegraded:   func(d OCSPDegradation) { degraded = append(degraded, d) },
+	})
+	cv.cache = NewChainCache(maxCacheSize, cacheTimeLimit)
+	now := time.Now()
+	cv.now = func() time.Time { return now }
+
+	_, err := cv.verifyChain(pki.chain(), true, now)
+	assert.NoError(err, "Expected valid chain")
+	cv.cache.Purge()
+
+	responder.err = errors.New("connection refused")
+	now = responder.nextUpdate.Add(30 * time.Minute)
+	_, err = cv.verifyChain(pki.chain(), true, now)
+	assert.NoError(err, "Soft-fail should accept a recently Good certificate")
+	assert.Equal(2, len(degraded), "Both certificates are degraded")
+	assert.Equal(pki.leaf, degraded[1].Certificate, "Degraded certificate")
+	assert.Equal(responder.nextUpdate.Unix(), degraded[1].LastNextUpdate.Unix(), "LastNextUpdate")
+	assert.Equal(0, cv.cache.Stats().Entries, "Degraded chains are not cached")
+
+	now = responder.nextUpdate.Add(2 * time.Hour)
+	_, err = cv.verifyChain(pki.chain(), true, now)
+	assertVerificationStatus(t, RETRYABLE_VERIFICATION_FAILURE, err)
+}
+
+func TestOCSPSoftFailWithoutPreviousResponse(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	responder := newTestOCSPResponder(t, pki)
+	responder.err = errors.New("connection refused")
+
+	cv := createTestOCSPChainVerifier(t, pki, responder, OCSPFailurePolicy{SoftFail: true})
+	_, err := cv.verifyChain(pki.chain(), true, time.Now())
+	assertVerificationStatus(t, RETRYABLE_VERIFICATION_FAILURE, err)
+
+	cv = createTestOCSPChainVerifier(t, pki, responder, OCSPFailurePolicy{SoftFail: true, MaxStaleness: -1})
+	_, err = cv.verifyChain(pki.chain(), true, time.Now())
+	assert.NoError(err, "Negative MaxStaleness accepts certificates without a previous response")
+}
+
+func TestHTTPOCSPFetcher(t *testing.T) {
+	assert := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("POST", r.Method, "Method")
+		assert.Equal("application/ocsp-request", r.Header.Get("Content-Type"), "Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal([]byte("request"), body, "Body")
+		w.Write([]byte("response"))
+	}))
+	defer server.Close()
+
+	fetcher := NewHTTPOCSPFetcher(server.Client())
+	response, err := fetcher.FetchOCSP(server.URL, []byte("request"))
+	assert.NoError(err, "FetchOCSP failed")
+	assert.Equal([]byte("response"), response, "Response")
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	_, err = fetcher.FetchOCSP(server.URL, []byte("request"))
+	assert.Error(err, "Expected error for non-200 status")
+}
+
+func TestCachedChainIsOnlyUsedWithinItsValidity(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	cv := createTestOCSPChainVerifier(t, pki, newTestOCSPResponder(t, pki), OCSPFailurePolicy{})
+	cv.cache = NewChainCache(maxCacheSize, cacheTimeLimit)
+
+	_, err := cv.verifyChain(pki.chain(), true, time.Now())
+	assert.NoError(err, "Expected valid chain")
+	assert.Equal(1, cv.cache.Stats().Entries, "Chain is cached")
+
+	_, err = cv.verifyChain(pki.chain(), true, pki.leaf.NotAfter.Add(time.Hour))
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+}
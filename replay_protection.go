@@ -0,0 +1,141 @@
+package appstore
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ReplayStore remembers the identifiers of notifications and realtime requests that have been accepted,
+// so that a replayed payload can be rejected. Implementations must be safe for concurrent use.
+type ReplayStore interface {
+	// MarkSeen records id and reports whether it had already been recorded and not yet forgotten.
+	// Checking and recording must be atomic, so that concurrent calls with the same id report exactly one first sighting.
+	MarkSeen(id string) (seen bool, err error)
+}
+
+type freshnessPolicy struct {
+	maxAge time.Duration
+	skew   time.Duration
+}
+
+// WithFreshness rejects notifications and realtime requests whose signedDate is more than maxAge in the past,
+// or in the future, allowing for skew between the App Store's clock and the verifier's clock.
+// Such payloads fail with STALE_SIGNED_DATE. Transactions and renewal info aren't checked,
+// because they are legitimately fetched long after they were signed.
+func WithFreshness(maxAge, skew time.Duration) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.freshness = &freshnessPolicy{maxAge: maxAge, skew: skew}
+	}
+}
+
+// WithReplayStore rejects a notification whose notificationUUID, or a realtime request whose requestIdentifier,
+// has already been accepted, with REPLAYED_PAYLOAD. An identifier is only recorded once every other check has passed.
+// Payloads without the identifier are rejected with VERIFICATION_FAILURE.
+// The store should remember identifiers for at least the maxAge and skew given to WithFreshness.
+// NotificationHandler doesn't accept a verifier with a replay store; see IdempotentNotificationCallback.
+func WithReplayStore(store ReplayStore) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.replayStore = store
+	}
+}
+
+// replayIdentity returns the signed date and the replay store key of a payload that can be replayed.
+// The key is empty when the payload has no identifier.
+func replayIdentity(destination any) (Timestamp, string, bool) {
+	switch payload := destination.(type) {
+	case *ResponseBodyV2DecodedPayload:
+		return payload.SignedDate, replayKey("notification:", payload.NotificationUUID), true
+	case *DecodedRealtimeRequestBody:
+		return payload.SignedDate, replayKey("realtime:", payload.RequestIdentifier), true
+	default:
+		return 0, "", false
+	}
+}
+
+func replayKey(prefix, id string) string {
+	if id == "" {
+		return ""
+	}
+	return prefix + id
+}
+
+func (v *SignedDataVerifier) checkFreshnessAndReplay(destination any) error {
+	signedDate, key, ok := replayIdentity(destination)
+	if !ok {
+		return nil
+	}
+
+	if v.freshness != nil {
+		now := v.now()
+		signed := signedDate.Time()
+		switch {
+		case signedDate.IsZero():
+			return NewVerificationException(STALE_SIGNED_DATE, errors.New("payload has no signedDate"))
+		case signed.Before(now.Add(-v.freshness.maxAge - v.freshness.skew)):
+			return NewVerificationException(STALE_SIGNED_DATE, fmt.Errorf("payload was signed %s ago", now.Sub(signed).Round(time.Second)))
+		case signed.After(now.Add(v.freshness.skew)):
+			return NewVerificationException(STALE_SIGNED_DATE, errors.New("payload is signed in the future"))
+		}
+	}
+
+	if v.replayStore != nil {
+		// Payloads without an identifier would all share one key
+		if key == "" {
+			return NewVerificationException(VERIFICATION_FAILURE, errors.New("payload has no identifier to check for replay"))
+		}
+		seen, err := v.replayStore.MarkSeen(key)
+		if err != nil {
+			return NewVerificationException(RETRYABLE_VERIFICATION_FAILURE, fmt.Errorf("replay store: %w", err))
+		}
+		if seen {
+			return NewVerificationException(REPLAYED_PAYLOAD, errors.New("payload has already been accepted"))
+		}
+	}
+	return nil
+}
+
+// MemoryReplayStore is a ReplayStore that keeps identifiers in memory for a fixed time.
+// It suits a single server; deployments with several servers need a shared store.
+type MemoryReplayStore struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	entries map[string]time.Time
+	now     func() time.Time
+	sweepAt time.Time
+}
+
+// NewMemoryReplayStore creates a replay store that forgets identifiers ttl after they were first seen.
+func NewMemoryReplayStore(ttl time.Duration) *MemoryReplayStore {
+	return &MemoryReplayStore{ttl: ttl, entries: make(map[string]time.Time), now: time.Now}
+}
+
+// MarkSeen records id and reports whether it was already recorded within the TTL.
+func (s *MemoryReplayStore) MarkSeen(id string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	if !now.Before(s.sweepAt) {
+		for key, expiry := range s.entries {
+			if !now.Before(expiry) {
+				delete(s.entries, key)
+			}
+		}
+		s.sweepAt = now.Add(s.ttl)
+	}
+
+	if expiry, ok := s.entries[id]; ok && now.Before(expiry) {
+		return true, nil
+	}
+	s.entries[id] = now.Add(s.ttl)
+	return false, nil
+}
+
+// Len returns the number of identifiers currently remembered, including any that have expired but not yet been swept.
+func (s *MemoryReplayStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.entries)
+}
@@ -0,0 +1,181 @@
+package appstore
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingReplayStore struct{}
+
+func (failingReplayStore) MarkSeen(id string) (bool, error) {
+	return false, errors.New("store unavailable")
+}
+
+func TestFreshness(t *testing.T) {
+	assert := assert.New(t)
+	signedDate := time.UnixMilli(1698148900000)
+	now := signedDate
+	verifier, err := createTestSignedDataVerifierWithOptions(
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING), WithUnverifiedLocalTesting(),
+		WithBundleID("com.example"),
+		WithFreshness(5*time.Minute, 30*time.Second),
+		WithClock(func() time.Time { return now }),
+	)
+	assert.NoError(err, "Failed to create verifier")
+
+	signedNotification, err := createSignedDataFromJSON("models/signedNotification.json")
+	assert.NoError(err, "Failed to create signed data")
+
+	now = signedDate.Add(5*time.Minute + 30*time.Second)
+	_, err = verifier.VerifyAndDecodeNotification(signedNotification)
+	assert.NoError(err, "Within max age plus skew")
+
+	now = signedDate.Add(5*time.Minute + 31*time.Second)
+	_, err = verifier.VerifyAndDecodeNotification(signedNotification)
+	assertVerificationStatus(t, STALE_SIGNED_DATE, err)
+
+	now = signedDate.Add(-30 * time.Second)
+	_, err = verifier.VerifyAndDecodeNotification(signedNotification)
+	assert.NoError(err, "Slightly in the future, within skew")
+
+	now = signedDate.Add(-31 * time.Second)
+	_, err = verifier.VerifyAndDecodeNotification(signedNotification)
+	assertVerificationStatus(t, STALE_SIGNED_DATE, err)
+
+	now = signedDate.Add(time.Hour)
+	signedRealtimeRequest, err := createSignedDataFromJSON("models/decodedRealtimeRequest.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeRealtimeRequest(signedRealtimeRequest)
+	assertVerificationStatus(t, STALE_SIGNED_DATE, err)
+
+	signedTransaction, err := createSignedDataFromJSON("models/signedTransaction.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	assert.NoError(err, "Transactions aren't checked for freshness")
+
+	_, err = createTestSignedDataVerifierWithOptions(WithEnvironments(ENVIRONMENT_LOCAL_TESTING), WithUnverifiedLocalTesting(), WithFreshness(0, 0))
+	assert.Error(err, "Expected error for zero max age")
+}
+
+func TestReplayStoreRejectsDuplicates(t *testing.T) {
+	assert := assert.New(t)
+	store := NewMemoryReplayStore(time.Hour)
+	verifier, err := createTestSignedDataVerifierWithOptions(
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING), WithUnverifiedLocalTesting(),
+		WithBundleID("com.example"),
+		WithReplayStore(store),
+	)
+	assert.NoError(err, "Failed to create verifier")
+
+	signedNotification, err := createSignedDataFromJSON("models/signedNotification.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeNotification(signedNotification)
+	assert.NoError(err, "First delivery is accepted")
+	_, err = verifier.VerifyAndDecodeNotification(signedNotification)
+	assertVerificationStatus(t, REPLAYED_PAYLOAD, err)
+	assert.Equal("REPLAYED_PAYLOAD", REPLAYED_PAYLOAD.String(), "String")
+
+	anotherNotification, err := createSignedDataFromJSONWithOverrides("models/signedNotification.json", map[string]any{"notificationUUID": "another"})
+	assert.NoError(err, "Failed to create signed data")
+	report, err := verifier.VerifyWithReport(anotherNotification, &ResponseBodyV2DecodedPayload{})
+	assert.NoError(err, "Different notificationUUID is accepted")
+	assert.Equal(OK, report.Status, "Status")
+
+	signedRealtimeRequest, err := createSignedDataFromJSON("models/decodedRealtimeRequest.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeRealtimeRequest(signedRealtimeRequest)
+	assert.NoError(err, "Realtime requests use a separate key")
+	_, err = verifier.VerifyAndDecodeRealtimeRequest(signedRealtimeRequest)
+	assertVerificationStatus(t, REPLAYED_PAYLOAD, err)
+	assert.Equal(3, store.Len(), "Remembered identifiers")
+}
+
+func TestReplayStoreRejectsPayloadsWithoutIdentifier(t *testing.T) {
+	assert := assert.New(t)
+	store := NewMemoryReplayStore(time.Hour)
+	verifier, err := createTestSignedDataVerifierWithOptions(
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING), WithUnverifiedLocalTesting(),
+		WithBundleID("com.example"),
+		WithReplayStore(store),
+	)
+	assert.NoError(err, "Failed to create verifier")
+
+	signedNotification, err := createSignedDataFromJSONWithOverrides("models/signedNotification.json", map[string]any{"notificationUUID": ""})
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeNotification(signedNotification)
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+
+	signedRealtimeRequest, err := createSignedDataFromJSONWithOverrides("models/decodedRealtimeRequest.json", map[string]any{"requestIdentifier": ""})
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeRealtimeRequest(signedRealtimeRequest)
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+	assert.Equal(0, store.Len(), "Empty identifiers aren't recorded")
+}
+
+func TestReplayStoreIsOnlyUpdatedForValidPayloads(t *testing.T) {
+	assert := assert.New(t)
+	store := NewMemoryReplayStore(time.Hour)
+	verifier, err := createTestSignedDataVerifierWithOptions(
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING), WithUnverifiedLocalTesting(),
+		WithBundleID("com.other"),
+		WithReplayStore(store),
+	)
+	assert.NoError(err, "Failed to create verifier")
+
+	signedNotification, err := createSignedDataFromJSON("models/signedNotification.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeNotification(signedNotification)
+	assertVerificationStatus(t, INVALID_APP_IDENTIFIER, err)
+	assert.Equal(0, store.Len(), "Rejected payloads aren't recorded")
+
+	failing, err := createTestSignedDataVerifierWithOptions(
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING), WithUnverifiedLocalTesting(),
+		WithBundleID("com.example"),
+		WithReplayStore(failingReplayStore{}),
+	)
+	assert.NoError(err, "Failed to create verifier")
+	_, err = failing.VerifyAndDecodeNotification(signedNotification)
+	assertVerificationStatus(t, RETRYABLE_VERIFICATION_FAILURE, err)
+}
+
+func TestMemoryReplayStoreExpiry(t *testing.T) {
+	assert := assert.New(t)
+	store := NewMemoryReplayStore(time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	seen, err := store.MarkSeen("a")
+	assert.NoError(err, "MarkSeen failed")
+	assert.False(seen, "First sighting")
+	seen, _ = store.MarkSeen("a")
+	assert.True(seen, "Second sighting")
+
+	now = now.Add(time.Minute)
+	seen, _ = store.MarkSeen("b")
+	assert.False(seen, "First sighting")
+	assert.Equal(1, store.Len(), "Expired identifiers are swept")
+	seen, _ = store.MarkSeen("a")
+	assert.False(seen, "Forgotten after the TTL")
+}
+
+func TestMemoryReplayStoreConcurrentMarkSeen(t *testing.T) {
+	store := NewMemoryReplayStore(time.Minute)
+	var firsts atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if seen, _ := store.MarkSeen("id"); !seen {
+				firsts.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), firsts.Load(), "Exactly one first sighting")
+}
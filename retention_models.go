@@ -1,5 +1,7 @@
 package appstore
 
+import "encoding/json"
+
 // DefaultConfigurationRequest is the request body that contains the default configuration information.
 //
 // https://developer.apple.com/documentation/retentionmessaging/defaultconfigurationrequest
@@ -226,4 +228,19 @@ type DecodedRealtimeRequestBody struct {
 	//
 	// https://developer.apple.com/documentation/retentionmessaging/environment
 	Environment Environment `json:"environment"`
+
+	// Properties of the payload that this library doesn't model yet, keyed by their JSON name.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// UnmarshalJSON decodes the payload, keeping unrecognized properties in Extra.
+func (p *DecodedRealtimeRequestBody) UnmarshalJSON(data []byte) error {
+	type plain DecodedRealtimeRequestBody
+	return unmarshalWithExtra(data, (*plain)(p), &p.Extra)
+}
+
+// MarshalJSON encodes the payload, including the properties in Extra.
+func (p DecodedRealtimeRequestBody) MarshalJSON() ([]byte, error) {
+	type plain DecodedRealtimeRequestBody
+	return marshalWithExtra(plain(p), p.Extra)
 }
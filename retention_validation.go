@@ -0,0 +1,266 @@
+package appstore
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits the App Store applies to retention messaging content.
+//
+// https://developer.apple.com/documentation/retentionmessaging/upload-image
+// https://developer.apple.com/documentation/retentionmessaging/uploadmessagerequestbody
+const (
+	RetentionImageWidth       = 3840
+	RetentionImageHeight      = 2160
+	RetentionImageMaxBytes    = 5 * 1024 * 1024
+	RetentionHeaderMaxLength  = 66
+	RetentionBodyMaxLength    = 144
+	RetentionAltTextMaxLength = 150
+)
+
+const retentionMessageFieldImage = "image"
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// ValidationViolation describes a single problem found while validating a request locally.
+type ValidationViolation struct {
+	// The name of the field that failed validation.
+	Field string
+
+	// The API error the App Store server would most likely return for this problem.
+	APIError APIError
+
+	// A human-readable description of the problem.
+	Message string
+}
+
+func (v ValidationViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Field, v.Message)
+}
+
+// ValidationException is an error that indicates a request failed local validation before it was sent.
+// It lists every violation found, not only the first one.
+type ValidationException struct {
+	Violations []ValidationViolation
+}
+
+func (e *ValidationException) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return fmt.Sprintf("Validation failed: %s", strings.Join(messages, "; "))
+}
+
+// HasAPIError returns true if any violation corresponds to the given API error.
+func (e *ValidationException) HasAPIError(apiError APIError) bool {
+	for _, v := range e.Violations {
+		if v.APIError == apiError {
+			return true
+		}
+	}
+	return false
+}
+
+type validator struct {
+	violations []ValidationViolation
+}
+
+func (v *validator) add(field string, apiError APIError, format string, args ...any) {
+	v.violations = append(v.violations, ValidationViolation{
+		Field:    field,
+		APIError: apiError,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) maxLength(field, value string, limit int, apiError APIError) {
+	if n := utf8.RuneCountInString(value); n > limit {
+		v.add(field, apiError, "length %d exceeds the maximum of %d characters", n, limit)
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return &ValidationException{Violations: v.violations}
+}
+
+// ValidateRetentionImage checks that an image meets the Retention Messaging API requirements:
+// a PNG file of exactly 3840x2160 pixels that doesn't exceed 5 MB, as documented for the Upload Image endpoint.
+// It returns a *ValidationException that lists every problem found.
+//
+// https://developer.apple.com/documentation/retentionmessaging/upload-image
+func ValidateRetentionImage(image []byte) error {
+	v := &validator{}
+	if len(image) > RetentionImageMaxBytes {
+		v.add(retentionMessageFieldImage, API_ERROR_INVALID_IMAGE, "size %d bytes exceeds the maximum of %d bytes", len(image), RetentionImageMaxBytes)
+	}
+	if !bytes.HasPrefix(image, pngSignature) {
+		v.add(retentionMessageFieldImage, API_ERROR_INVALID_IMAGE, "not a PNG file")
+		return v.err()
+	}
+	config, err := png.DecodeConfig(bytes.NewReader(image))
+	if err != nil {
+		v.add(retentionMessageFieldImage, API_ERROR_INVALID_IMAGE, "malformed PNG: %v", err)
+		return v.err()
+	}
+	if config.Width != RetentionImageWidth || config.Height != RetentionImageHeight {
+		v.add(retentionMessageFieldImage, API_ERROR_INVALID_IMAGE, "dimensions %dx%d, expected %dx%d", config.Width, config.Height, RetentionImageWidth, RetentionImageHeight)
+	}
+	return v.err()
+}
+
+// Validate checks the header, body, and image alternative text against the Retention Messaging API length limits.
+// It returns a *ValidationException that lists every problem found.
+//
+// https://developer.apple.com/documentation/retentionmessaging/uploadmessagerequestbody
+func (b UploadMessageRequestBody) Validate() error {
+	v := &validator{}
+	v.maxLength("header", b.Header, RetentionHeaderMaxLength, API_ERROR_HEADER_TOO_LONG)
+	v.maxLength("body", b.Body, RetentionBodyMaxLength, API_ERROR_BODY_TOO_LONG)
+	if b.Image != nil {
+		v.maxLength("image.altText", b.Image.AltText, RetentionAltTextMaxLength, API_ERROR_ALT_TEXT_TOO_LONG)
+	}
+	return v.err()
+}
+
+// ValidateLocale checks that a locale is a syntactically valid BCP 47 language tag, such as en-US, zh-Hant-TW, or zh-yue.
+// It returns a *ValidationException describing the problem.
+//
+// https://developer.apple.com/documentation/retentionmessaging/locale
+func ValidateLocale(locale string) error {
+	v := &validator{}
+	if !isBCP47LanguageTag(locale) {
+		v.add("locale", API_ERROR_INVALID_LOCALE, "%q is not a valid BCP 47 language tag", locale)
+	}
+	return v.err()
+}
+
+// grandfatheredTags are the tags RFC 5646 accepts only as a whole, in lower case.
+var grandfatheredTags = map[string]bool{
+	"en-gb-oed": true, "i-ami": true, "i-bnn": true, "i-default": true, "i-enochian": true, "i-hak": true,
+	"i-klingon": true, "i-lux": true, "i-mingo": true, "i-navajo": true, "i-pwn": true, "i-tao": true,
+	"i-tay": true, "i-tsu": true, "sgn-be-fr": true, "sgn-be-nl": true, "sgn-ch-de": true,
+	"art-lojban": true, "cel-gaulish": true, "no-bok": true, "no-nyn": true, "zh-guoyu": true,
+	"zh-hakka": true, "zh-min": true, "zh-min-nan": true, "zh-xiang": true,
+}
+
+// isBCP47LanguageTag performs a syntax-only check of the Language-Tag production in RFC 5646:
+// a langtag, a privateuse tag, or a grandfathered tag, where
+// langtag = language ["-" script] ["-" region] *("-" variant) *("-" extension) ["-" privateuse]
+// and language = 2*3ALPHA ["-" extlang] / 4ALPHA / 5*8ALPHA.
+func isBCP47LanguageTag(tag string) bool {
+	if tag == "" {
+		return false
+	}
+	if grandfatheredTags[strings.ToLower(tag)] {
+		return true
+	}
+	subtags := strings.Split(tag, "-")
+	if isPrivateUseSingleton(subtags[0]) {
+		return isPrivateUse(subtags[1:])
+	}
+	i := 0
+
+	// language: 2*3ALPHA or 4ALPHA or 5*8ALPHA
+	l := len(subtags[i])
+	if !isAlpha(subtags[i]) || l < 2 || l > 8 {
+		return false
+	}
+	i++
+
+	// extlang: 3ALPHA *2("-" 3ALPHA), only after a 2 or 3 letter language
+	if l <= 3 {
+		for n := 0; n < 3 && i < len(subtags) && len(subtags[i]) == 3 && isAlpha(subtags[i]); n++ {
+			i++
+		}
+	}
+
+	// script: 4ALPHA
+	if i < len(subtags) && len(subtags[i]) == 4 && isAlpha(subtags[i]) {
+		i++
+	}
+
+	// region: 2ALPHA or 3DIGIT
+	if i < len(subtags) && ((len(subtags[i]) == 2 && isAlpha(subtags[i])) || (len(subtags[i]) == 3 && isDigit(subtags[i]))) {
+		i++
+	}
+
+	// variant: 5*8alphanum or (DIGIT 3alphanum)
+	for i < len(subtags) && isVariantSubtag(subtags[i]) {
+		i++
+	}
+
+	// extension: singleton 1*("-" (2*8alphanum))
+	for i < len(subtags) && len(subtags[i]) == 1 && !isPrivateUseSingleton(subtags[i]) && isAlphaNum(subtags[i]) {
+		i++
+		start := i
+		for i < len(subtags) && len(subtags[i]) >= 2 && len(subtags[i]) <= 8 && isAlphaNum(subtags[i]) {
+			i++
+		}
+		if i == start {
+			return false
+		}
+	}
+
+	// privateuse: "x" 1*("-" (1*8alphanum))
+	if i < len(subtags) && isPrivateUseSingleton(subtags[i]) {
+		return isPrivateUse(subtags[i+1:])
+	}
+
+	return i == len(subtags)
+}
+
+func isPrivateUseSingleton(s string) bool {
+	return s == "x" || s == "X"
+}
+
+// isPrivateUse checks the subtags that follow the "x" singleton: 1*("-" (1*8alphanum)).
+func isPrivateUse(subtags []string) bool {
+	for _, subtag := range subtags {
+		if len(subtag) > 8 || !isAlphaNum(subtag) {
+			return false
+		}
+	}
+	return len(subtags) > 0
+}
+
+func isVariantSubtag(s string) bool {
+	if !isAlphaNum(s) {
+		return false
+	}
+	return (len(s) >= 5 && len(s) <= 8) || (len(s) == 4 && s[0] >= '0' && s[0] <= '9')
+}
+
+func isAlpha(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isDigit(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isAlphaNum(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isAlpha(s[i:i+1]) && !isDigit(s[i:i+1]) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,133 @@
+package appstore
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestPNG encodes a blank grayscale PNG with the given dimensions
+func createTestPNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)))
+	assert.NoError(t, err, "Failed to encode PNG")
+	return buf.Bytes()
+}
+
+func TestValidateRetentionImage(t *testing.T) {
+	assert := assert.New(t)
+	err := ValidateRetentionImage(createTestPNG(t, RetentionImageWidth, RetentionImageHeight))
+	assert.NoError(err, "Expected valid image")
+}
+
+func TestValidateRetentionImage_NotPNG(t *testing.T) {
+	assert := assert.New(t)
+	err := ValidateRetentionImage([]byte("fake-image-data"))
+	vErr, ok := err.(*ValidationException)
+	assert.True(ok, "Expected ValidationException")
+	assert.Equal(1, len(vErr.Violations), "Violations")
+	assert.True(vErr.HasAPIError(API_ERROR_INVALID_IMAGE), "API_ERROR_INVALID_IMAGE")
+}
+
+func TestValidateRetentionImage_WrongDimensions(t *testing.T) {
+	assert := assert.New(t)
+	err := ValidateRetentionImage(createTestPNG(t, 100, 50))
+	vErr, ok := err.(*ValidationException)
+	assert.True(ok, "Expected ValidationException")
+	assert.True(strings.Contains(vErr.Error(), "100x50"), "Error mentions dimensions")
+}
+
+func TestValidateRetentionImage_Malformed(t *testing.T) {
+	assert := assert.New(t)
+	err := ValidateRetentionImage(append(append([]byte{}, pngSignature...), 0, 1, 2))
+	vErr, ok := err.(*ValidationException)
+	assert.True(ok, "Expected ValidationException")
+	assert.True(strings.Contains(vErr.Error(), "malformed PNG"), "Error mentions malformed PNG")
+}
+
+func TestUploadMessageRequestBodyValidate(t *testing.T) {
+	assert := assert.New(t)
+	body := UploadMessageRequestBody{
+		Header: strings.Repeat("h", RetentionHeaderMaxLength),
+		Body:   strings.Repeat("é", RetentionBodyMaxLength),
+		Image: &UploadMessageImage{
+			ImageIdentifier: "img_123",
+			AltText:         strings.Repeat("a", RetentionAltTextMaxLength),
+		},
+	}
+	assert.NoError(body.Validate(), "Expected valid message at the limits")
+}
+
+func TestUploadMessageRequestBodyValidate_ReportsEveryViolation(t *testing.T) {
+	assert := assert.New(t)
+	body := UploadMessageRequestBody{
+		Header: strings.Repeat("h", RetentionHeaderMaxLength+1),
+		Body:   strings.Repeat("b", RetentionBodyMaxLength+1),
+		Image: &UploadMessageImage{
+			ImageIdentifier: "img_123",
+			AltText:         strings.Repeat("a", RetentionAltTextMaxLength+1),
+		},
+	}
+	err := body.Validate()
+	vErr, ok := err.(*ValidationException)
+	assert.True(ok, "Expected ValidationException")
+	assert.Equal(3, len(vErr.Violations), "Violations")
+	assert.True(vErr.HasAPIError(API_ERROR_HEADER_TOO_LONG), "API_ERROR_HEADER_TOO_LONG")
+	assert.True(vErr.HasAPIError(API_ERROR_BODY_TOO_LONG), "API_ERROR_BODY_TOO_LONG")
+	assert.True(vErr.HasAPIError(API_ERROR_ALT_TEXT_TOO_LONG), "API_ERROR_ALT_TEXT_TOO_LONG")
+	assert.Equal("header", vErr.Violations[0].Field, "Field")
+}
+
+func TestValidateLocale(t *testing.T) {
+	assert := assert.New(t)
+	for _, locale := range []string{"en", "en-US", "zh-Hant-TW", "es-419", "de-CH-1996", "en-US-u-ca-gregory", "en-x-private", "sr-Latn",
+		"zh-yue", "zh-cmn-Hans-CN", "zh-yue-HK", "x-whatever", "i-klingon", "zh-min-nan"} {
+		assert.NoError(ValidateLocale(locale), "Expected valid locale "+locale)
+	}
+	for _, locale := range []string{"", "e", "en_US", "englishes-US", "en-", "en-US-", "en-u", "en-x", "123", "en--US",
+		"zh-yue-cmn-abc-def", "english-yue", "x", "x-toolongsubtag"} {
+		err := ValidateLocale(locale)
+		vErr, ok := err.(*ValidationException)
+		assert.True(ok, "Expected ValidationException for "+locale)
+		if ok {
+			assert.True(vErr.HasAPIError(API_ERROR_INVALID_LOCALE), "API_ERROR_INVALID_LOCALE")
+		}
+	}
+}
+
+func TestUploadImage_InvalidImageNotSent(t *testing.T) {
+	assert := assert.New(t)
+	client := createMockAPIClient(t, "", "PUT", "https://local-testing-base-url/inApps/v1/messaging/image/img_123", nil, nil, 204)
+	client.httpClient.(*MockHTTPClient).err = errors.New("request should not be sent")
+
+	err := client.UploadImage("img_123", []byte("fake-image-data"))
+	_, ok := err.(*ValidationException)
+	assert.True(ok, "Expected ValidationException")
+}
+
+func TestUploadMessage_InvalidMessageNotSent(t *testing.T) {
+	assert := assert.New(t)
+	client := createMockAPIClient(t, "", "PUT", "https://local-testing-base-url/inApps/v1/messaging/message/msg_123", nil, nil, 204)
+	client.httpClient.(*MockHTTPClient).err = errors.New("request should not be sent")
+
+	err := client.UploadMessage("msg_123", UploadMessageRequestBody{Header: strings.Repeat("h", 100), Body: "World"})
+	vErr, ok := err.(*ValidationException)
+	assert.True(ok, "Expected ValidationException")
+	assert.True(vErr.HasAPIError(API_ERROR_HEADER_TOO_LONG), "API_ERROR_HEADER_TOO_LONG")
+}
+
+func TestConfigureDefaultMessage_InvalidLocaleNotSent(t *testing.T) {
+	assert := assert.New(t)
+	client := createMockAPIClient(t, "", "PUT", "https://local-testing-base-url/inApps/v1/messaging/default/product_1/en_US", nil, nil, 204)
+	client.httpClient.(*MockHTTPClient).err = errors.New("request should not be sent")
+
+	err := client.ConfigureDefaultMessage("product_1", "en_US", DefaultConfigurationRequest{MessageIdentifier: "msg_123"})
+	vErr, ok := err.(*ValidationException)
+	assert.True(ok, "Expected ValidationException")
+	assert.True(vErr.HasAPIError(API_ERROR_INVALID_LOCALE), "API_ERROR_INVALID_LOCALE")
+}
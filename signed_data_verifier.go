@@ -1,16 +1,17 @@
 package appstore
 
 import (
-	"bytes"
+	"context"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -31,6 +32,9 @@ const (
 	INVALID_CHAIN                  VerificationStatus = 5
 	INVALID_ENVIRONMENT            VerificationStatus = 6
 	RETRYABLE_VERIFICATION_FAILURE VerificationStatus = 7
+	STALE_SIGNED_DATE              VerificationStatus = 8
+	REPLAYED_PAYLOAD               VerificationStatus = 9
+	INCONSISTENT_PAYLOAD           VerificationStatus = 10
 )
 
 func (s VerificationStatus) String() string {
@@ -51,6 +55,12 @@ func (s VerificationStatus) String() string {
 		return "INVALID_ENVIRONMENT"
 	case RETRYABLE_VERIFICATION_FAILURE:
 		return "RETRYABLE_VERIFICATION_FAILURE"
+	case STALE_SIGNED_DATE:
+		return "STALE_SIGNED_DATE"
+	case REPLAYED_PAYLOAD:
+		return "REPLAYED_PAYLOAD"
+	case INCONSISTENT_PAYLOAD:
+		return "INCONSISTENT_PAYLOAD"
 	default:
 		return fmt.Sprintf("UNKNOWN(%d)", s)
 	}
@@ -66,6 +76,10 @@ func (e *VerificationException) Error() string {
 	return fmt.Sprintf("Verification failed with status %s: %v", e.Status, e.Err)
 }
 
+func (e *VerificationException) Unwrap() error {
+	return e.Err
+}
+
 // NewVerificationException creates a new verification exception with the given status and error.
 func NewVerificationException(status VerificationStatus, err error) *VerificationException {
 	return &VerificationException{Status: status, Err: err}
@@ -73,34 +87,41 @@ func NewVerificationException(status VerificationStatus, err error) *Verificatio
 
 // SignedDataVerifier provides utility methods for verifying and decoding App Store signed data.
 type SignedDataVerifier struct {
-	chainVerifier       *chainVerifier
-	environment         Environment
-	bundleID            string
-	appAppleID          int64
-	enableOnlineChecks  bool
-	allowAnyEnvironment bool
+	chainVerifier          *chainVerifier
+	environment            Environment
+	environments           []Environment
+	bundleID               string
+	appAppleID             int64
+	enableOnlineChecks     bool
+	allowAnyEnvironment    bool
+	effectiveDatePolicy    EffectiveDatePolicy
+	strictDecoding         bool
+	localRoots             *x509.CertPool
+	unverifiedLocalTesting bool
+	freshness              *freshnessPolicy
+	replayStore            ReplayStore
+	now                    func() time.Time
 }
 
 // NewSignedDataVerifier creates a new SignedDataVerifier for verifying App Store signed data.
 // The appAppleID is required when the environment is Production.
 //
+// For the Xcode and LocalTesting environments it returns an error, where earlier versions returned a verifier that
+// skipped signature verification. Use NewSignedDataVerifierWithOptions with WithLocalTestCertificates or
+// WithUnverifiedLocalTesting instead.
+//
 // See https://developer.apple.com/documentation/appstoreserverapi
 func NewSignedDataVerifier(rootCertificates [][]byte, enableOnlineChecks bool, environment Environment, bundleID string, appAppleID int64) (*SignedDataVerifier, error) {
-	if environment == ENVIRONMENT_PRODUCTION && appAppleID == 0 {
-		return nil, errors.New("appAppleId is required when the environment is Production")
-	}
-
-	cv, err := newChainVerifier(rootCertificates)
-	if err != nil {
-		return nil, err
-	}
-	return &SignedDataVerifier{
-		chainVerifier:      cv,
-		environment:        environment,
-		bundleID:           bundleID,
-		appAppleID:         appAppleID,
-		enableOnlineChecks: enableOnlineChecks,
-	}, nil
+	policy := ONLINE_CHECK_POLICY_DISABLED
+	if enableOnlineChecks {
+		policy = ONLINE_CHECK_POLICY_ENABLED
+	}
+	return NewSignedDataVerifierWithOptions(rootCertificates,
+		WithEnvironments(environment),
+		WithBundleID(bundleID),
+		WithAppAppleID(appAppleID),
+		WithOnlineCheckPolicy(policy),
+	)
 }
 
 // VerifyAndDecodeRenewalInfo verifies and decodes a signedRenewalInfo obtained from the App Store Server API,
@@ -109,46 +130,60 @@ func NewSignedDataVerifier(rootCertificates [][]byte, enableOnlineChecks bool, e
 // See https://developer.apple.com/documentation/appstoreserverapi/jwsrenewalinfo
 func (v *SignedDataVerifier) VerifyAndDecodeRenewalInfo(signedRenewalInfo string) (*JWSRenewalInfoDecodedPayload, error) {
 	payload := &JWSRenewalInfoDecodedPayload{}
-	if err := v.decodeSignedObject(signedRenewalInfo, payload); err != nil {
+	if _, err := v.decodeSignedObject(signedRenewalInfo, payload, nil); err != nil {
 		return nil, err
 	}
-	if payload.Environment != v.environment && !v.allowAnyEnvironment {
-		return nil, NewVerificationException(INVALID_ENVIRONMENT, errors.New("environment mismatch"))
+	if err := v.verifyDecoded(payload, nil); err != nil {
+		return nil, err
 	}
 	return payload, nil
 }
 
+func renewalInfoIdentity(payload *JWSRenewalInfoDecodedPayload) payloadIdentity {
+	return payloadIdentity{environment: payload.Environment}
+}
+
 // VerifyAndDecodeSignedTransaction verifies and decodes a signedTransaction obtained from the App Store Server API,
 // an App Store Server Notification, or from a device.
 //
 // See https://developer.apple.com/documentation/appstoreserverapi/jwstransaction
 func (v *SignedDataVerifier) VerifyAndDecodeSignedTransaction(signedTransaction string) (*JWSTransactionDecodedPayload, error) {
 	payload := &JWSTransactionDecodedPayload{}
-	if err := v.decodeSignedObject(signedTransaction, payload); err != nil {
+	if _, err := v.decodeSignedObject(signedTransaction, payload, nil); err != nil {
 		return nil, err
 	}
-	if payload.BundleId != v.bundleID {
-		return nil, NewVerificationException(INVALID_APP_IDENTIFIER, errors.New("bundleId mismatch"))
-	}
-	if payload.Environment != v.environment && !v.allowAnyEnvironment {
-		return nil, NewVerificationException(INVALID_ENVIRONMENT, errors.New("environment mismatch"))
+	if err := v.verifyDecoded(payload, nil); err != nil {
+		return nil, err
 	}
 	return payload, nil
 }
 
+func transactionIdentity(payload *JWSTransactionDecodedPayload) payloadIdentity {
+	return payloadIdentity{hasBundleID: true, bundleID: payload.BundleId, environment: payload.Environment}
+}
+
 // VerifyAndDecodeNotification verifies and decodes an App Store Server Notification signedPayload.
 //
 // See https://developer.apple.com/documentation/appstoreservernotifications/signedpayload
 func (v *SignedDataVerifier) VerifyAndDecodeNotification(signedPayload string) (*ResponseBodyV2DecodedPayload, error) {
 	payload := &ResponseBodyV2DecodedPayload{}
-	if err := v.decodeSignedObject(signedPayload, payload); err != nil {
+	if _, err := v.decodeSignedObject(signedPayload, payload, nil); err != nil {
 		return nil, err
 	}
+	if err := v.verifyDecoded(payload, nil); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
 
-	var bundleID string
-	var appAppleID int64
-	var environment Environment
+func notificationIdentity(payload *ResponseBodyV2DecodedPayload) payloadIdentity {
+	bundleID, appAppleID, environment := notificationAppIdentifier(payload)
+	return payloadIdentity{hasBundleID: true, bundleID: bundleID, hasAppAppleID: true, appAppleID: &appAppleID, environment: environment}
+}
 
+// notificationAppIdentifier returns the app and environment a notification was sent for,
+// from whichever of its data, summary, external purchase token, or app data fields is present.
+func notificationAppIdentifier(payload *ResponseBodyV2DecodedPayload) (bundleID string, appAppleID int64, environment Environment) {
 	switch {
 	case payload.Data != nil:
 		bundleID = payload.Data.BundleId
@@ -171,21 +206,66 @@ func (v *SignedDataVerifier) VerifyAndDecodeNotification(signedPayload string) (
 		appAppleID = payload.AppData.AppAppleId
 		environment = payload.AppData.Environment
 	}
+	return bundleID, appAppleID, environment
+}
 
-	if err := v.verifyNotification(bundleID, appAppleID, environment); err != nil {
-		return nil, err
+// payloadIdentity holds the fields of a decoded payload that identify the app and environment it was signed for.
+type payloadIdentity struct {
+	hasBundleID   bool
+	bundleID      string
+	hasAppAppleID bool
+	appAppleID    *int64
+	environment   Environment
+}
+
+// checkIdentity checks a payload's bundle ID, App Apple ID and environment against the verifier's configuration,
+// recording each check in report if it isn't nil.
+func (v *SignedDataVerifier) checkIdentity(identity payloadIdentity, report *VerificationReport) error {
+	if identity.hasBundleID {
+		passed := identity.bundleID == v.bundleID
+		report.addCheck(IDENTITY_CHECK_BUNDLE_ID, v.bundleID, identity.bundleID, passed)
+		if !passed {
+			return NewVerificationException(INVALID_APP_IDENTIFIER, errors.New("bundleId mismatch"))
+		}
 	}
-	return payload, nil
+	if identity.hasAppAppleID && v.requiresAppAppleID(identity.environment) {
+		actual := ""
+		if identity.appAppleID != nil {
+			actual = strconv.FormatInt(*identity.appAppleID, 10)
+		}
+		passed := identity.appAppleID != nil && *identity.appAppleID == v.appAppleID
+		report.addCheck(IDENTITY_CHECK_APP_APPLE_ID, strconv.FormatInt(v.appAppleID, 10), actual, passed)
+		if !passed {
+			return NewVerificationException(INVALID_APP_IDENTIFIER, errors.New("app identifier mismatch"))
+		}
+	}
+	return v.verifyEnvironment(identity.environment, report)
 }
 
-func (v *SignedDataVerifier) verifyNotification(bundleID string, appAppleID int64, environment Environment) error {
-	if bundleID != v.bundleID || (v.environment == ENVIRONMENT_PRODUCTION && appAppleID != v.appAppleID) {
-		return NewVerificationException(INVALID_APP_IDENTIFIER, errors.New("app identifier mismatch"))
+// verifyEnvironment checks an environment against the primary and allowed environments.
+func (v *SignedDataVerifier) verifyEnvironment(environment Environment, report *VerificationReport) error {
+	passed := v.allowAnyEnvironment || environment == v.environment || slices.Contains(v.environments, environment)
+	expected := "*"
+	if !v.allowAnyEnvironment {
+		names := make([]string, 0, len(v.environments)+1)
+		for _, env := range append([]Environment{v.environment}, v.environments...) {
+			if !slices.Contains(names, string(env)) {
+				names = append(names, string(env))
+			}
+		}
+		expected = strings.Join(names, ",")
 	}
-	if environment != v.environment && !v.allowAnyEnvironment {
-		return NewVerificationException(INVALID_ENVIRONMENT, errors.New("environment mismatch"))
+	report.addCheck(IDENTITY_CHECK_ENVIRONMENT, expected, string(environment), passed)
+	if passed {
+		return nil
 	}
-	return nil
+	return NewVerificationException(INVALID_ENVIRONMENT, errors.New("environment mismatch"))
+}
+
+// requiresAppAppleID reports whether data from the environment must carry the configured App Apple ID.
+// This is always the case for a Production verifier, and for Production data when an App Apple ID is configured.
+func (v *SignedDataVerifier) requiresAppAppleID(environment Environment) bool {
+	return v.environment == ENVIRONMENT_PRODUCTION || (environment == ENVIRONMENT_PRODUCTION && v.appAppleID != 0)
 }
 
 // VerifyAndDecodeAppTransaction verifies and decodes a signed AppTransaction.
@@ -193,107 +273,280 @@ func (v *SignedDataVerifier) verifyNotification(bundleID string, appAppleID int6
 // See https://developer.apple.com/documentation/storekit/apptransaction
 func (v *SignedDataVerifier) VerifyAndDecodeAppTransaction(signedAppTransaction string) (*AppTransaction, error) {
 	payload := &AppTransaction{}
-	if err := v.decodeSignedObject(signedAppTransaction, payload); err != nil {
+	if _, err := v.decodeSignedObject(signedAppTransaction, payload, nil); err != nil {
 		return nil, err
 	}
-	environment := payload.ReceiptType
-	if payload.BundleId != v.bundleID || (v.environment == ENVIRONMENT_PRODUCTION && (payload.AppAppleId == nil || *payload.AppAppleId != v.appAppleID)) {
-		return nil, NewVerificationException(INVALID_APP_IDENTIFIER, errors.New("app identifier mismatch"))
-	}
-	if environment != v.environment {
-		return nil, NewVerificationException(INVALID_ENVIRONMENT, errors.New("environment mismatch"))
+	if err := v.verifyDecoded(payload, nil); err != nil {
+		return nil, err
 	}
 	return payload, nil
 }
 
+func appTransactionIdentity(payload *AppTransaction) payloadIdentity {
+	return payloadIdentity{hasBundleID: true, bundleID: payload.BundleId, hasAppAppleID: true, appAppleID: payload.AppAppleId, environment: payload.ReceiptType}
+}
+
 // VerifyAndDecodeRealtimeRequest verifies and decodes a Retention Messaging API signedPayload.
 //
 // See https://developer.apple.com/documentation/retentionmessaging/signedpayload
 func (v *SignedDataVerifier) VerifyAndDecodeRealtimeRequest(signedPayload string) (*DecodedRealtimeRequestBody, error) {
 	payload := &DecodedRealtimeRequestBody{}
-	if err := v.decodeSignedObject(signedPayload, payload); err != nil {
+	if _, err := v.decodeSignedObject(signedPayload, payload, nil); err != nil {
 		return nil, err
 	}
-	if v.environment == ENVIRONMENT_PRODUCTION && payload.AppAppleId != v.appAppleID {
-		return nil, NewVerificationException(INVALID_APP_IDENTIFIER, errors.New("app identifier mismatch"))
-	}
-	if payload.Environment != v.environment {
-		return nil, NewVerificationException(INVALID_ENVIRONMENT, errors.New("environment mismatch"))
+	if err := v.verifyDecoded(payload, nil); err != nil {
+		return nil, err
 	}
 	return payload, nil
 }
 
-func (v *SignedDataVerifier) decodeSignedObject(signedObj string, destination any) error {
-	claims := jwt.MapClaims{}
-	var err error
-	if v.environment == ENVIRONMENT_XCODE || v.environment == ENVIRONMENT_LOCAL_TESTING {
-		_, _, err = new(jwt.Parser).ParseUnverified(signedObj, &claims)
-	} else {
-		_, err = jwt.ParseWithClaims(signedObj, &claims, func(token *jwt.Token) (any, error) {
-			x5c, ok := token.Header["x5c"].([]any)
-			if !ok || len(x5c) == 0 {
-				return nil, errors.New("x5c header is missing or empty")
-			}
+func realtimeRequestIdentity(payload *DecodedRealtimeRequestBody) payloadIdentity {
+	return payloadIdentity{hasAppAppleID: true, appAppleID: &payload.AppAppleId, environment: payload.Environment}
+}
 
-			certs := make([]string, len(x5c))
-			for i, v := range x5c {
-				certs[i], ok = v.(string)
-				if !ok {
-					return nil, errors.New("invalid x5c header format")
-				}
-			}
+// VerifyAndDecodeWithValidationTime verifies signedObj and decodes it into destination, which must be a pointer to
+// JWSRenewalInfoDecodedPayload, JWSTransactionDecodedPayload, ResponseBodyV2DecodedPayload, AppTransaction
+// or DecodedRealtimeRequestBody. It applies the same checks as the matching VerifyAndDecode method,
+// and reports the times at which the certificate chain was validated.
+func (v *SignedDataVerifier) VerifyAndDecodeWithValidationTime(signedObj string, destination any) (ValidationTime, error) {
+	if _, err := identityOf(destination); err != nil {
+		return ValidationTime{}, err
+	}
+	validationTime, err := v.decodeSignedObject(signedObj, destination, nil)
+	if err != nil {
+		return validationTime, err
+	}
+	return validationTime, v.verifyDecoded(destination, nil)
+}
 
-			alg, ok := token.Header["alg"].(string)
-			if !ok || alg != "ES256" {
-				return nil, errors.New("invalid algorithm header")
-			}
+// identityOf returns the identity of a decoded payload.
+func identityOf(destination any) (payloadIdentity, error) {
+	switch payload := destination.(type) {
+	case *JWSRenewalInfoDecodedPayload:
+		return renewalInfoIdentity(payload), nil
+	case *JWSTransactionDecodedPayload:
+		return transactionIdentity(payload), nil
+	case *ResponseBodyV2DecodedPayload:
+		return notificationIdentity(payload), nil
+	case *AppTransaction:
+		return appTransactionIdentity(payload), nil
+	case *DecodedRealtimeRequestBody:
+		return realtimeRequestIdentity(payload), nil
+	default:
+		return payloadIdentity{}, fmt.Errorf("unsupported destination type %T", destination)
+	}
+}
 
-			var signedDateMillis int64
-			if sd, ok := claims["signedDate"].(int64); ok {
-				signedDateMillis = sd
-			}
-			if signedDateMillis == 0 {
-				if rcd, ok := claims["receiptCreationDate"].(int64); ok {
-					signedDateMillis = rcd
-				}
-			}
+// verifyDecoded applies the checks that follow signature verification to a decoded payload:
+// identity and environment, then signed date freshness, then replay protection.
+func (v *SignedDataVerifier) verifyDecoded(destination any, report *VerificationReport) error {
+	identity, err := identityOf(destination)
+	if err != nil {
+		return err
+	}
+	if err := v.checkIdentity(identity, report); err != nil {
+		return err
+	}
+	return v.checkFreshnessAndReplay(destination)
+}
 
-			var effectiveDate time.Time
-			if v.enableOnlineChecks || signedDateMillis == 0 {
-				effectiveDate = time.Now()
-			} else {
-				effectiveDate = time.UnixMilli(signedDateMillis)
-			}
+// jwsHeader holds the JWS header fields used for verification.
+type jwsHeader struct {
+	Alg string   `json:"alg"`
+	X5c []string `json:"x5c"`
+}
 
-			publicKey, err := v.chainVerifier.verifyChain(certs, v.enableOnlineChecks, effectiveDate)
-			if err != nil {
-				return nil, err
-			}
+// signingTimeClaims holds the claims that carry the signing time of signed data.
+type signingTimeClaims struct {
+	SignedDate          Timestamp `json:"signedDate"`
+	ReceiptCreationDate Timestamp `json:"receiptCreationDate"`
+}
+
+// decodeSignedObject verifies signedObj and unmarshals its payload segment directly into destination,
+// so numbers keep their full precision. The destination is only written once the signature has been verified.
+func (v *SignedDataVerifier) decodeSignedObject(signedObj string, destination any, report *VerificationReport) (ValidationTime, error) {
+	return v.decodeSignedObjectContext(context.Background(), signedObj, destination, report)
+}
 
-			return publicKey, nil
-		}, jwt.WithValidMethods([]string{"ES256"}))
+// decodeSignedObjectContext is decodeSignedObject, giving up with RETRYABLE_VERIFICATION_FAILURE if ctx is done
+// while it waits for a concurrent verification of the same chain.
+func (v *SignedDataVerifier) decodeSignedObjectContext(ctx context.Context, signedObj string, destination any, report *VerificationReport) (ValidationTime, error) {
+	var validationTime ValidationTime
+	headerSegment, payloadSegment, signatureSegment, err := splitJWS(signedObj)
+	if err != nil {
+		return validationTime, NewVerificationException(VERIFICATION_FAILURE, err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadSegment)
+	if err != nil {
+		return validationTime, NewVerificationException(VERIFICATION_FAILURE, fmt.Errorf("invalid payload encoding: %w", err))
+	}
+
+	switch {
+	case !isLocalEnvironment(v.environment):
+		validationTime, err = v.verifySignature(ctx, headerSegment, payloadSegment, signatureSegment, payload, report)
+	case !v.unverifiedLocalTesting:
+		validationTime, err = v.verifyLocalSignature(headerSegment, payloadSegment, signatureSegment, payload, report)
+	}
+	if err != nil {
+		var vErr *VerificationException
+		if errors.As(err, &vErr) && vErr.Status == RETRYABLE_VERIFICATION_FAILURE {
+			// Keep the status, so callers know to try again later
+			return validationTime, err
+		}
+		return validationTime, NewVerificationException(VERIFICATION_FAILURE, err)
+	}
+	if isLocalEnvironment(v.environment) {
+		// Local test certificates can be exported from Xcode, so they mustn't vouch for other environments
+		if err := checkLocalPayloadEnvironment(payload); err != nil {
+			return validationTime, err
+		}
+	}
+
+	if !v.strictDecoding {
+		if err := json.Unmarshal(payload, destination); err != nil {
+			return validationTime, NewVerificationException(VERIFICATION_FAILURE, err)
+		}
+		return validationTime, nil
+	}
+	fields, err := decodeStrict(payload, destination)
+	if err != nil {
+		return validationTime, NewVerificationException(VERIFICATION_FAILURE, err)
+	}
+	if len(fields) > 0 {
+		return validationTime, &UnknownFieldsError{Fields: fields}
+	}
+	return validationTime, nil
+}
+
+// splitJWS splits a compact JWS into its header, payload and signature segments.
+func splitJWS(signedObj string) (header, payload, signature string, err error) {
+	header, rest, ok := strings.Cut(signedObj, ".")
+	if ok {
+		payload, signature, ok = strings.Cut(rest, ".")
+	}
+	if !ok || strings.Contains(signature, ".") {
+		return "", "", "", errors.New("token is malformed")
+	}
+	return header, payload, signature, nil
+}
+
+// parseJWS decodes the header and signature segments of a JWS, which must be signed with ES256 and carry an x5c chain.
+func parseJWS(headerSegment, signatureSegment string) (jwsHeader, []byte, error) {
+	var header jwsHeader
+	headerJSON, err := base64.RawURLEncoding.DecodeString(headerSegment)
+	if err != nil {
+		return header, nil, fmt.Errorf("invalid header encoding: %w", err)
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return header, nil, errors.New("invalid x5c header format")
+	}
+	if len(header.X5c) == 0 {
+		return header, nil, errors.New("x5c header is missing or empty")
+	}
+	if header.Alg != "ES256" {
+		return header, nil, errors.New("invalid algorithm header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(signatureSegment)
+	if err != nil {
+		return header, nil, fmt.Errorf("invalid signature encoding: %w", err)
 	}
+	return header, signature, nil
+}
 
+// verifySignature verifies the certificate chain in the header and the ES256 signature over the header and payload.
+func (v *SignedDataVerifier) verifySignature(ctx context.Context, headerSegment, payloadSegment, signatureSegment string, payload []byte, report *VerificationReport) (ValidationTime, error) {
+	header, signature, err := parseJWS(headerSegment, signatureSegment)
 	if err != nil {
-		return NewVerificationException(VERIFICATION_FAILURE, err)
+		return ValidationTime{}, err
 	}
 
-	data, err := json.Marshal(claims)
+	signingTime, source, err := signingTimeOf(payload)
+	if err != nil {
+		return ValidationTime{}, err
+	}
+	validationTime, publicKey, err := v.verifyChainForSigningTime(ctx, header.X5c, signingTime, source, report)
 	if err != nil {
-		return NewVerificationException(VERIFICATION_FAILURE, err)
+		return validationTime, err
+	}
+	if err := jwt.SigningMethodES256.Verify(headerSegment+"."+payloadSegment, signature, publicKey); err != nil {
+		return validationTime, err
 	}
-	return json.Unmarshal(data, destination)
+	return validationTime, nil
 }
 
-type cacheEntry struct {
-	publicKey *ecdsa.PublicKey
-	expiry    time.Time
+// verifyChainForSigningTime validates the certificate chain at the times chosen by the effective date policy.
+// Revocation is only ever checked at the current time.
+func (v *SignedDataVerifier) verifyChainForSigningTime(ctx context.Context, certs []string, signingTime time.Time, source SigningTimeSource, report *VerificationReport) (ValidationTime, *ecdsa.PublicKey, error) {
+	validationTime := ValidationTime{Policy: v.effectiveDatePolicy}
+
+	atSigningTime, atCurrentTime := false, false
+	switch v.effectiveDatePolicy {
+	case EFFECTIVE_DATE_POLICY_SIGNING_TIME:
+		atSigningTime = true
+	case EFFECTIVE_DATE_POLICY_CURRENT_TIME:
+		atCurrentTime = true
+	case EFFECTIVE_DATE_POLICY_BOTH:
+		atSigningTime, atCurrentTime = true, true
+	default:
+		atSigningTime = !v.enableOnlineChecks && source != SIGNING_TIME_SOURCE_NONE
+		atCurrentTime = !atSigningTime
+	}
+	if atSigningTime && source == SIGNING_TIME_SOURCE_NONE {
+		return validationTime, nil, NewVerificationException(VERIFICATION_FAILURE, errors.New("signed data has no signing time"))
+	}
+
+	var publicKey *ecdsa.PublicKey
+	var err error
+	if atSigningTime {
+		validationTime.SigningTime = signingTime
+		validationTime.SigningTimeSource = source
+		// Revocation is checked below when the chain is also validated at the current time
+		publicKey, err = v.chainVerifier.verifyChainWithReport(ctx, certs, v.enableOnlineChecks && !atCurrentTime, signingTime, report)
+		if err != nil {
+			return validationTime, nil, err
+		}
+	}
+	if atCurrentTime {
+		validationTime.CurrentTime = v.now()
+		publicKey, err = v.chainVerifier.verifyChainWithReport(ctx, certs, v.enableOnlineChecks, validationTime.CurrentTime, report)
+		if err != nil {
+			return validationTime, nil, err
+		}
+	}
+	return validationTime, publicKey, nil
+}
+
+// signingTimeOf reads the signedDate claim, or the receiptCreationDate claim of an AppTransaction without one,
+// from a JSON payload.
+func signingTimeOf(payload []byte) (time.Time, SigningTimeSource, error) {
+	var claims signingTimeClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, SIGNING_TIME_SOURCE_NONE, fmt.Errorf("invalid payload: %w", err)
+	}
+	if claims.SignedDate > 0 {
+		return claims.SignedDate.Time(), SIGNING_TIME_SOURCE_SIGNED_DATE, nil
+	}
+	if claims.ReceiptCreationDate > 0 {
+		return claims.ReceiptCreationDate.Time(), SIGNING_TIME_SOURCE_RECEIPT_CREATION_DATE, nil
+	}
+	return time.Time{}, SIGNING_TIME_SOURCE_NONE, nil
 }
 
 type chainVerifier struct {
 	rootCertificates *x509.CertPool
-	cache            map[string]cacheEntry
-	cacheMutex       sync.RWMutex
+	rootsScope       [sha256.Size]byte
+	trustStore       *TrustStore
+	cache            *ChainCache
+	inflightMutex    sync.Mutex
+	inflight         map[chainCacheKey]*chainFlight
+	ocspFetcher      OCSPFetcher
+	ocspCache        *ocspResponseCache
+	ocspPolicy       OCSPFailurePolicy
+	revocationMode   RevocationMode
+	crlFetcher       CRLFetcher
+	crlBundle        []*x509.RevocationList
+	crlCache         *crlCache
+	now              func() time.Time
 }
 
 const (
@@ -303,46 +556,108 @@ const (
 
 func newChainVerifier(rootCerts [][]byte) (*chainVerifier, error) {
 	pool := x509.NewCertPool()
+	var roots []*x509.Certificate
 	for _, certBytes := range rootCerts {
 		cert, err := x509.ParseCertificate(certBytes)
 		if err != nil {
 			return nil, NewVerificationException(INVALID_CERTIFICATE, err)
 		}
 		pool.AddCert(cert)
+		roots = append(roots, cert)
 	}
 	return &chainVerifier{
 		rootCertificates: pool,
-		cache:            make(map[string]cacheEntry),
+		rootsScope:       rootsFingerprint(roots),
+		cache:            NewChainCache(maxCacheSize, cacheTimeLimit),
+		inflight:         make(map[chainCacheKey]*chainFlight),
+		ocspFetcher:      NewHTTPOCSPFetcher(nil),
+		ocspCache:        newOCSPResponseCache(),
+		crlFetcher:       NewHTTPCRLFetcher(nil),
+		crlCache:         newCRLCache(),
+		now:              time.Now,
 	}, nil
 }
 
+// roots returns the pool to verify chains against, and a fingerprint of its roots to scope cached chains with.
+// When the roots come from a TrustStore that has changed, chains cached for the old roots stop being used straight away.
+func (cv *chainVerifier) roots() (*x509.CertPool, [sha256.Size]byte) {
+	if cv.trustStore == nil {
+		return cv.rootCertificates, cv.rootsScope
+	}
+	return cv.trustStore.certPool()
+}
+
+func (cv *chainVerifier) cacheKey(rootsScope [sha256.Size]byte, certificates []string, performOnlineChecks bool) chainCacheKey {
+	return chainCacheKey{
+		roots:  rootsScope,
+		chain:  chainFingerprint(certificates),
+		online: performOnlineChecks,
+		mode:   cv.revocationMode,
+	}
+}
+
 func (cv *chainVerifier) verifyChain(certificates []string, performOnlineChecks bool, effectiveDate time.Time) (*ecdsa.PublicKey, error) {
-	if performOnlineChecks {
-		cacheKey := strings.Join(certificates, "|")
-		cv.cacheMutex.RLock()
-		if entry, ok := cv.cache[cacheKey]; ok && time.Now().Before(entry.expiry) {
-			cv.cacheMutex.RUnlock()
-			return entry.publicKey, nil
+	return cv.verifyChainWithReport(context.Background(), certificates, performOnlineChecks, effectiveDate, nil)
+}
+
+// verifyChainWithReport verifies the chain like verifyChain, recording the chain, matched root, cache use
+// and revocation checks in report if it isn't nil.
+//
+// Concurrent verifications of the same chain share the result of the first one, whether or not it could be cached.
+// A caller that is waiting for that result gives up with RETRYABLE_VERIFICATION_FAILURE when ctx is done.
+func (cv *chainVerifier) verifyChainWithReport(ctx context.Context, certificates []string, performOnlineChecks bool, effectiveDate time.Time, report *VerificationReport) (*ecdsa.PublicKey, error) {
+	roots, rootsScope := cv.roots()
+	cacheKey := cv.cacheKey(rootsScope, certificates, performOnlineChecks)
+	for {
+		if entry, ok := cv.cache.get(cacheKey, cv.now(), effectiveDate); ok {
+			report.setCacheHit()
+			return cv.reportChain(certificates, entry, report), nil
+		}
+
+		flight, leader := cv.beginFlight(cacheKey, effectiveDate)
+		if leader {
+			defer cv.endFlight(cacheKey, flight)
+			flight.entry, flight.err = cv.verifyUncachedChain(certificates, roots, cacheKey, performOnlineChecks, effectiveDate, report)
+			flight.finished = true
+			return flight.entry.publicKey, flight.err
+		}
+		select {
+		case <-flight.done:
+		case <-ctx.Done():
+			return nil, NewVerificationException(RETRYABLE_VERIFICATION_FAILURE, ctx.Err())
+		}
+		// The result only applies if the chain is valid, or not, at both effective dates
+		if flight.finished && flight.entry.validAt(effectiveDate) == flight.entry.validAt(flight.effectiveDate) {
+			if flight.err != nil {
+				return nil, flight.err
+			}
+			return cv.reportChain(certificates, flight.entry, report), nil
 		}
-		cv.cacheMutex.RUnlock()
 	}
+}
 
+// verifyUncachedChain verifies the chain and checks it for revocation, and caches it unless revocation couldn't be
+// confirmed. On failure, the returned entry only records the validity period of the chain, if it could be parsed.
+func (cv *chainVerifier) verifyUncachedChain(certificates []string, roots *x509.CertPool, cacheKey chainCacheKey, performOnlineChecks bool, effectiveDate time.Time, report *VerificationReport) (cacheEntry, error) {
+	var failed cacheEntry
 	if len(certificates) != 3 {
-		return nil, NewVerificationException(INVALID_CHAIN_LENGTH, errors.New("invalid chain length"))
+		return failed, NewVerificationException(INVALID_CHAIN_LENGTH, errors.New("invalid chain length"))
 	}
 
 	var parsedCerts []*x509.Certificate
 	for _, certStr := range certificates {
 		certBytes, err := base64.StdEncoding.DecodeString(certStr)
 		if err != nil {
-			return nil, NewVerificationException(INVALID_CERTIFICATE, err)
+			return failed, NewVerificationException(INVALID_CERTIFICATE, err)
 		}
 		cert, err := x509.ParseCertificate(certBytes)
 		if err != nil {
-			return nil, NewVerificationException(INVALID_CERTIFICATE, err)
+			return failed, NewVerificationException(INVALID_CERTIFICATE, err)
 		}
 		parsedCerts = append(parsedCerts, cert)
 	}
+	report.setChain(parsedCerts)
+	failed.notBefore, failed.notAfter = chainValidity(parsedCerts)
 
 	leaf := parsedCerts[0]
 	intermediates := x509.NewCertPool()
@@ -351,78 +666,107 @@ func (cv *chainVerifier) verifyChain(certificates []string, performOnlineChecks
 	}
 
 	opts := x509.VerifyOptions{
-		Roots:         cv.rootCertificates,
+		Roots:         roots,
 		Intermediates: intermediates,
 		CurrentTime:   effectiveDate,
 		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
 	}
 
-	if _, err := leaf.Verify(opts); err != nil {
-		return nil, NewVerificationException(VERIFICATION_FAILURE, err)
+	chains, err := leaf.Verify(opts)
+	if err != nil {
+		return failed, NewVerificationException(VERIFICATION_FAILURE, err)
 	}
+	report.setMatchedRoot(chains[0][len(chains[0])-1])
 
 	// OID checks
 	if err := cv.checkOID(leaf, "1.2.840.113635.100.6.11.1"); err != nil {
-		return nil, err
+		return failed, err
 	}
 	if err := cv.checkOID(parsedCerts[1], "1.2.840.113635.100.6.2.1"); err != nil {
-		return nil, err
+		return failed, err
+	}
+
+	pubKey, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return failed, NewVerificationException(VERIFICATION_FAILURE, errors.New("not an ECDSA public key"))
 	}
 
-	// OCSP check
+	// Revocation check
+	degraded := false
 	if performOnlineChecks {
-		// Retrieve the verified chain [leaf, intermediate, root] for OCSP validation
-		chains, err := leaf.Verify(opts)
-		if err != nil || len(chains) == 0 || len(chains[0]) < 3 {
-			return nil, NewVerificationException(VERIFICATION_FAILURE, errors.New("failed to verify chain for OCSP"))
+		// The verified chain [leaf, intermediate, root] is used for revocation checks
+		if len(chains[0]) < 3 {
+			return failed, NewVerificationException(VERIFICATION_FAILURE, errors.New("failed to verify chain for revocation checks"))
 		}
 		verifiedChain := chains[0]
-		if err := cv.checkOCSP(verifiedChain[1], verifiedChain[2], verifiedChain[2]); err != nil {
-			return nil, err
+		intermediateDegraded, err := cv.checkRevocation(verifiedChain[1], verifiedChain[2], verifiedChain[2], report)
+		if err != nil {
+			return failed, err
 		}
-		if err := cv.checkOCSP(verifiedChain[0], verifiedChain[1], verifiedChain[2]); err != nil {
-			return nil, err
+		leafDegraded, err := cv.checkRevocation(verifiedChain[0], verifiedChain[1], verifiedChain[2], report)
+		if err != nil {
+			return failed, err
 		}
 
-		// Update cache
-		pubKey, ok := leaf.PublicKey.(*ecdsa.PublicKey)
-		if ok {
-			cacheKey := strings.Join(certificates, "|")
-			cv.saveToCache(cacheKey, pubKey)
-		}
+		degraded = intermediateDegraded || leafDegraded
 	}
 
-	pubKey, ok := leaf.PublicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, NewVerificationException(VERIFICATION_FAILURE, errors.New("not an ECDSA public key"))
+	// Update cache, unless revocation couldn't be confirmed and should be checked again next time
+	entry := cv.cache.newCacheEntry(pubKey, chains[0], cv.now())
+	if !degraded {
+		cv.cache.put(cacheKey, entry)
 	}
 
-	return pubKey, nil
+	return entry, nil
 }
 
-func (cv *chainVerifier) saveToCache(cacheKey string, pubKey *ecdsa.PublicKey) {
-	cv.cacheMutex.Lock()
-	defer cv.cacheMutex.Unlock()
-
-	// Basic eviction if full
-	if len(cv.cache) >= maxCacheSize {
-		for k, v := range cv.cache {
-			if time.Now().After(v.expiry) {
-				delete(cv.cache, k)
-			}
-		}
-		// If still full, just delete a random one
-		if len(cv.cache) >= maxCacheSize {
-			for k := range cv.cache {
-				delete(cv.cache, k)
-				break
+// reportChain records a chain verified earlier in report, without verifying it again, and returns its public key.
+func (cv *chainVerifier) reportChain(certificates []string, entry cacheEntry, report *VerificationReport) *ecdsa.PublicKey {
+	if report != nil {
+		report.setMatchedRoot(entry.root)
+		var parsedCerts []*x509.Certificate
+		for _, certStr := range certificates {
+			if certBytes, err := base64.StdEncoding.DecodeString(certStr); err == nil {
+				if cert, err := x509.ParseCertificate(certBytes); err == nil {
+					parsedCerts = append(parsedCerts, cert)
+				}
 			}
 		}
+		report.setChain(parsedCerts)
 	}
-	cv.cache[cacheKey] = cacheEntry{
-		publicKey: pubKey,
-		expiry:    time.Now().Add(cacheTimeLimit),
-	}
+	return entry.publicKey
+}
+
+// chainFlight is a verification of a chain in progress, whose result is shared with concurrent verifications of the
+// same chain. Its result is set before done is closed.
+type chainFlight struct {
+	done          chan struct{}
+	effectiveDate time.Time
+
+	// Whether the verification finished, rather than panicking
+	finished bool
+	entry    cacheEntry
+	err      error
+}
+
+// beginFlight returns the verification in progress of the chain with cacheKey. If there is none, it starts one at
+// effectiveDate and reports that the caller leads it, and must call endFlight when it is done.
+func (cv *chainVerifier) beginFlight(cacheKey chainCacheKey, effectiveDate time.Time) (flight *chainFlight, leader bool) {
+	cv.inflightMutex.Lock()
+	defer cv.inflightMutex.Unlock()
+	if flight, ok := cv.inflight[cacheKey]; ok {
+		return flight, false
+	}
+	flight = &chainFlight{done: make(chan struct{}), effectiveDate: effectiveDate}
+	cv.inflight[cacheKey] = flight
+	return flight, true
+}
+
+func (cv *chainVerifier) endFlight(cacheKey chainCacheKey, flight *chainFlight) {
+	cv.inflightMutex.Lock()
+	defer cv.inflightMutex.Unlock()
+	delete(cv.inflight, cacheKey)
+	close(flight.done)
 }
 
 func (cv *chainVerifier) checkOID(cert *x509.Certificate, expectedOID string) error {
@@ -434,63 +778,120 @@ func (cv *chainVerifier) checkOID(cert *x509.Certificate, expectedOID string) er
 	return NewVerificationException(VERIFICATION_FAILURE, fmt.Errorf("missing expected OID: %s", expectedOID))
 }
 
-func (cv *chainVerifier) checkOCSP(cert, issuer, root *x509.Certificate) error {
-	for _, server := range cert.OCSPServer {
-		if err := cv.checkOCSPServer(server, cert, issuer, root); err == nil {
-			return nil
-		}
+// checkRevocation checks a certificate with the configured revocation mode.
+// It returns true when the certificate was accepted without a current revocation status.
+func (cv *chainVerifier) checkRevocation(cert, issuer, root *x509.Certificate, report *VerificationReport) (bool, error) {
+	if cv.revocationMode == REVOCATION_MODE_CRL {
+		return false, cv.checkCRL(cert, issuer, report)
 	}
-	return NewVerificationException(VERIFICATION_FAILURE, errors.New("failed to get a valid OCSP response"))
+	return cv.checkOCSP(cert, issuer, root, report)
 }
 
-func (cv *chainVerifier) checkOCSPServer(server string, cert, issuer, root *x509.Certificate) error {
-	opts := &ocsp.RequestOptions{Hash: crypto.SHA256}
-	buffer, err := ocsp.CreateRequest(cert, issuer, opts)
-	if err != nil {
-		return err
+// checkOCSP confirms that a certificate isn't revoked, using a cached Good response until its NextUpdate.
+// It returns true when the certificate was accepted under the soft-fail policy without a current response.
+func (cv *chainVerifier) checkOCSP(cert, issuer, root *x509.Certificate, report *VerificationReport) (bool, error) {
+	key := ocspCacheKey(cert, issuer)
+	now := cv.now()
+	cached, hasCached := cv.ocspCache.get(key)
+	if hasCached && now.Before(cached.nextUpdate) {
+		report.addRevocationCheck(RevocationCheck{Subject: cert.Subject.String(), Mode: REVOCATION_MODE_OCSP, Status: REVOCATION_STATUS_GOOD, Cached: true})
+		return false, nil
 	}
 
-	req, err := http.NewRequest("POST", server, bytes.NewReader(buffer))
-	if err != nil {
-		return err
+	var lastErr error = errors.New("certificate has no OCSP server")
+	for _, server := range cert.OCSPServer {
+		start := time.Now()
+		response, err := cv.checkOCSPServer(server, cert, issuer, root)
+		report.addRevocationCheck(RevocationCheck{
+			Subject:      cert.Subject.String(),
+			Mode:         REVOCATION_MODE_OCSP,
+			URL:          server,
+			Status:       ocspRevocationStatus(err),
+			ResponseTime: time.Since(start),
+			Err:          err,
+		})
+		if err == nil {
+			if !response.NextUpdate.IsZero() {
+				cv.ocspCache.put(key, ocspCacheEntry{nextUpdate: response.NextUpdate})
+			}
+			return false, nil
+		}
+		if errors.Is(err, errOCSPRevoked) {
+			return false, NewVerificationException(VERIFICATION_FAILURE, err)
+		}
+		lastErr = err
 	}
-	req.Header.Set("Content-Type", "application/ocsp-request")
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return NewVerificationException(RETRYABLE_VERIFICATION_FAILURE, err)
+	var unavailable *ocspUnavailableError
+	if errors.As(lastErr, &unavailable) {
+		if cv.ocspPolicy.SoftFail && cv.withinStaleness(cached, hasCached, now) {
+			if cv.ocspPolicy.OnDegraded != nil {
+				cv.ocspPolicy.OnDegraded(OCSPDegradation{Certificate: cert, LastNextUpdate: cached.nextUpdate, Err: unavailable.err})
+			}
+			report.markDegraded()
+			return true, nil
+		}
+		return false, NewVerificationException(RETRYABLE_VERIFICATION_FAILURE, fmt.Errorf("failed to get a valid OCSP response: %w", unavailable.err))
+	}
+	return false, NewVerificationException(VERIFICATION_FAILURE, errors.New("failed to get a valid OCSP response"))
+}
+
+// ocspRevocationStatus classifies the result of checkOCSPServer for a VerificationReport.
+func ocspRevocationStatus(err error) RevocationStatus {
+	var unavailable *ocspUnavailableError
+	switch {
+	case err == nil:
+		return REVOCATION_STATUS_GOOD
+	case errors.Is(err, errOCSPRevoked):
+		return REVOCATION_STATUS_REVOKED
+	case errors.As(err, &unavailable):
+		return REVOCATION_STATUS_UNAVAILABLE
+	default:
+		return REVOCATION_STATUS_INVALID_RESPONSE
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.New("OCSP server returned non-200 status")
+func (cv *chainVerifier) withinStaleness(cached ocspCacheEntry, hasCached bool, now time.Time) bool {
+	if cv.ocspPolicy.MaxStaleness < 0 {
+		return true
 	}
+	return hasCached && !now.After(cached.nextUpdate.Add(cv.ocspPolicy.MaxStaleness))
+}
 
-	body, err := io.ReadAll(resp.Body)
+func (cv *chainVerifier) checkOCSPServer(server string, cert, issuer, root *x509.Certificate) (*ocsp.Response, error) {
+	opts := &ocsp.RequestOptions{Hash: crypto.SHA256}
+	buffer, err := ocsp.CreateRequest(cert, issuer, opts)
 	if err != nil {
-		return NewVerificationException(RETRYABLE_VERIFICATION_FAILURE, err)
+		return nil, err
 	}
 
-	ocspResp, err := ocsp.ParseResponse(body, nil)
+	body, err := cv.ocspFetcher.FetchOCSP(server, buffer)
 	if err != nil {
-		return err
+		return nil, &ocspUnavailableError{err: err}
 	}
 
-	if ocspResp.Status != ocsp.Good {
-		return errors.New("OCSP status is not Good")
+	ocspResp, err := ocsp.ParseResponse(body, nil)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check serial number
 	if ocspResp.SerialNumber.Cmp(cert.SerialNumber) != 0 {
-		return errors.New("OCSP serial number mismatch")
+		return nil, errors.New("OCSP serial number mismatch")
 	}
 
 	if err := cv.verifyOCSPResponseSignature(ocspResp, issuer, root); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	switch ocspResp.Status {
+	case ocsp.Good:
+		return ocspResp, nil
+	case ocsp.Revoked:
+		return nil, errOCSPRevoked
+	default:
+		return nil, errors.New("OCSP status is not Good")
+	}
 }
 
 func (cv *chainVerifier) verifyOCSPResponseSignature(ocspResp *ocsp.Response, issuer, root *x509.Certificate) error {
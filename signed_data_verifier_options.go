@@ -0,0 +1,326 @@
+package appstore
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// OnlineCheckPolicy controls whether certificate revocation is checked online while verifying signed data.
+type OnlineCheckPolicy int
+
+const (
+	// ONLINE_CHECK_POLICY_DISABLED verifies the certificate chain offline, at the time the data was signed.
+	ONLINE_CHECK_POLICY_DISABLED OnlineCheckPolicy = 0
+
+	// ONLINE_CHECK_POLICY_ENABLED verifies the certificate chain at the current time and checks revocation,
+	// with OCSP or CRLs depending on the revocation mode.
+	ONLINE_CHECK_POLICY_ENABLED OnlineCheckPolicy = 1
+)
+
+// EffectiveDatePolicy decides the time at which the certificate chain of signed data is validated.
+type EffectiveDatePolicy int
+
+const (
+	// EFFECTIVE_DATE_POLICY_DEFAULT validates at the current time when online checks are enabled. Otherwise it validates
+	// at the signing time, or at the current time for data without one.
+	EFFECTIVE_DATE_POLICY_DEFAULT EffectiveDatePolicy = 0
+
+	// EFFECTIVE_DATE_POLICY_SIGNING_TIME validates at the time the data was signed, so data signed before its
+	// certificate expired is still accepted. Data without a signing time is rejected.
+	EFFECTIVE_DATE_POLICY_SIGNING_TIME EffectiveDatePolicy = 1
+
+	// EFFECTIVE_DATE_POLICY_CURRENT_TIME validates at the current time.
+	EFFECTIVE_DATE_POLICY_CURRENT_TIME EffectiveDatePolicy = 2
+
+	// EFFECTIVE_DATE_POLICY_BOTH requires the chain to be valid both at the signing time and at the current time.
+	// Data without a signing time is rejected.
+	EFFECTIVE_DATE_POLICY_BOTH EffectiveDatePolicy = 3
+)
+
+// SigningTimeSource identifies the claim that the signing time of signed data was read from.
+type SigningTimeSource int
+
+const (
+	SIGNING_TIME_SOURCE_NONE                  SigningTimeSource = 0
+	SIGNING_TIME_SOURCE_SIGNED_DATE           SigningTimeSource = 1
+	SIGNING_TIME_SOURCE_RECEIPT_CREATION_DATE SigningTimeSource = 2
+)
+
+// ValidationTime reports the times at which the certificate chain of signed data was validated.
+// It is the zero value when the chain wasn't validated, as for Xcode and LocalTesting data.
+type ValidationTime struct {
+	// The policy that chose the times.
+	Policy EffectiveDatePolicy
+
+	// The signing time the chain was validated at, or the zero time if it wasn't validated at the signing time.
+	SigningTime time.Time
+
+	// The claim SigningTime was read from.
+	SigningTimeSource SigningTimeSource
+
+	// The current time the chain was validated at, or the zero time if it wasn't validated at the current time.
+	CurrentTime time.Time
+}
+
+type signedDataVerifierConfig struct {
+	environments        []Environment
+	allowAnyEnvironment bool
+	bundleID            string
+	appAppleID          int64
+	onlineCheckPolicy   OnlineCheckPolicy
+	clock               func() time.Time
+	ocspFetcher         OCSPFetcher
+	ocspPolicy          OCSPFailurePolicy
+	revocationMode      RevocationMode
+	crlFetcher          CRLFetcher
+	crlBundle           [][]byte
+	cacheSize           int
+	cacheTTL            time.Duration
+	chainCache          *ChainCache
+	sharedChainCache    bool
+	trustStore          *TrustStore
+	effectiveDatePolicy EffectiveDatePolicy
+	strictDecoding      bool
+	localTestCerts      [][]byte
+	unverifiedLocal     bool
+	freshness           *freshnessPolicy
+	replayStore         ReplayStore
+}
+
+// SignedDataVerifierOption configures a SignedDataVerifier created with NewSignedDataVerifierWithOptions.
+type SignedDataVerifierOption func(*signedDataVerifierConfig)
+
+// WithEnvironments sets the environments that signed data may come from.
+// The first environment is the primary one, which decides how data is verified; at least one is required.
+// The Xcode and LocalTesting environments can't be combined with the others.
+func WithEnvironments(environments ...Environment) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.environments = append([]Environment(nil), environments...)
+	}
+}
+
+// WithAnyEnvironment accepts signed data from any environment, in addition to the configured ones.
+// It can't be used with the Xcode and LocalTesting environments.
+func WithAnyEnvironment() SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.allowAnyEnvironment = true
+	}
+}
+
+// WithBundleID sets the bundle identifier that signed data must match.
+func WithBundleID(bundleID string) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.bundleID = bundleID
+	}
+}
+
+// WithAppAppleID sets the App Apple ID that signed data must match. It is required when Production is an allowed environment.
+func WithAppAppleID(appAppleID int64) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.appAppleID = appAppleID
+	}
+}
+
+// WithOnlineCheckPolicy sets whether revocation is checked online. The default is ONLINE_CHECK_POLICY_DISABLED.
+// NewSignedDataVerifierWithOptions returns an error for any other value.
+func WithOnlineCheckPolicy(policy OnlineCheckPolicy) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.onlineCheckPolicy = policy
+	}
+}
+
+// WithClock sets the function that returns the current time. It is used for certificate validity and cache expiry.
+func WithClock(clock func() time.Time) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.clock = clock
+	}
+}
+
+// WithOCSPFetcher sets the fetcher used for online revocation checks.
+func WithOCSPFetcher(fetcher OCSPFetcher) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.ocspFetcher = fetcher
+	}
+}
+
+// WithOCSPFailurePolicy sets what happens when revocation status can't be fetched. The default is hard-fail.
+func WithOCSPFailurePolicy(policy OCSPFailurePolicy) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.ocspPolicy = policy
+	}
+}
+
+// WithRevocationMode sets how revocation is checked when online checks are enabled. The default is REVOCATION_MODE_OCSP.
+// NewSignedDataVerifierWithOptions returns an error for any other value.
+func WithRevocationMode(mode RevocationMode) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.revocationMode = mode
+	}
+}
+
+// WithCRLFetcher sets the fetcher used to download revocation lists in REVOCATION_MODE_CRL.
+func WithCRLFetcher(fetcher CRLFetcher) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.crlFetcher = fetcher
+	}
+}
+
+// WithCRLBundle supplies DER or PEM encoded revocation lists for REVOCATION_MODE_CRL.
+// A bundled list for a certificate's issuer is used instead of downloading one.
+func WithCRLBundle(crls ...[]byte) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.crlBundle = append(c.crlBundle, crls...)
+	}
+}
+
+// WithChainCache sets how many verified certificate chains are cached, and for how long.
+// A size of zero disables the cache.
+func WithChainCache(size int, ttl time.Duration) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.cacheSize = size
+		c.cacheTTL = ttl
+		c.chainCache = nil
+		c.sharedChainCache = false
+	}
+}
+
+// WithSharedChainCache caches verified certificate chains in cache instead of a cache of the verifier's own,
+// so that verifiers for several apps, or several verifiers for one app, verify each chain once.
+func WithSharedChainCache(cache *ChainCache) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.chainCache = cache
+		c.sharedChainCache = true
+	}
+}
+
+// WithEffectiveDatePolicy sets the time at which certificate chains are validated. The default is EFFECTIVE_DATE_POLICY_DEFAULT.
+// Revocation is always checked at the current time.
+func WithEffectiveDatePolicy(policy EffectiveDatePolicy) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.effectiveDatePolicy = policy
+	}
+}
+
+// WithStrictDecoding makes every VerifyAndDecode method return an *UnknownFieldsError when a payload, or an object
+// nested in it, has properties that the library doesn't model, or, with VerifyAndDecode, that the destination type
+// has no field for.
+func WithStrictDecoding() SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.strictDecoding = true
+	}
+}
+
+// WithTrustStore verifies certificate chains against the roots in store instead of the rootCertificates argument,
+// which must then be empty. Changes to the store, such as a Reload, apply to the verifier straight away.
+func WithTrustStore(store *TrustStore) SignedDataVerifierOption {
+	return func(c *signedDataVerifierConfig) {
+		c.trustStore = store
+	}
+}
+
+// NewSignedDataVerifierWithOptions creates a new SignedDataVerifier from the given root certificates and options.
+// Every VerifyAndDecode method applies the configured environment and app identifier checks.
+//
+// See https://developer.apple.com/documentation/appstoreserverapi
+func NewSignedDataVerifierWithOptions(rootCertificates [][]byte, opts ...SignedDataVerifierOption) (*SignedDataVerifier, error) {
+	config := &signedDataVerifierConfig{
+		clock:       time.Now,
+		ocspFetcher: NewHTTPOCSPFetcher(nil),
+		crlFetcher:  NewHTTPCRLFetcher(nil),
+		cacheSize:   maxCacheSize,
+		cacheTTL:    cacheTimeLimit,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	if len(config.environments) == 0 {
+		return nil, errors.New("at least one environment is required")
+	}
+	if slices.Contains(config.environments, ENVIRONMENT_PRODUCTION) && config.appAppleID == 0 {
+		return nil, errors.New("appAppleId is required when the environment is Production")
+	}
+	if config.clock == nil || config.ocspFetcher == nil || config.crlFetcher == nil {
+		return nil, errors.New("clock, OCSP fetcher and CRL fetcher must not be nil")
+	}
+	if config.onlineCheckPolicy != ONLINE_CHECK_POLICY_DISABLED && config.onlineCheckPolicy != ONLINE_CHECK_POLICY_ENABLED {
+		return nil, errors.New("invalid online check policy")
+	}
+	if config.revocationMode != REVOCATION_MODE_OCSP && config.revocationMode != REVOCATION_MODE_CRL {
+		return nil, errors.New("invalid revocation mode")
+	}
+	if config.effectiveDatePolicy < EFFECTIVE_DATE_POLICY_DEFAULT || config.effectiveDatePolicy > EFFECTIVE_DATE_POLICY_BOTH {
+		return nil, errors.New("invalid effective date policy")
+	}
+	if config.freshness != nil && (config.freshness.maxAge <= 0 || config.freshness.skew < 0) {
+		return nil, errors.New("freshness max age must be positive and skew must not be negative")
+	}
+	if config.cacheSize < 0 || config.cacheTTL < 0 {
+		return nil, errors.New("chain cache size and TTL must not be negative")
+	}
+	if config.sharedChainCache && config.chainCache == nil {
+		return nil, errors.New("shared chain cache must not be nil")
+	}
+
+	if len(config.localTestCerts) > 0 && config.unverifiedLocal {
+		return nil, errors.New("local test certificates must not be given with unverified local testing")
+	}
+	// The signature is checked on the local or the Apple path depending on the primary environment,
+	// so a local verifier must not accept any other environment
+	if slices.ContainsFunc(config.environments, isLocalEnvironment) {
+		if slices.ContainsFunc(config.environments, func(env Environment) bool { return !isLocalEnvironment(env) }) {
+			return nil, errors.New("the Xcode and LocalTesting environments must not be combined with other environments")
+		}
+		if config.allowAnyEnvironment {
+			return nil, errors.New("the Xcode and LocalTesting environments must not be combined with any environment")
+		}
+	}
+	if isLocalEnvironment(config.environments[0]) && len(config.localTestCerts) == 0 && !config.unverifiedLocal {
+		return nil, errors.New("local test certificates, or unverified local testing, are required for the Xcode and LocalTesting environments")
+	}
+	localRoots, err := parseLocalTestCertificates(config.localTestCerts)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.trustStore != nil && len(rootCertificates) > 0 {
+		return nil, errors.New("root certificates must not be given with a trust store")
+	}
+
+	cv, err := newChainVerifier(rootCertificates)
+	if err != nil {
+		return nil, err
+	}
+	cv.trustStore = config.trustStore
+	if cv.crlBundle, err = parseCRLBundle(config.crlBundle); err != nil {
+		return nil, err
+	}
+	cv.now = config.clock
+	cv.ocspFetcher = config.ocspFetcher
+	cv.ocspPolicy = config.ocspPolicy
+	cv.revocationMode = config.revocationMode
+	cv.crlFetcher = config.crlFetcher
+	if config.chainCache != nil {
+		cv.cache = config.chainCache
+	} else {
+		cv.cache = NewChainCache(config.cacheSize, config.cacheTTL)
+	}
+
+	return &SignedDataVerifier{
+		chainVerifier:          cv,
+		environment:            config.environments[0],
+		environments:           config.environments,
+		bundleID:               config.bundleID,
+		appAppleID:             config.appAppleID,
+		enableOnlineChecks:     config.onlineCheckPolicy == ONLINE_CHECK_POLICY_ENABLED,
+		allowAnyEnvironment:    config.allowAnyEnvironment,
+		effectiveDatePolicy:    config.effectiveDatePolicy,
+		strictDecoding:         config.strictDecoding,
+		localRoots:             localRoots,
+		unverifiedLocalTesting: config.unverifiedLocal,
+		freshness:              config.freshness,
+		replayStore:            config.replayStore,
+		now:                    config.clock,
+	}, nil
+}
@@ -0,0 +1,282 @@
+package appstore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingOCSPFetcher struct {
+	servers []string
+}
+
+func (f *recordingOCSPFetcher) FetchOCSP(server string, request []byte) ([]byte, error) {
+	f.servers = append(f.servers, server)
+	return nil, errors.New("offline")
+}
+
+func createTestSignedDataVerifierWithOptions(opts ...SignedDataVerifierOption) (*SignedDataVerifier, error) {
+	testCA, err := readTestData("certs/testCA.der")
+	if err != nil {
+		return nil, err
+	}
+	return NewSignedDataVerifierWithOptions([][]byte{testCA}, opts...)
+}
+
+func TestNewSignedDataVerifierWithOptions_Errors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := createTestSignedDataVerifierWithOptions(WithBundleID("com.example"))
+	assert.Error(err, "Expected error without environment")
+
+	_, err = createTestSignedDataVerifierWithOptions(WithEnvironments(ENVIRONMENT_SANDBOX, ENVIRONMENT_PRODUCTION), WithBundleID("com.example"))
+	assert.Error(err, "Expected error for Production without appAppleId")
+
+	_, err = createTestSignedDataVerifierWithOptions(WithEnvironments(ENVIRONMENT_SANDBOX), WithChainCache(-1, time.Minute))
+	assert.Error(err, "Expected error for negative cache size")
+
+	_, err = createTestSignedDataVerifierWithOptions(WithEnvironments(ENVIRONMENT_SANDBOX), WithOCSPFetcher(nil))
+	assert.Error(err, "Expected error for nil OCSP fetcher")
+
+	_, err = createTestSignedDataVerifierWithOptions(WithEnvironments(ENVIRONMENT_SANDBOX), WithOnlineCheckPolicy(OnlineCheckPolicy(2)))
+	assert.Error(err, "Expected error for unknown online check policy")
+
+	_, err = createTestSignedDataVerifierWithOptions(WithEnvironments(ENVIRONMENT_SANDBOX), WithRevocationMode(RevocationMode(-1)))
+	assert.Error(err, "Expected error for unknown revocation mode")
+}
+
+func createTestSignedPayloadFromJSON(t testing.TB, pki *testPKI, path string, overrides map[string]any) string {
+	t.Helper()
+	data, err := readTestData(path)
+	assert.NoError(t, err, "Failed to read test data")
+	var claims jwt.MapClaims
+	assert.NoError(t, json.Unmarshal(data, &claims), "Failed to parse test data")
+	maps.Copy(claims, overrides)
+	return createTestSignedPayload(t, pki, claims)
+}
+
+func TestSignedDataVerifierOptions_AllowedEnvironments(t *testing.T) {
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki,
+		WithEnvironments(ENVIRONMENT_SANDBOX, ENVIRONMENT_PRODUCTION), WithAppAppleID(531412),
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED), WithEffectiveDatePolicy(EFFECTIVE_DATE_POLICY_CURRENT_TIME),
+	)
+
+	signedTransaction := createTestSignedPayloadFromJSON(t, pki, "models/signedTransaction.json", map[string]any{"environment": "Production"})
+	_, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	assert.NoError(t, err, "Production transaction should be accepted")
+
+	signedTransaction = createTestSignedPayloadFromJSON(t, pki, "models/signedTransaction.json", map[string]any{"environment": "Xcode"})
+	_, err = verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+}
+
+func TestSignedDataVerifierOptions_LocalEnvironmentsAreNotMixed(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := createTestSignedDataVerifierWithOptions(
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING, ENVIRONMENT_SANDBOX), WithUnverifiedLocalTesting(), WithBundleID("com.example"),
+	)
+	assert.Error(err, "Expected error for LocalTesting with Sandbox")
+
+	_, err = createTestSignedDataVerifierWithOptions(
+		WithEnvironments(ENVIRONMENT_SANDBOX, ENVIRONMENT_XCODE), WithBundleID("com.example"),
+	)
+	assert.Error(err, "Expected error for Sandbox with Xcode")
+
+	_, err = createTestSignedDataVerifierWithOptions(
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING), WithUnverifiedLocalTesting(), WithBundleID("com.example"), WithAnyEnvironment(),
+	)
+	assert.Error(err, "Expected error for LocalTesting with any environment")
+}
+
+func TestSignedDataVerifierOptions_UnverifiedLocalTestingRejectsOtherEnvironments(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createTestSignedDataVerifierWithOptions(
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING, ENVIRONMENT_XCODE), WithUnverifiedLocalTesting(), WithBundleID("com.example"),
+	)
+	assert.NoError(err, "Failed to create verifier")
+
+	signedTransaction, err := createSignedDataFromJSONWithOverrides("models/signedTransaction.json", map[string]any{"environment": "Xcode"})
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	assert.NoError(err, "Xcode transaction should be accepted")
+
+	for _, environment := range []string{"Production", "Sandbox", ""} {
+		signedTransaction, err = createSignedDataFromJSONWithOverrides("models/signedTransaction.json", map[string]any{"environment": environment})
+		assert.NoError(err, "Failed to create signed data")
+		_, err = verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+		assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+
+		_, err = VerifyAndDecode[Claims](verifier, signedTransaction)
+		assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+	}
+
+	signedNotification, err := createSignedDataFromJSONWithOverrides("models/signedNotification.json", map[string]any{
+		"data": map[string]any{"environment": "Production", "bundleId": "com.example"},
+	})
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeNotification(signedNotification)
+	assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+}
+
+func TestSignedDataVerifierOptions_AppTransactionAndRealtimeRequestUseEnvironmentPolicy(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki, WithAnyEnvironment(),
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED), WithEffectiveDatePolicy(EFFECTIVE_DATE_POLICY_CURRENT_TIME))
+
+	signedAppTransaction := createTestSignedPayloadFromJSON(t, pki, "models/appTransaction.json", map[string]any{"receiptType": "Production"})
+	appTransaction, err := verifier.VerifyAndDecodeAppTransaction(signedAppTransaction)
+	assert.NoError(err, "AppTransaction should honor the environment policy")
+	assert.Equal(ENVIRONMENT_PRODUCTION, appTransaction.ReceiptType, "ReceiptType")
+
+	signedRealtimeRequest := createTestSignedPayloadFromJSON(t, pki, "models/decodedRealtimeRequest.json", map[string]any{"environment": "Production"})
+	realtimeRequest, err := verifier.VerifyAndDecodeRealtimeRequest(signedRealtimeRequest)
+	assert.NoError(err, "Realtime request should honor the environment policy")
+	assert.Equal(ENVIRONMENT_PRODUCTION, realtimeRequest.Environment, "Environment")
+
+	strict := createTestReportVerifier(t, pki,
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED), WithEffectiveDatePolicy(EFFECTIVE_DATE_POLICY_CURRENT_TIME))
+	_, err = strict.VerifyAndDecodeAppTransaction(signedAppTransaction)
+	assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+	_, err = strict.VerifyAndDecodeRealtimeRequest(signedRealtimeRequest)
+	assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+}
+
+func TestSignedDataVerifierOptions_ProductionRequiresAppAppleID(t *testing.T) {
+	pki := createTestPKI(t)
+	verifier := createTestReportVerifier(t, pki,
+		WithEnvironments(ENVIRONMENT_SANDBOX, ENVIRONMENT_PRODUCTION), WithAppAppleID(1234),
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_DISABLED), WithEffectiveDatePolicy(EFFECTIVE_DATE_POLICY_CURRENT_TIME),
+	)
+
+	signedRealtimeRequest := createTestSignedPayloadFromJSON(t, pki, "models/decodedRealtimeRequest.json", map[string]any{"environment": "Production", "appAppleId": 5678})
+	_, err := verifier.VerifyAndDecodeRealtimeRequest(signedRealtimeRequest)
+	assertVerificationStatus(t, INVALID_APP_IDENTIFIER, err)
+}
+
+func TestSignedDataVerifierOptions_OCSPFetcherAndClock(t *testing.T) {
+	assert := assert.New(t)
+	rootBytes, _ := base64.StdEncoding.DecodeString(REAL_APPLE_ROOT_BASE64_ENCODED)
+	fetcher := &recordingOCSPFetcher{}
+	verifier, err := NewSignedDataVerifierWithOptions([][]byte{rootBytes},
+		WithEnvironments(ENVIRONMENT_SANDBOX),
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_ENABLED),
+		WithOCSPFetcher(fetcher),
+		WithClock(func() time.Time { return time.Unix(EFFECTIVE_DATE, 0) }),
+		WithChainCache(0, 0),
+	)
+	assert.NoError(err, "Failed to create verifier")
+
+	certs := []string{
+		REAL_APPLE_SIGNING_CERTIFICATE_BASE64_ENCODED,
+		REAL_APPLE_INTERMEDIATE_BASE64_ENCODED,
+		REAL_APPLE_ROOT_BASE64_ENCODED,
+	}
+	_, err = verifier.chainVerifier.verifyChain(certs, verifier.enableOnlineChecks, verifier.now())
+	assertVerificationStatus(t, RETRYABLE_VERIFICATION_FAILURE, err)
+	assert.NotEmpty(fetcher.servers, "Custom OCSP fetcher should be used")
+	assert.Equal(0, verifier.ChainCacheStats().Entries, "Cache is disabled")
+}
+
+func assertVerificationStatus(t *testing.T, expected VerificationStatus, err error) {
+	t.Helper()
+	var vErr *VerificationException
+	if assert.True(t, errors.As(err, &vErr), "Expected VerificationException, got %v", err) {
+		assert.Equal(t, expected, vErr.Status, "Verification status")
+	}
+}
+
+func createTestSignedPayload(t testing.TB, pki *testPKI, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["x5c"] = pki.chain()
+	signed, err := token.SignedString(pki.leafKey)
+	assert.NoError(t, err, "Failed to sign payload")
+	return signed
+}
+
+func TestSignedDataVerifierOptions_EffectiveDatePolicy(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	signedAt := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	afterExpiry := pki.leaf.NotAfter.Add(24 * time.Hour)
+	signed := createTestSignedPayload(t, pki, jwt.MapClaims{
+		"bundleId":    "com.example",
+		"environment": "Sandbox",
+		"signedDate":  signedAt.UnixMilli(),
+	})
+	unsigned := createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox"})
+
+	newVerifier := func(policy EffectiveDatePolicy) *SignedDataVerifier {
+		verifier, err := NewSignedDataVerifierWithOptions([][]byte{pki.root.Raw},
+			WithEnvironments(ENVIRONMENT_SANDBOX),
+			WithBundleID("com.example"),
+			WithEffectiveDatePolicy(policy),
+			WithClock(func() time.Time { return afterExpiry }),
+		)
+		assert.NoError(err, "Failed to create verifier")
+		return verifier
+	}
+
+	transaction := &JWSTransactionDecodedPayload{}
+	validationTime, err := newVerifier(EFFECTIVE_DATE_POLICY_DEFAULT).VerifyAndDecodeWithValidationTime(signed, transaction)
+	assert.NoError(err, "Offline verification uses the signing time")
+	assert.True(signedAt.Equal(validationTime.SigningTime), "SigningTime")
+	assert.Equal(SIGNING_TIME_SOURCE_SIGNED_DATE, validationTime.SigningTimeSource, "SigningTimeSource")
+	assert.True(validationTime.CurrentTime.IsZero(), "Not validated at the current time")
+	assert.Equal("com.example", transaction.BundleId, "Payload is decoded")
+
+	validationTime, err = newVerifier(EFFECTIVE_DATE_POLICY_SIGNING_TIME).VerifyAndDecodeWithValidationTime(signed, &JWSTransactionDecodedPayload{})
+	assert.NoError(err, "Signing time policy accepts data signed before expiry")
+	assert.Equal(EFFECTIVE_DATE_POLICY_SIGNING_TIME, validationTime.Policy, "Policy")
+
+	validationTime, err = newVerifier(EFFECTIVE_DATE_POLICY_CURRENT_TIME).VerifyAndDecodeWithValidationTime(signed, &JWSTransactionDecodedPayload{})
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+	assert.True(afterExpiry.Equal(validationTime.CurrentTime), "CurrentTime")
+
+	validationTime, err = newVerifier(EFFECTIVE_DATE_POLICY_BOTH).VerifyAndDecodeWithValidationTime(signed, &JWSTransactionDecodedPayload{})
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+	assert.False(validationTime.SigningTime.IsZero(), "Validated at the signing time first")
+
+	_, err = newVerifier(EFFECTIVE_DATE_POLICY_SIGNING_TIME).VerifyAndDecodeWithValidationTime(unsigned, &JWSTransactionDecodedPayload{})
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+
+	validationTime, err = newVerifier(EFFECTIVE_DATE_POLICY_DEFAULT).VerifyAndDecodeWithValidationTime(unsigned, &JWSTransactionDecodedPayload{})
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+	assert.Equal(SIGNING_TIME_SOURCE_NONE, validationTime.SigningTimeSource, "Falls back to the current time")
+	assert.True(afterExpiry.Equal(validationTime.CurrentTime), "CurrentTime")
+
+	_, err = newVerifier(EFFECTIVE_DATE_POLICY_DEFAULT).VerifyAndDecodeWithValidationTime(signed, &struct{}{})
+	assert.Error(err, "Unsupported destination")
+
+	_, err = createTestSignedDataVerifierWithOptions(WithEnvironments(ENVIRONMENT_SANDBOX), WithEffectiveDatePolicy(EffectiveDatePolicy(9)))
+	assert.Error(err, "Expected error for invalid policy")
+}
+
+func TestSigningTimeOf(t *testing.T) {
+	assert := assert.New(t)
+	signingTime, source, err := signingTimeOf([]byte(`{"receiptCreationDate": 1698148900000}`))
+	assert.NoError(err, "signingTimeOf failed")
+	assert.Equal(int64(1698148900000), signingTime.UnixMilli(), "Signing time")
+	assert.Equal(SIGNING_TIME_SOURCE_RECEIPT_CREATION_DATE, source, "Source")
+
+	signingTime, source, err = signingTimeOf([]byte(`{"receiptCreationDate": 1698148900000, "signedDate": 1698148950000}`))
+	assert.NoError(err, "signingTimeOf failed")
+	assert.Equal(int64(1698148950000), signingTime.UnixMilli(), "signedDate takes precedence")
+	assert.Equal(SIGNING_TIME_SOURCE_SIGNED_DATE, source, "Source")
+
+	_, source, err = signingTimeOf([]byte(`{}`))
+	assert.NoError(err, "signingTimeOf failed")
+	assert.Equal(SIGNING_TIME_SOURCE_NONE, source, "Source")
+
+	_, _, err = signingTimeOf([]byte(`not json`))
+	assert.Error(err, "Expected error for invalid payload")
+}
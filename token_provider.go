@@ -0,0 +1,152 @@
+package appstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// AppStoreConnectAudience is the audience of tokens for the App Store Server API and the App Store Connect API.
+	AppStoreConnectAudience = "appstoreconnect-v1"
+
+	// MaxTokenLifetime is the longest lifetime Apple accepts for an API token.
+	//
+	// https://developer.apple.com/documentation/appstoreconnectapi/generating-tokens-for-api-requests
+	MaxTokenLifetime = 20 * time.Minute
+
+	inAppKeyTokenLifetime = 5 * time.Minute
+
+	// tokenRefreshMargin is how long before expiry a cached token is replaced, so that it doesn't expire in flight.
+	tokenRefreshMargin = time.Minute
+)
+
+// TokenProvider supplies the bearer token for API requests.
+// Implementations must be safe for concurrent use.
+type TokenProvider interface {
+	Token() (string, error)
+}
+
+// JWTTokenProvider creates ES256-signed JSON Web Tokens and caches each one until shortly before it expires.
+type JWTTokenProvider struct {
+	signingKey *ecdsa.PrivateKey
+	keyID      string
+	issuerID   string
+	bundleID   string
+	scope      []string
+	lifetime   time.Duration
+	now        func() time.Time
+
+	mutex     sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewInAppKeyTokenProvider creates a token provider for an In-App Purchase key, used with the App Store Server API.
+// Tokens include the bid claim and expire after 5 minutes.
+// The signingKey should be a PEM-encoded PKCS#8 ECDSA private key.
+//
+// https://developer.apple.com/documentation/appstoreserverapi/generating-json-web-tokens-for-api-requests
+func NewInAppKeyTokenProvider(signingKey []byte, keyID, issuerID, bundleID string) (*JWTTokenProvider, error) {
+	return newJWTTokenProvider(signingKey, keyID, issuerID, bundleID, nil, inAppKeyTokenLifetime)
+}
+
+// NewTeamKeyTokenProvider creates a token provider for an App Store Connect API team key.
+// Tokens have no bid claim and expire after MaxTokenLifetime.
+// The signingKey should be a PEM-encoded PKCS#8 ECDSA private key.
+//
+// https://developer.apple.com/documentation/appstoreconnectapi/generating-tokens-for-api-requests
+func NewTeamKeyTokenProvider(signingKey []byte, keyID, issuerID string) (*JWTTokenProvider, error) {
+	return newJWTTokenProvider(signingKey, keyID, issuerID, "", nil, MaxTokenLifetime)
+}
+
+// NewScopedTokenProvider creates a token provider for an App Store Connect API team key whose tokens are limited
+// to the given scope, such as "GET /v1/apps?filter[platform]=IOS".
+// The lifetime must be positive and no longer than MaxTokenLifetime.
+// The signingKey should be a PEM-encoded PKCS#8 ECDSA private key.
+//
+// https://developer.apple.com/documentation/appstoreconnectapi/generating-tokens-for-api-requests
+func NewScopedTokenProvider(signingKey []byte, keyID, issuerID string, scope []string, lifetime time.Duration) (*JWTTokenProvider, error) {
+	if len(scope) == 0 {
+		return nil, errors.New("scope must not be empty")
+	}
+	return newJWTTokenProvider(signingKey, keyID, issuerID, "", append([]string(nil), scope...), lifetime)
+}
+
+func newJWTTokenProvider(signingKey []byte, keyID, issuerID, bundleID string, scope []string, lifetime time.Duration) (*JWTTokenProvider, error) {
+	if lifetime <= 0 || lifetime > MaxTokenLifetime {
+		return nil, fmt.Errorf("token lifetime %v must be positive and no longer than %v", lifetime, MaxTokenLifetime)
+	}
+	key, err := parseSigningKey(signingKey)
+	if err != nil {
+		return nil, err
+	}
+	return &JWTTokenProvider{
+		signingKey: key,
+		keyID:      keyID,
+		issuerID:   issuerID,
+		bundleID:   bundleID,
+		scope:      scope,
+		lifetime:   lifetime,
+		now:        time.Now,
+	}, nil
+}
+
+// Token returns the cached token, or signs a new one if the cached token is about to expire.
+func (p *JWTTokenProvider) Token() (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	if p.token != "" && now.Add(min(tokenRefreshMargin, p.lifetime/2)).Before(p.expiresAt) {
+		return p.token, nil
+	}
+
+	expiresAt := now.Add(p.lifetime)
+	claims := jwt.MapClaims{
+		"iss": p.issuerID,
+		"aud": AppStoreConnectAudience,
+		"iat": now.Unix(),
+		"exp": expiresAt.Unix(),
+	}
+	if p.bundleID != "" {
+		claims["bid"] = p.bundleID
+	}
+	if len(p.scope) > 0 {
+		claims["scope"] = p.scope
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = p.keyID
+
+	signed, err := token.SignedString(p.signingKey)
+	if err != nil {
+		return "", err
+	}
+	p.token = signed
+	p.expiresAt = expiresAt
+	return signed, nil
+}
+
+func parseSigningKey(signingKey []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(signingKey)
+	if block == nil {
+		return nil, errors.New("failed to parse PEM block from signing key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+
+	privateKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an ECDSA private key")
+	}
+	return privateKey, nil
+}
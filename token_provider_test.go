@@ -0,0 +1,111 @@
+package appstore
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInAppKeyTokenProvider(t *testing.T) {
+	assert := assert.New(t)
+	signingKey, err := readTestData("certs/testSigningKey.p8")
+	assert.NoError(err, "Failed to read signing key")
+
+	provider, err := NewInAppKeyTokenProvider(signingKey, TEST_KEY_ID, TEST_ISSUER_ID, TEST_BUNDLE_ID)
+	assert.NoError(err, "Failed to create provider")
+	token, err := provider.Token()
+	assert.NoError(err, "Token failed")
+
+	header, payload, err := decodeJWTWithoutVerification(token)
+	assert.NoError(err, "Failed to decode JWT")
+	assert.Equal(TEST_KEY_ID, header["kid"], "kid")
+	assert.Equal("ES256", header["alg"], "alg")
+	assert.Equal(AppStoreConnectAudience, payload["aud"], "aud")
+	assert.Equal(TEST_ISSUER_ID, payload["iss"], "iss")
+	assert.Equal(TEST_BUNDLE_ID, payload["bid"], "bid")
+	assert.Equal(float64(5*60), payload["exp"].(float64)-payload["iat"].(float64), "lifetime")
+	assert.NotContains(payload, "scope", "scope")
+}
+
+func TestTeamKeyTokenProvider(t *testing.T) {
+	assert := assert.New(t)
+	signingKey, err := readTestData("certs/testSigningKey.p8")
+	assert.NoError(err, "Failed to read signing key")
+
+	provider, err := NewTeamKeyTokenProvider(signingKey, TEST_KEY_ID, TEST_ISSUER_ID)
+	assert.NoError(err, "Failed to create provider")
+	token, err := provider.Token()
+	assert.NoError(err, "Token failed")
+
+	_, payload, err := decodeJWTWithoutVerification(token)
+	assert.NoError(err, "Failed to decode JWT")
+	assert.NotContains(payload, "bid", "bid")
+	assert.Equal(float64(20*60), payload["exp"].(float64)-payload["iat"].(float64), "lifetime")
+}
+
+func TestScopedTokenProvider(t *testing.T) {
+	assert := assert.New(t)
+	signingKey, err := readTestData("certs/testSigningKey.p8")
+	assert.NoError(err, "Failed to read signing key")
+
+	scope := []string{"GET /v1/apps?filter[platform]=IOS"}
+	provider, err := NewScopedTokenProvider(signingKey, TEST_KEY_ID, TEST_ISSUER_ID, scope, 10*time.Minute)
+	assert.NoError(err, "Failed to create provider")
+	token, err := provider.Token()
+	assert.NoError(err, "Token failed")
+
+	_, payload, err := decodeJWTWithoutVerification(token)
+	assert.NoError(err, "Failed to decode JWT")
+	assert.Equal([]any{"GET /v1/apps?filter[platform]=IOS"}, payload["scope"], "scope")
+	assert.Equal(float64(10*60), payload["exp"].(float64)-payload["iat"].(float64), "lifetime")
+
+	_, err = NewScopedTokenProvider(signingKey, TEST_KEY_ID, TEST_ISSUER_ID, scope, 21*time.Minute)
+	assert.Error(err, "Expected error for lifetime over 20 minutes")
+	_, err = NewScopedTokenProvider(signingKey, TEST_KEY_ID, TEST_ISSUER_ID, nil, 10*time.Minute)
+	assert.Error(err, "Expected error for empty scope")
+}
+
+func TestJWTTokenProviderCachesToken(t *testing.T) {
+	assert := assert.New(t)
+	signingKey, err := readTestData("certs/testSigningKey.p8")
+	assert.NoError(err, "Failed to read signing key")
+
+	provider, err := NewInAppKeyTokenProvider(signingKey, TEST_KEY_ID, TEST_ISSUER_ID, TEST_BUNDLE_ID)
+	assert.NoError(err, "Failed to create provider")
+	now := time.Unix(1700000000, 0)
+	provider.now = func() time.Time { return now }
+
+	first, err := provider.Token()
+	assert.NoError(err, "Token failed")
+	now = now.Add(3 * time.Minute)
+	second, err := provider.Token()
+	assert.NoError(err, "Token failed")
+	assert.Equal(first, second, "Token should be reused before the refresh margin")
+
+	now = now.Add(90 * time.Second)
+	third, err := provider.Token()
+	assert.NoError(err, "Token failed")
+	assert.NotEqual(first, third, "Token should be refreshed near expiry")
+}
+
+type staticTokenProvider string
+
+func (p staticTokenProvider) Token() (string, error) {
+	return string(p), nil
+}
+
+func TestNewAPIClientWithTokenProvider(t *testing.T) {
+	assert := assert.New(t)
+	client, err := NewAPIClientWithTokenProvider(staticTokenProvider("token"), ENVIRONMENT_SANDBOX, &http.Client{})
+	assert.NoError(err, "Failed to create client")
+	token, err := client.tokenProvider.Token()
+	assert.NoError(err, "Token failed")
+	assert.Equal("token", token, "Token")
+
+	_, err = NewAPIClientWithTokenProvider(nil, ENVIRONMENT_SANDBOX, &http.Client{})
+	assert.Error(err, "Expected error for nil provider")
+	_, err = NewAPIClientWithTokenProvider(staticTokenProvider("token"), ENVIRONMENT_XCODE, &http.Client{})
+	assert.Error(err, "Expected error for Xcode environment")
+}
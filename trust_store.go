@@ -0,0 +1,258 @@
+package appstore
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/laishere/app-store-server-library-go/appleroots"
+)
+
+// RootSource records where a trusted root certificate came from.
+type RootSource string
+
+const (
+	ROOT_SOURCE_EMBEDDED  RootSource = "embedded"
+	ROOT_SOURCE_USER      RootSource = "user"
+	ROOT_SOURCE_DIRECTORY RootSource = "directory"
+)
+
+// RootCertificateInfo describes a root certificate held by a TrustStore.
+type RootCertificateInfo struct {
+	// The subject of the certificate.
+	Subject string
+
+	// The SHA-256 fingerprint of the DER encoding, as uppercase hex pairs separated by colons.
+	SHA256Fingerprint string
+
+	// The time after which the certificate is no longer valid.
+	NotAfter time.Time
+
+	// Where the certificate came from. A certificate supplied more than once keeps its first source.
+	Source RootSource
+
+	// The file the certificate was read from, for certificates loaded from a directory.
+	Path string
+}
+
+type trustedRoot struct {
+	cert *x509.Certificate
+	info RootCertificateInfo
+}
+
+// TrustStore holds the root certificates that signed data is verified against.
+// It merges the embedded Apple roots, roots supplied in code, and roots loaded from a directory,
+// which can be reloaded while verifiers are using the store. It is safe for concurrent use.
+type TrustStore struct {
+	mutex     sync.RWMutex
+	embedded  []trustedRoot
+	user      []trustedRoot
+	directory []trustedRoot
+	dir       string
+	pool      *x509.CertPool
+	roots     []trustedRoot
+	scope     [sha256.Size]byte
+}
+
+// NewTrustStore creates a trust store. If includeEmbedded is true, the store starts with the
+// Apple root certificates from the appleroots package. Any DER encoded userRoots are added as well.
+func NewTrustStore(includeEmbedded bool, userRoots ...[]byte) (*TrustStore, error) {
+	s := &TrustStore{}
+	if includeEmbedded {
+		for _, der := range appleroots.DER() {
+			root, err := parseTrustedRoot(der, ROOT_SOURCE_EMBEDDED, "")
+			if err != nil {
+				return nil, err
+			}
+			s.embedded = append(s.embedded, root)
+		}
+	}
+	for _, der := range userRoots {
+		root, err := parseTrustedRoot(der, ROOT_SOURCE_USER, "")
+		if err != nil {
+			return nil, err
+		}
+		s.user = append(s.user, root)
+	}
+	s.rebuild()
+	return s, nil
+}
+
+// AddRoots adds DER encoded root certificates to the store.
+func (s *TrustStore) AddRoots(roots ...[]byte) error {
+	parsed := make([]trustedRoot, 0, len(roots))
+	for _, der := range roots {
+		root, err := parseTrustedRoot(der, ROOT_SOURCE_USER, "")
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, root)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.user = append(s.user, parsed...)
+	s.rebuild()
+	return nil
+}
+
+// LoadDirectory reads root certificates from the .cer, .crt, .der and .pem files in dir,
+// replacing any roots previously loaded from a directory. PEM files may hold several certificates.
+// If any file can't be parsed, the store is left unchanged.
+func (s *TrustStore) LoadDirectory(dir string) error {
+	roots, err := readRootDirectory(dir)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.dir = dir
+	s.directory = roots
+	s.rebuild()
+	return nil
+}
+
+// Reload reads the directory given to LoadDirectory again, picking up added, changed and removed files.
+// If any file can't be parsed, the store is left unchanged.
+func (s *TrustStore) Reload() error {
+	s.mutex.RLock()
+	dir := s.dir
+	s.mutex.RUnlock()
+	if dir == "" {
+		return errors.New("no directory has been loaded")
+	}
+	return s.LoadDirectory(dir)
+}
+
+// Roots returns the DER encodings of the roots in the store, without duplicates.
+func (s *TrustStore) Roots() [][]byte {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	der := make([][]byte, len(s.roots))
+	for i, root := range s.roots {
+		der[i] = slices.Clone(root.cert.Raw)
+	}
+	return der
+}
+
+// Certificates describes the roots in the store, without duplicates.
+func (s *TrustStore) Certificates() []RootCertificateInfo {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	infos := make([]RootCertificateInfo, len(s.roots))
+	for i, root := range s.roots {
+		infos[i] = root.info
+	}
+	return infos
+}
+
+// ExpiringWithin describes the roots that expire within d of now, including any that have already expired,
+// ordered by expiry.
+func (s *TrustStore) ExpiringWithin(d time.Duration, now time.Time) []RootCertificateInfo {
+	var expiring []RootCertificateInfo
+	for _, info := range s.Certificates() {
+		if info.NotAfter.Before(now.Add(d)) {
+			expiring = append(expiring, info)
+		}
+	}
+	slices.SortFunc(expiring, func(a, b RootCertificateInfo) int {
+		return a.NotAfter.Compare(b.NotAfter)
+	})
+	return expiring
+}
+
+// certPool returns the pool of roots and a fingerprint that changes whenever the roots change.
+func (s *TrustStore) certPool() (*x509.CertPool, [sha256.Size]byte) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.pool, s.scope
+}
+
+func (s *TrustStore) rebuild() {
+	s.pool = x509.NewCertPool()
+	s.roots = nil
+	seen := make(map[string]bool)
+	for _, group := range [][]trustedRoot{s.embedded, s.user, s.directory} {
+		for _, root := range group {
+			if seen[root.info.SHA256Fingerprint] {
+				continue
+			}
+			seen[root.info.SHA256Fingerprint] = true
+			s.pool.AddCert(root.cert)
+			s.roots = append(s.roots, root)
+		}
+	}
+	certs := make([]*x509.Certificate, len(s.roots))
+	for i, root := range s.roots {
+		certs[i] = root.cert
+	}
+	s.scope = rootsFingerprint(certs)
+}
+
+func parseTrustedRoot(der []byte, source RootSource, path string) (trustedRoot, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return trustedRoot{}, NewVerificationException(INVALID_CERTIFICATE, err)
+	}
+	return trustedRoot{
+		cert: cert,
+		info: RootCertificateInfo{
+			Subject:           cert.Subject.String(),
+			SHA256Fingerprint: appleroots.Fingerprint(cert.Raw),
+			NotAfter:          cert.NotAfter,
+			Source:            source,
+			Path:              path,
+		},
+	}, nil
+}
+
+func readRootDirectory(dir string) ([]trustedRoot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []trustedRoot
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".cer", ".crt", ".der", ".pem":
+		default:
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		ders := [][]byte{data}
+		if block, rest := pem.Decode(data); block != nil {
+			ders = nil
+			for ; block != nil; block, rest = pem.Decode(rest) {
+				if block.Type == "CERTIFICATE" {
+					ders = append(ders, block.Bytes)
+				}
+			}
+		}
+		for _, der := range ders {
+			root, err := parseTrustedRoot(der, ROOT_SOURCE_DIRECTORY, path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid root certificate in %s: %w", path, err)
+			}
+			roots = append(roots, root)
+		}
+	}
+	return roots, nil
+}
@@ -0,0 +1,135 @@
+package appstore
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/laishere/app-store-server-library-go/appleroots"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustStoreMergesEmbeddedAndUserRoots(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	embedded := appleroots.DER()
+
+	store, err := NewTrustStore(true, pki.root.Raw, embedded[0])
+	assert.NoError(err, "Failed to create trust store")
+	assert.Equal([][]byte{embedded[0], pki.root.Raw}, store.Roots(), "Duplicates are dropped")
+
+	certs := store.Certificates()
+	assert.Equal(ROOT_SOURCE_EMBEDDED, certs[0].Source, "Source")
+	assert.Equal(appleroots.All()[0].SHA256Fingerprint, certs[0].SHA256Fingerprint, "Fingerprint")
+	assert.Equal(ROOT_SOURCE_USER, certs[1].Source, "Source")
+	assert.Equal("CN=Test Root", certs[1].Subject, "Subject")
+
+	empty, err := NewTrustStore(false)
+	assert.NoError(err, "Failed to create trust store")
+	assert.Empty(empty.Roots(), "No roots")
+	assert.NoError(empty.AddRoots(pki.root.Raw), "AddRoots failed")
+	assert.Equal([][]byte{pki.root.Raw}, empty.Roots(), "Added root")
+
+	_, err = NewTrustStore(false, []byte("invalid"))
+	assertVerificationStatus(t, INVALID_CERTIFICATE, err)
+}
+
+func TestTrustStoreLoadDirectoryAndReload(t *testing.T) {
+	assert := assert.New(t)
+	first, second := createTestPKI(t), createTestPKI(t)
+	dir := t.TempDir()
+	pemData := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: first.root.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: second.root.Raw})...)
+	assert.NoError(os.WriteFile(filepath.Join(dir, "roots.pem"), pemData, 0o600))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "README.txt"), []byte("ignored"), 0o600))
+
+	store, err := NewTrustStore(false)
+	assert.NoError(err, "Failed to create trust store")
+	assert.Error(store.Reload(), "Reload requires a directory")
+	assert.NoError(store.LoadDirectory(dir), "LoadDirectory failed")
+	assert.Equal([][]byte{first.root.Raw, second.root.Raw}, store.Roots(), "Roots from PEM")
+	assert.Equal(filepath.Join(dir, "roots.pem"), store.Certificates()[0].Path, "Path")
+
+	assert.NoError(os.Remove(filepath.Join(dir, "roots.pem")))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "root.cer"), second.root.Raw, 0o600))
+	assert.NoError(store.Reload(), "Reload failed")
+	assert.Equal([][]byte{second.root.Raw}, store.Roots(), "Roots after reload")
+
+	assert.NoError(os.WriteFile(filepath.Join(dir, "broken.der"), []byte("invalid"), 0o600))
+	assert.Error(store.Reload(), "Expected error for invalid certificate")
+	assert.Equal([][]byte{second.root.Raw}, store.Roots(), "Store is unchanged after a failed reload")
+}
+
+func TestTrustStoreExpiringWithin(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	store, err := NewTrustStore(true, pki.root.Raw)
+	assert.NoError(err, "Failed to create trust store")
+
+	now := time.Now()
+	assert.Empty(store.ExpiringWithin(24*time.Hour, now), "Nothing expires within a day")
+
+	expiring := store.ExpiringWithin(2*365*24*time.Hour, now)
+	if assert.Len(expiring, 1, "Test root expires within two years") {
+		assert.Equal("CN=Test Root", expiring[0].Subject, "Subject")
+	}
+
+	expiring = store.ExpiringWithin(0, time.Date(2040, time.January, 1, 0, 0, 0, 0, time.UTC))
+	assert.Len(expiring, 2, "Expired roots are reported")
+	assert.Equal(ROOT_SOURCE_USER, expiring[0].Source, "Ordered by expiry")
+}
+
+func TestTrustStoreChangesApplyToVerifier(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	store, err := NewTrustStore(false, pki.root.Raw)
+	assert.NoError(err, "Failed to create trust store")
+
+	_, err = NewSignedDataVerifierWithOptions([][]byte{pki.root.Raw}, WithEnvironments(ENVIRONMENT_SANDBOX), WithTrustStore(store))
+	assert.Error(err, "Root certificates can't be combined with a trust store")
+
+	verifier, err := NewSignedDataVerifierWithOptions(nil,
+		WithEnvironments(ENVIRONMENT_SANDBOX),
+		WithTrustStore(store),
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_ENABLED),
+		WithOCSPFetcher(newTestOCSPResponder(t, pki)),
+	)
+	assert.NoError(err, "Failed to create verifier")
+	cv := verifier.chainVerifier
+
+	_, err = cv.verifyChain(pki.chain(), true, time.Now())
+	assert.NoError(err, "Chain to a trusted root")
+	assert.Equal(1, cv.cache.Stats().Entries, "Chain is cached")
+
+	dir := t.TempDir()
+	replacement, err := NewTrustStore(false)
+	assert.NoError(err, "Failed to create trust store")
+	assert.NoError(replacement.LoadDirectory(dir), "LoadDirectory failed")
+	cv.trustStore = replacement
+	_, err = cv.verifyChain(pki.chain(), true, time.Now())
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+	assert.Equal(uint64(0), cv.cache.Stats().Hits, "Chains cached for the old roots aren't used")
+
+	assert.NoError(os.WriteFile(filepath.Join(dir, "root.der"), pki.root.Raw, 0o600))
+	assert.NoError(replacement.Reload(), "Reload failed")
+	_, err = cv.verifyChain(pki.chain(), true, time.Now())
+	assert.NoError(err, "Reloaded root is trusted")
+}
+
+func TestEmbeddedRootsVerifyAppleChain(t *testing.T) {
+	assert := assert.New(t)
+	store, err := NewTrustStore(true)
+	assert.NoError(err, "Failed to create trust store")
+	verifier, err := NewSignedDataVerifierWithOptions(nil, WithEnvironments(ENVIRONMENT_SANDBOX), WithTrustStore(store))
+	assert.NoError(err, "Failed to create verifier")
+
+	certs := []string{
+		REAL_APPLE_SIGNING_CERTIFICATE_BASE64_ENCODED,
+		REAL_APPLE_INTERMEDIATE_BASE64_ENCODED,
+		REAL_APPLE_ROOT_BASE64_ENCODED,
+	}
+	_, err = verifier.chainVerifier.verifyChain(certs, false, time.Unix(EFFECTIVE_DATE, 0))
+	assert.NoError(err, "Apple chain verifies against the embedded roots")
+}
@@ -0,0 +1,225 @@
+package appstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// UnknownFieldsError is returned in strict decoding mode when a verified payload has properties
+// that the library doesn't model. The signature was valid; the top-level fields are also available in the model's Extra map.
+type UnknownFieldsError struct {
+	// The JSON names of the unrecognized properties, sorted. Properties of nested objects are named by their path,
+	// such as "data.futureField", with "[]" for the elements of an array.
+	Fields []string
+}
+
+func (e *UnknownFieldsError) Error() string {
+	return fmt.Sprintf("payload has unknown fields: %s", strings.Join(e.Fields, ", "))
+}
+
+// extraModels are the payload types that keep their unrecognized properties in Extra.
+var extraModels = map[reflect.Type]bool{
+	reflect.TypeFor[JWSTransactionDecodedPayload](): true,
+	reflect.TypeFor[JWSRenewalInfoDecodedPayload](): true,
+	reflect.TypeFor[ResponseBodyV2DecodedPayload](): true,
+	reflect.TypeFor[AppTransaction]():               true,
+	reflect.TypeFor[DecodedRealtimeRequestBody]():   true,
+}
+
+var unmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// jsonField is a struct field that encoding/json decodes.
+type jsonField struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+// jsonFieldsCache maps a struct type to its fields, keyed by their lower-cased JSON name.
+var jsonFieldsCache sync.Map
+
+func jsonFields(t reflect.Type) map[string]jsonField {
+	if fields, ok := jsonFieldsCache.Load(t); ok {
+		return fields.(map[string]jsonField)
+	}
+	fields := make(map[string]jsonField, t.NumField())
+	var embedded []reflect.StructField
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			embedded = append(embedded, field)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		// encoding/json matches keys case-insensitively
+		fields[strings.ToLower(name)] = jsonField{name: name, index: field.Index, typ: field.Type}
+	}
+	// The fields of embedded structs are promoted, unless the outer struct has a field with the same name
+	for _, field := range embedded {
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		for key, promoted := range jsonFields(fieldType) {
+			if _, ok := fields[key]; !ok {
+				promoted.index = append(slices.Clone(field.Index), promoted.index...)
+				fields[key] = promoted
+			}
+		}
+	}
+	jsonFieldsCache.Store(t, fields)
+	return fields
+}
+
+// unmarshalWithExtra decodes data into target and stores the properties that target has no field for in extra.
+// The object is parsed once, and each property is then decoded into its field.
+func unmarshalWithExtra[T any](data []byte, target *T, extra *map[string]json.RawMessage) error {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	*extra = nil
+	value := reflect.ValueOf(target).Elem()
+	fields := jsonFields(value.Type())
+	for key, raw := range object {
+		field, ok := fields[strings.ToLower(key)]
+		if !ok {
+			if *extra == nil {
+				*extra = make(map[string]json.RawMessage)
+			}
+			(*extra)[key] = raw
+			continue
+		}
+		if _, exact := object[field.name]; exact && key != field.name {
+			// encoding/json prefers an exact match to a case-insensitive one
+			continue
+		}
+		if err := json.Unmarshal(raw, value.FieldByIndex(field.index).Addr().Interface()); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// marshalWithExtra encodes value, a struct, followed by the properties in extra that it has no field for.
+func marshalWithExtra(value any, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+	fields := jsonFields(reflect.TypeOf(value))
+	buf := bytes.NewBuffer(data[:len(data)-1])
+	for _, key := range slices.Sorted(maps.Keys(extra)) {
+		if _, ok := fields[strings.ToLower(key)]; ok {
+			continue
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		if raw := extra[key]; len(raw) > 0 {
+			buf.Write(raw)
+		} else {
+			buf.WriteString("null")
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeKnownFields decodes data into target in a single pass, failing on the first property that target has no field for.
+func decodeKnownFields(data []byte, target any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// decodeStrict decodes payload into destination and returns the sorted paths of the properties, at any depth,
+// that destination doesn't model. Destinations other than the payload types that keep Extra are first decoded
+// in a single pass that fails on unknown properties, so the paths are only collected when there are some.
+func decodeStrict(payload []byte, destination any) ([]string, error) {
+	t := reflect.TypeOf(destination).Elem()
+	if !extraModels[t] {
+		if err := decodeKnownFields(payload, destination); err == nil {
+			return nil, nil
+		}
+	}
+	if err := json.Unmarshal(payload, destination); err != nil {
+		return nil, err
+	}
+	paths := unknownPaths(payload, t, "", nil)
+	slices.Sort(paths)
+	return slices.Compact(paths), nil
+}
+
+// unknownPaths appends to paths the properties of data, a value of type t found at path, and of the objects
+// nested in it, that t has no field for. Types that decode themselves are skipped, apart from the payload types
+// that keep Extra.
+func unknownPaths(data json.RawMessage, t reflect.Type, path string, paths []string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(unmarshalerType) && !extraModels[t] {
+		return paths
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		var object map[string]json.RawMessage
+		if json.Unmarshal(data, &object) != nil {
+			return paths
+		}
+		fields := jsonFields(t)
+		for key, raw := range object {
+			name := key
+			if path != "" {
+				name = path + "." + key
+			}
+			if field, ok := fields[strings.ToLower(key)]; ok {
+				paths = unknownPaths(raw, field.typ, name, paths)
+			} else {
+				paths = append(paths, name)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var elements []json.RawMessage
+		if json.Unmarshal(data, &elements) != nil {
+			return paths
+		}
+		for _, element := range elements {
+			paths = unknownPaths(element, t.Elem(), path+"[]", paths)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,200 @@
+package appstore
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodedPayloadsKeepUnknownFields(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createDefaultTestSignedDataVerifier()
+	assert.NoError(err, "Failed to create verifier")
+
+	signedTransaction, err := createSignedDataFromJSONWithOverrides("models/signedTransaction.json", map[string]any{
+		"futureField":  map[string]any{"nested": true},
+		"futureNumber": int64(1<<53 + 1),
+	})
+	assert.NoError(err, "Failed to create signed data")
+	transaction, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	assert.NoError(err, "Unknown fields are accepted by default")
+	assert.Equal("com.example", transaction.BundleId, "Known fields are decoded")
+	assert.Equal(map[string]json.RawMessage{
+		"futureField":  json.RawMessage(`{"nested":true}`),
+		"futureNumber": json.RawMessage(`9007199254740993`),
+	}, transaction.Extra, "Extra")
+
+	signedRenewalInfo, err := createSignedDataFromJSONWithOverrides("models/signedRenewalInfo.json", map[string]any{"futureField": "value"})
+	assert.NoError(err, "Failed to create signed data")
+	renewalInfo, err := verifier.VerifyAndDecodeRenewalInfo(signedRenewalInfo)
+	assert.NoError(err, "Failed to verify and decode renewal info")
+	assert.Equal(json.RawMessage(`"value"`), renewalInfo.Extra["futureField"], "Extra")
+
+	signedNotification, err := createSignedDataFromJSONWithOverrides("models/signedNotification.json", map[string]any{"futureField": 1})
+	assert.NoError(err, "Failed to create signed data")
+	notification, err := verifier.VerifyAndDecodeNotification(signedNotification)
+	assert.NoError(err, "Failed to verify and decode notification")
+	assert.Equal(json.RawMessage(`1`), notification.Extra["futureField"], "Extra")
+}
+
+func TestDecodedPayloadModelsMatchTestData(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createTestSignedDataVerifierWithOptions(
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING), WithUnverifiedLocalTesting(),
+		WithBundleID("com.example"),
+		WithStrictDecoding(),
+	)
+	assert.NoError(err, "Failed to create verifier")
+
+	signedTransaction, err := createSignedDataFromJSON("models/signedTransaction.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	assert.NoError(err, "Every transaction field is modeled")
+
+	signedRenewalInfo, err := createSignedDataFromJSON("models/signedRenewalInfo.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeRenewalInfo(signedRenewalInfo)
+	assert.NoError(err, "Every renewal info field is modeled")
+
+	signedNotification, err := createSignedDataFromJSON("models/signedNotification.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeNotification(signedNotification)
+	assert.NoError(err, "Every notification field is modeled")
+
+	signedAppTransaction, err := createSignedDataFromJSON("models/appTransaction.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeAppTransaction(signedAppTransaction)
+	assert.NoError(err, "Every app transaction field is modeled")
+
+	signedRealtimeRequest, err := createSignedDataFromJSON("models/decodedRealtimeRequest.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeRealtimeRequest(signedRealtimeRequest)
+	assert.NoError(err, "Every realtime request field is modeled")
+}
+
+func TestStrictDecodingReportsUnknownFields(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createTestSignedDataVerifierWithOptions(
+		WithEnvironments(ENVIRONMENT_LOCAL_TESTING), WithUnverifiedLocalTesting(),
+		WithBundleID("com.example"),
+		WithStrictDecoding(),
+	)
+	assert.NoError(err, "Failed to create verifier")
+
+	signedTransaction, err := createSignedDataFromJSONWithOverrides("models/signedTransaction.json", map[string]any{"zeta": 1, "alpha": 2})
+	assert.NoError(err, "Failed to create signed data")
+	transaction, err := verifier.VerifyAndDecodeSignedTransaction(signedTransaction)
+	assert.Nil(transaction, "Transaction")
+	var unknownErr *UnknownFieldsError
+	if assert.True(errors.As(err, &unknownErr), "Expected UnknownFieldsError, got %v", err) {
+		assert.Equal([]string{"alpha", "zeta"}, unknownErr.Fields, "Fields")
+	}
+
+	destination := &JWSTransactionDecodedPayload{}
+	_, err = verifier.VerifyAndDecodeWithValidationTime(signedTransaction, destination)
+	assert.ErrorAs(err, &unknownErr, "Strict mode applies to every decoding method")
+	assert.Len(destination.Extra, 2, "Unknown fields are kept in Extra")
+
+	signedAppTransaction, err := createSignedDataFromJSONWithOverrides("models/appTransaction.json", map[string]any{"futureField": 1})
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeAppTransaction(signedAppTransaction)
+	if assert.ErrorAs(err, &unknownErr, "Strict mode applies to app transactions") {
+		assert.Equal([]string{"futureField"}, unknownErr.Fields, "Fields")
+	}
+
+	signedRealtimeRequest, err := createSignedDataFromJSONWithOverrides("models/decodedRealtimeRequest.json", map[string]any{"futureField": 1})
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeRealtimeRequest(signedRealtimeRequest)
+	if assert.ErrorAs(err, &unknownErr, "Strict mode applies to realtime requests") {
+		assert.Equal([]string{"futureField"}, unknownErr.Fields, "Fields")
+	}
+
+	signedNotification, err := createSignedDataFromJSONWithOverrides("models/signedNotification.json", map[string]any{
+		"data": map[string]any{"bundleId": "com.example", "environment": "LocalTesting", "futureField": 1},
+	})
+	assert.NoError(err, "Failed to create signed data")
+	_, err = verifier.VerifyAndDecodeNotification(signedNotification)
+	if assert.ErrorAs(err, &unknownErr, "Strict mode applies to nested objects") {
+		assert.Equal([]string{"data.futureField"}, unknownErr.Fields, "Fields")
+	}
+
+	type bundleOnly struct {
+		BundleID string `json:"bundleId"`
+	}
+	signedClaims, err := createSignedDataFromJSON("models/signedTransaction.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = VerifyAndDecode[bundleOnly](verifier, signedClaims)
+	if assert.ErrorAs(err, &unknownErr, "Strict mode applies to any destination type") {
+		assert.Contains(unknownErr.Fields, "transactionId", "Fields")
+		assert.NotContains(unknownErr.Fields, "bundleId", "Fields")
+	}
+	_, err = VerifyAndDecode[Claims](verifier, signedClaims)
+	assert.NoError(err, "Claims keep every property")
+}
+
+func TestDecodeStrict(t *testing.T) {
+	assert := assert.New(t)
+	var destination struct {
+		Known  int `json:"known"`
+		Nested struct {
+			Known bool `json:"known"`
+		} `json:"nested"`
+	}
+
+	fields, err := decodeStrict([]byte(`{"known": 1, "nested": {"known": true}}`), &destination)
+	assert.NoError(err, "Known properties")
+	assert.Empty(fields, "Fields")
+	assert.True(destination.Nested.Known, "Nested")
+
+	fields, err = decodeStrict([]byte(`{"known": 2, "zeta": 1, "alpha": 2}`), &destination)
+	assert.NoError(err, "Unknown properties")
+	assert.Equal([]string{"alpha", "zeta"}, fields, "Every unknown property is reported")
+	assert.Equal(2, destination.Known, "Known properties are decoded")
+
+	fields, err = decodeStrict([]byte(`{"nested": {"known": true, "unknown": true}}`), &destination)
+	assert.NoError(err, "Unknown nested property")
+	assert.Equal([]string{"nested.unknown"}, fields, "Nested unknown property")
+
+	var withSlice struct {
+		Items []struct {
+			Known bool `json:"known"`
+		} `json:"items"`
+	}
+	fields, err = decodeStrict([]byte(`{"items": [{"known": true, "unknown": 1}, {"unknown": 2}]}`), &withSlice)
+	assert.NoError(err, "Unknown property in an array")
+	assert.Equal([]string{"items[].unknown"}, fields, "Array elements")
+
+	_, err = decodeStrict([]byte(`{"known": 1} {}`), &destination)
+	assert.Error(err, "Expected error for trailing data")
+}
+
+func TestUnmarshalWithExtraMatchesKeysCaseInsensitively(t *testing.T) {
+	assert := assert.New(t)
+	var transaction JWSTransactionDecodedPayload
+	transaction.Extra = map[string]json.RawMessage{"stale": nil}
+	assert.NoError(json.Unmarshal([]byte(`{"BundleID": "com.example", "other": null}`), &transaction))
+	assert.Equal("com.example", transaction.BundleId, "BundleId")
+	assert.Equal(map[string]json.RawMessage{"other": json.RawMessage(`null`)}, transaction.Extra, "Extra is replaced")
+}
+
+func TestMarshalJSONKeepsExtra(t *testing.T) {
+	assert := assert.New(t)
+	var transaction JWSTransactionDecodedPayload
+	assert.NoError(json.Unmarshal([]byte(`{"bundleId": "com.example", "zeta": {"a": 1}, "alpha": 2}`), &transaction))
+	data, err := json.Marshal(transaction)
+	assert.NoError(err, "Marshal")
+	assert.JSONEq(`{"bundleId": "com.example", "zeta": {"a": 1}, "alpha": 2}`, string(data), "Extra is marshaled")
+
+	transaction.Extra["bundleId"] = json.RawMessage(`"stale"`)
+	data, err = json.Marshal(&transaction)
+	assert.NoError(err, "Marshal")
+	assert.JSONEq(`{"bundleId": "com.example", "zeta": {"a": 1}, "alpha": 2}`, string(data), "Modeled fields win over Extra")
+
+	data, err = json.Marshal(DecodedRealtimeRequestBody{Extra: map[string]json.RawMessage{"futureField": nil}})
+	assert.NoError(err, "Marshal")
+	var decoded DecodedRealtimeRequestBody
+	assert.NoError(json.Unmarshal(data, &decoded), "Unmarshal")
+	assert.Equal(map[string]json.RawMessage{"futureField": json.RawMessage(`null`)}, decoded.Extra, "Round trip")
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/json"
+	"maps"
 	"os"
 	"path/filepath"
 
@@ -45,12 +46,23 @@ func createTestSignedDataVerifier(env Environment, bundleID string, appAppleID *
 		appID = *appAppleID
 	}
 
-	return NewSignedDataVerifier([][]byte{testCA}, false, env, bundleID, appID)
+	opts := []SignedDataVerifierOption{WithEnvironments(env), WithBundleID(bundleID), WithAppAppleID(appID)}
+	if isLocalEnvironment(env) {
+		// Test data is signed with a throwaway key
+		opts = append(opts, WithUnverifiedLocalTesting())
+	}
+	return NewSignedDataVerifierWithOptions([][]byte{testCA}, opts...)
 }
 
 // createSignedDataFromJSON creates a signed JWT token from JSON test data
 // This generates a self-signed token for testing purposes
 func createSignedDataFromJSON(jsonPath string) (string, error) {
+	return createSignedDataFromJSONWithOverrides(jsonPath, nil)
+}
+
+// createSignedDataFromJSONWithOverrides creates a signed JWT token from JSON test data
+// after replacing the given top-level fields
+func createSignedDataFromJSONWithOverrides(jsonPath string, overrides map[string]any) (string, error) {
 	// Read the JSON payload
 	jsonData, err := readTestData(jsonPath)
 	if err != nil {
@@ -62,6 +74,7 @@ func createSignedDataFromJSON(jsonPath string) (string, error) {
 	if err := json.Unmarshal(jsonData, &payload); err != nil {
 		return "", err
 	}
+	maps.Copy(payload, overrides)
 
 	// Generate a temporary EC private key for signing
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
@@ -0,0 +1,203 @@
+package appstore
+
+import (
+	"crypto/x509"
+	"errors"
+	"time"
+
+	"github.com/laishere/app-store-server-library-go/appleroots"
+)
+
+// IdentityCheckField names a payload field that was checked against the verifier's configuration.
+type IdentityCheckField string
+
+const (
+	IDENTITY_CHECK_BUNDLE_ID    IdentityCheckField = "bundleId"
+	IDENTITY_CHECK_APP_APPLE_ID IdentityCheckField = "appAppleId"
+	IDENTITY_CHECK_ENVIRONMENT  IdentityCheckField = "environment"
+)
+
+// RevocationStatus is the outcome of a single revocation lookup.
+type RevocationStatus string
+
+const (
+	REVOCATION_STATUS_GOOD             RevocationStatus = "GOOD"
+	REVOCATION_STATUS_REVOKED          RevocationStatus = "REVOKED"
+	REVOCATION_STATUS_UNAVAILABLE      RevocationStatus = "UNAVAILABLE"
+	REVOCATION_STATUS_INVALID_RESPONSE RevocationStatus = "INVALID_RESPONSE"
+)
+
+// VerificationReport records how a piece of signed data was verified, for audit logging and dispute evidence.
+type VerificationReport struct {
+	// The outcome of the verification: OK, or the status of the returned VerificationException.
+	Status VerificationStatus
+
+	// The error returned by the verification, or nil.
+	Err error
+
+	// Whether the signature and certificate chain were verified. They aren't for Xcode and LocalTesting verifiers
+	// created with WithUnverifiedLocalTesting.
+	SignatureVerified bool
+
+	// Whether revocation was checked online.
+	OnlineChecks bool
+
+	// The certificates of the x5c header, leaf first.
+	Chain []CertificateSummary
+
+	// The trusted root the chain was verified against, or nil if it wasn't verified.
+	MatchedRoot *CertificateSummary
+
+	// The times at which the chain was validated.
+	ValidationTime ValidationTime
+
+	// Whether the chain was accepted from the chain cache, without checking revocation again.
+	CacheHit bool
+
+	// The revocation lookups performed, in order.
+	RevocationChecks []RevocationCheck
+
+	// The identity and environment checks performed, in order. Verification stops at the first failed check.
+	IdentityChecks []IdentityCheck
+}
+
+// CertificateSummary identifies a certificate in a VerificationReport.
+type CertificateSummary struct {
+	Subject           string
+	Issuer            string
+	SerialNumber      string
+	SHA256Fingerprint string
+	NotBefore         time.Time
+	NotAfter          time.Time
+}
+
+// RevocationCheck records a revocation lookup for one certificate.
+type RevocationCheck struct {
+	// The subject of the certificate that was checked.
+	Subject string
+
+	// How revocation was checked.
+	Mode RevocationMode
+
+	// The OCSP responder or CRL distribution point. It is empty for a CRL from the local bundle.
+	URL string
+
+	// The outcome of the lookup.
+	Status RevocationStatus
+
+	// Whether the outcome came from a cached response or CRL rather than a network request.
+	Cached bool
+
+	// Whether the certificate was accepted under the OCSP soft-fail policy.
+	Degraded bool
+
+	// How long the network request took. It is zero for cached outcomes.
+	ResponseTime time.Duration
+
+	// The error from the lookup, if any.
+	Err error
+}
+
+// IdentityCheck records a comparison between a payload field and the verifier's configuration.
+type IdentityCheck struct {
+	Field IdentityCheckField
+
+	// The configured value. Allowed environments are separated by commas, and "*" means any environment.
+	Expected string
+
+	// The value in the payload.
+	Actual string
+
+	Passed bool
+}
+
+// VerifyWithReport verifies signedObj and decodes it into destination like VerifyAndDecodeWithValidationTime,
+// and returns a report of every step taken. The report is returned even when verification fails.
+func (v *SignedDataVerifier) VerifyWithReport(signedObj string, destination any) (*VerificationReport, error) {
+	report := &VerificationReport{}
+	err := v.verifyWithReport(signedObj, destination, report)
+	report.Err = err
+	var vErr *VerificationException
+	switch {
+	case err == nil:
+		report.Status = OK
+	case errors.As(err, &vErr):
+		report.Status = vErr.Status
+	default:
+		report.Status = VERIFICATION_FAILURE
+	}
+	return report, err
+}
+
+func (v *SignedDataVerifier) verifyWithReport(signedObj string, destination any, report *VerificationReport) error {
+	if _, err := identityOf(destination); err != nil {
+		return err
+	}
+	report.SignatureVerified = !isLocalEnvironment(v.environment) || !v.unverifiedLocalTesting
+	report.OnlineChecks = !isLocalEnvironment(v.environment) && v.enableOnlineChecks
+	var err error
+	if report.ValidationTime, err = v.decodeSignedObject(signedObj, destination, report); err != nil {
+		return err
+	}
+	return v.verifyDecoded(destination, report)
+}
+
+func summarizeCertificate(cert *x509.Certificate) CertificateSummary {
+	return CertificateSummary{
+		Subject:           cert.Subject.String(),
+		Issuer:            cert.Issuer.String(),
+		SerialNumber:      cert.SerialNumber.String(),
+		SHA256Fingerprint: appleroots.Fingerprint(cert.Raw),
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+	}
+}
+
+// The recording methods below do nothing on a nil report, so verification code can call them unconditionally.
+
+func (r *VerificationReport) addCheck(field IdentityCheckField, expected, actual string, passed bool) {
+	if r == nil {
+		return
+	}
+	r.IdentityChecks = append(r.IdentityChecks, IdentityCheck{Field: field, Expected: expected, Actual: actual, Passed: passed})
+}
+
+func (r *VerificationReport) setChain(certs []*x509.Certificate) {
+	if r == nil {
+		return
+	}
+	r.Chain = make([]CertificateSummary, len(certs))
+	for i, cert := range certs {
+		r.Chain[i] = summarizeCertificate(cert)
+	}
+}
+
+func (r *VerificationReport) setMatchedRoot(root *x509.Certificate) {
+	if r == nil || root == nil {
+		return
+	}
+	summary := summarizeCertificate(root)
+	r.MatchedRoot = &summary
+}
+
+func (r *VerificationReport) setCacheHit() {
+	if r == nil {
+		return
+	}
+	r.CacheHit = true
+}
+
+func (r *VerificationReport) addRevocationCheck(check RevocationCheck) {
+	if r == nil {
+		return
+	}
+	r.RevocationChecks = append(r.RevocationChecks, check)
+}
+
+// markDegraded flags the most recent revocation check as accepted under soft-fail.
+func (r *VerificationReport) markDegraded() {
+	if r == nil || len(r.RevocationChecks) == 0 {
+		return
+	}
+	r.RevocationChecks[len(r.RevocationChecks)-1].Degraded = true
+}
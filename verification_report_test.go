@@ -0,0 +1,138 @@
+package appstore
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/laishere/app-store-server-library-go/appleroots"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+func createTestReportVerifier(t testing.TB, pki *testPKI, opts ...SignedDataVerifierOption) *SignedDataVerifier {
+	t.Helper()
+	opts = append([]SignedDataVerifierOption{
+		WithEnvironments(ENVIRONMENT_SANDBOX),
+		WithBundleID("com.example"),
+		WithOnlineCheckPolicy(ONLINE_CHECK_POLICY_ENABLED),
+	}, opts...)
+	verifier, err := NewSignedDataVerifierWithOptions([][]byte{pki.root.Raw}, opts...)
+	assert.NoError(t, err, "Failed to create verifier")
+	return verifier
+}
+
+func TestVerifyWithReport(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	responder := newTestOCSPResponder(t, pki)
+	verifier := createTestReportVerifier(t, pki, WithOCSPFetcher(responder))
+	signed := createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox"})
+
+	transaction := &JWSTransactionDecodedPayload{}
+	report, err := verifier.VerifyWithReport(signed, transaction)
+	assert.NoError(err, "Expected valid payload")
+	assert.Equal(OK, report.Status, "Status")
+	assert.True(report.SignatureVerified, "SignatureVerified")
+	assert.True(report.OnlineChecks, "OnlineChecks")
+	assert.False(report.CacheHit, "CacheHit")
+	assert.Equal("com.example", transaction.BundleId, "Payload is decoded")
+
+	if assert.Len(report.Chain, 3, "Chain") {
+		assert.Equal("CN=Test Leaf", report.Chain[0].Subject, "Leaf subject")
+		assert.Equal("CN=Test Intermediate", report.Chain[0].Issuer, "Leaf issuer")
+		assert.Equal("3", report.Chain[0].SerialNumber, "Leaf serial")
+		assert.Equal(appleroots.Fingerprint(pki.leaf.Raw), report.Chain[0].SHA256Fingerprint, "Leaf fingerprint")
+	}
+	if assert.NotNil(report.MatchedRoot, "MatchedRoot") {
+		assert.Equal(appleroots.Fingerprint(pki.root.Raw), report.MatchedRoot.SHA256Fingerprint, "Root fingerprint")
+	}
+	assert.False(report.ValidationTime.CurrentTime.IsZero(), "Validated at the current time")
+
+	if assert.Len(report.RevocationChecks, 2, "RevocationChecks") {
+		assert.Equal("CN=Test Intermediate", report.RevocationChecks[0].Subject, "Intermediate is checked first")
+		assert.Equal("http://ocsp.example.com/root", report.RevocationChecks[0].URL, "Responder URL")
+		assert.Equal(REVOCATION_STATUS_GOOD, report.RevocationChecks[1].Status, "Leaf status")
+		assert.False(report.RevocationChecks[1].Cached, "Fetched from the responder")
+	}
+	assert.Equal([]IdentityCheck{
+		{Field: IDENTITY_CHECK_BUNDLE_ID, Expected: "com.example", Actual: "com.example", Passed: true},
+		{Field: IDENTITY_CHECK_ENVIRONMENT, Expected: "Sandbox", Actual: "Sandbox", Passed: true},
+	}, report.IdentityChecks, "IdentityChecks")
+
+	report, err = verifier.VerifyWithReport(signed, &JWSTransactionDecodedPayload{})
+	assert.NoError(err, "Expected valid payload")
+	assert.True(report.CacheHit, "Second verification hits the chain cache")
+	assert.Len(report.Chain, 3, "Chain is reported on a cache hit")
+	if assert.NotNil(report.MatchedRoot, "MatchedRoot is reported on a cache hit") {
+		assert.Equal(pki.root.Subject.String(), report.MatchedRoot.Subject, "MatchedRoot")
+	}
+	assert.Empty(report.RevocationChecks, "Revocation isn't checked on a cache hit")
+}
+
+func TestVerifyWithReport_Failures(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	responder := newTestOCSPResponder(t, pki)
+	responder.status[pki.leaf.SerialNumber.String()] = ocsp.Revoked
+	verifier := createTestReportVerifier(t, pki, WithOCSPFetcher(responder))
+
+	signed := createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox"})
+	report, err := verifier.VerifyWithReport(signed, &JWSTransactionDecodedPayload{})
+	assert.Error(err, "Revoked certificate")
+	assert.Equal(VERIFICATION_FAILURE, report.Status, "Status")
+	assert.Equal(err, report.Err, "Err")
+	if assert.Len(report.RevocationChecks, 2, "RevocationChecks") {
+		assert.Equal(REVOCATION_STATUS_REVOKED, report.RevocationChecks[1].Status, "Leaf status")
+	}
+	assert.Empty(report.IdentityChecks, "Identity isn't checked after a failed signature")
+
+	responder.status = map[string]int{}
+	signed = createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.other", "environment": "Sandbox"})
+	report, err = verifier.VerifyWithReport(signed, &JWSTransactionDecodedPayload{})
+	assertVerificationStatus(t, INVALID_APP_IDENTIFIER, err)
+	assert.Equal(INVALID_APP_IDENTIFIER, report.Status, "Status")
+	assert.Equal([]IdentityCheck{
+		{Field: IDENTITY_CHECK_BUNDLE_ID, Expected: "com.example", Actual: "com.other", Passed: false},
+	}, report.IdentityChecks, "Verification stops at the first failed check")
+}
+
+func TestVerifyWithReport_CRL(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	nextUpdate := time.Now().Add(time.Hour)
+	fetcher := &testCRLFetcher{crls: map[string][]byte{
+		"http://crl.example.com/intermediate.crl": createTestCRL(t, pki.intermediate, pki.intermediateKey, nextUpdate, big.NewInt(3)),
+	}}
+	verifier := createTestReportVerifier(t, pki,
+		WithRevocationMode(REVOCATION_MODE_CRL),
+		WithCRLFetcher(fetcher),
+		WithCRLBundle(createTestCRL(t, pki.root, pki.rootKey, nextUpdate)),
+	)
+
+	signed := createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "environment": "Sandbox"})
+	report, err := verifier.VerifyWithReport(signed, &JWSTransactionDecodedPayload{})
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+	assert.Equal([]RevocationCheck{
+		{Subject: "CN=Test Intermediate", Mode: REVOCATION_MODE_CRL, Status: REVOCATION_STATUS_GOOD, Cached: true},
+		{Subject: "CN=Test Leaf", Mode: REVOCATION_MODE_CRL, URL: "http://crl.example.com/intermediate.crl", Status: REVOCATION_STATUS_REVOKED,
+			ResponseTime: report.RevocationChecks[1].ResponseTime, Err: report.RevocationChecks[1].Err},
+	}, report.RevocationChecks, "RevocationChecks")
+	assert.Error(report.RevocationChecks[1].Err, "Revocation error")
+}
+
+func TestVerifyWithReport_LocalTesting(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createDefaultTestSignedDataVerifier()
+	assert.NoError(err, "Failed to create verifier")
+	signedTransaction, err := createSignedDataFromJSON("models/signedTransaction.json")
+	assert.NoError(err, "Failed to create signed data")
+
+	report, err := verifier.VerifyWithReport(signedTransaction, &JWSTransactionDecodedPayload{})
+	assert.NoError(err, "Expected valid payload")
+	assert.False(report.SignatureVerified, "LocalTesting data isn't signature checked")
+	assert.Empty(report.Chain, "Chain")
+	assert.Nil(report.MatchedRoot, "MatchedRoot")
+	assert.Len(report.IdentityChecks, 2, "IdentityChecks")
+}
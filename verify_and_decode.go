@@ -0,0 +1,85 @@
+package appstore
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// PayloadCheck is a check that VerifyAndDecode applies to a payload after its signature has been verified.
+// It should return a *VerificationException when the payload is rejected.
+type PayloadCheck[T any] func(v *SignedDataVerifier, payload *T) error
+
+// VerifyAndDecode verifies signedObj with the verifier's certificate chain, revocation and decoding settings,
+// decodes its payload into a T, and applies checks in order.
+//
+// T may be any type that encoding/json can decode into, including Claims for the raw claims.
+// When T is one of the library's decoded payload types, the same checks as the matching VerifyAndDecode method
+// run before checks, so they can't be skipped by accident.
+func VerifyAndDecode[T any](v *SignedDataVerifier, signedObj string, checks ...PayloadCheck[T]) (*T, error) {
+	payload := new(T)
+	if _, err := v.decodeSignedObject(signedObj, payload, nil); err != nil {
+		return nil, err
+	}
+	if _, err := identityOf(payload); err == nil {
+		if err := v.verifyDecoded(payload, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, check := range checks {
+		if err := check(v, payload); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// CheckBundleID checks that the payload's bundle ID matches the verifier's. A mismatch fails with INVALID_APP_IDENTIFIER.
+func CheckBundleID[T any](bundleID func(payload *T) string) PayloadCheck[T] {
+	return func(v *SignedDataVerifier, payload *T) error {
+		if bundleID(payload) != v.bundleID {
+			return NewVerificationException(INVALID_APP_IDENTIFIER, errors.New("bundleId mismatch"))
+		}
+		return nil
+	}
+}
+
+// CheckAppAppleID checks that the payload's App Apple ID matches the verifier's, when the verifier requires it for the
+// payload's environment, as the VerifyAndDecode methods do. A mismatch fails with INVALID_APP_IDENTIFIER.
+func CheckAppAppleID[T any](appAppleID func(payload *T) int64, environment func(payload *T) Environment) PayloadCheck[T] {
+	return func(v *SignedDataVerifier, payload *T) error {
+		id := appAppleID(payload)
+		env := environment(payload)
+		if v.requiresAppAppleID(env) && id != v.appAppleID {
+			return NewVerificationException(INVALID_APP_IDENTIFIER, errors.New("app identifier mismatch"))
+		}
+		return nil
+	}
+}
+
+// CheckEnvironment checks that the payload's environment is one the verifier allows. A mismatch fails with INVALID_ENVIRONMENT.
+func CheckEnvironment[T any](environment func(payload *T) Environment) PayloadCheck[T] {
+	return func(v *SignedDataVerifier, payload *T) error {
+		return v.verifyEnvironment(environment(payload), nil)
+	}
+}
+
+// Claims holds the raw claims of a signed payload, keyed by name, for payloads the library doesn't model.
+type Claims map[string]json.RawMessage
+
+// String returns a string claim, or "" if the claim is missing or isn't a string.
+func (c Claims) String(name string) string {
+	var value string
+	if raw, ok := c[name]; ok {
+		_ = json.Unmarshal(raw, &value)
+	}
+	return value
+}
+
+// Int64 returns an integer claim, or 0 if the claim is missing or isn't an integer.
+func (c Claims) Int64(name string) int64 {
+	var value int64
+	if raw, ok := c[name]; ok {
+		_ = json.Unmarshal(raw, &value)
+	}
+	return value
+}
@@ -0,0 +1,90 @@
+package appstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// futurePayload stands in for a signed object the library doesn't model yet
+type futurePayload struct {
+	BundleId    string      `json:"bundleId"`
+	AppAppleId  int64       `json:"appAppleId"`
+	Environment Environment `json:"environment"`
+	Value       string      `json:"value"`
+}
+
+var futurePayloadChecks = []PayloadCheck[futurePayload]{
+	CheckBundleID(func(p *futurePayload) string { return p.BundleId }),
+	CheckAppAppleID(func(p *futurePayload) int64 { return p.AppAppleId }, func(p *futurePayload) Environment { return p.Environment }),
+	CheckEnvironment(func(p *futurePayload) Environment { return p.Environment }),
+}
+
+func TestVerifyAndDecodeCustomPayload(t *testing.T) {
+	assert := assert.New(t)
+	pki := createTestPKI(t)
+	verifier, err := NewSignedDataVerifierWithOptions([][]byte{pki.root.Raw},
+		WithEnvironments(ENVIRONMENT_PRODUCTION, ENVIRONMENT_SANDBOX),
+		WithBundleID("com.example"),
+		WithAppAppleID(1234),
+	)
+	assert.NoError(err, "Failed to create verifier")
+
+	signed := createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "appAppleId": 1234, "environment": "Production", "value": "v"})
+	payload, err := VerifyAndDecode(verifier, signed, futurePayloadChecks...)
+	assert.NoError(err, "Expected valid payload")
+	assert.Equal("v", payload.Value, "Value")
+
+	signed = createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.other", "appAppleId": 1234, "environment": "Production"})
+	_, err = VerifyAndDecode(verifier, signed, futurePayloadChecks...)
+	assertVerificationStatus(t, INVALID_APP_IDENTIFIER, err)
+
+	signed = createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "appAppleId": 5678, "environment": "Production"})
+	_, err = VerifyAndDecode(verifier, signed, futurePayloadChecks...)
+	assertVerificationStatus(t, INVALID_APP_IDENTIFIER, err)
+
+	signed = createTestSignedPayload(t, pki, jwt.MapClaims{"bundleId": "com.example", "appAppleId": 1234, "environment": "Xcode"})
+	_, err = VerifyAndDecode(verifier, signed, futurePayloadChecks...)
+	assertVerificationStatus(t, INVALID_ENVIRONMENT, err)
+
+	other := createTestPKI(t)
+	signed = createTestSignedPayload(t, other, jwt.MapClaims{"bundleId": "com.example", "appAppleId": 1234, "environment": "Production"})
+	_, err = VerifyAndDecode(verifier, signed, futurePayloadChecks...)
+	assertVerificationStatus(t, VERIFICATION_FAILURE, err)
+}
+
+func TestVerifyAndDecodeRawClaims(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createDefaultTestSignedDataVerifier()
+	assert.NoError(err, "Failed to create verifier")
+
+	signedTransaction, err := createSignedDataFromJSONWithOverrides("models/signedTransaction.json", map[string]any{"price": int64(1<<53 + 1)})
+	assert.NoError(err, "Failed to create signed data")
+	claims, err := VerifyAndDecode(verifier, signedTransaction,
+		CheckBundleID(func(c *Claims) string { return c.String("bundleId") }),
+		func(v *SignedDataVerifier, c *Claims) error {
+			if c.String("type") != string(TYPE_AUTO_RENEWABLE_SUBSCRIPTION) {
+				return errors.New("unexpected type")
+			}
+			return nil
+		},
+	)
+	assert.NoError(err, "Expected valid payload")
+	assert.Equal("23456", claims.String("transactionId"), "transactionId")
+	assert.Equal(int64(1<<53+1), claims.Int64("price"), "price keeps its precision")
+	assert.Equal("", claims.String("missing"), "Missing claim")
+	assert.Equal(int64(0), claims.Int64("transactionId"), "Claim of another type")
+}
+
+func TestVerifyAndDecodeAppliesStandardChecksToKnownTypes(t *testing.T) {
+	assert := assert.New(t)
+	verifier, err := createTestSignedDataVerifier(ENVIRONMENT_LOCAL_TESTING, "com.other", nil)
+	assert.NoError(err, "Failed to create verifier")
+
+	signedTransaction, err := createSignedDataFromJSON("models/signedTransaction.json")
+	assert.NoError(err, "Failed to create signed data")
+	_, err = VerifyAndDecode[JWSTransactionDecodedPayload](verifier, signedTransaction)
+	assertVerificationStatus(t, INVALID_APP_IDENTIFIER, err)
+}
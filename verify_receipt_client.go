@@ -0,0 +1,235 @@
+package appstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	verifyReceiptProductionURL = "https://buy.itunes.apple.com/verifyReceipt"
+	verifyReceiptSandboxURL    = "https://sandbox.itunes.apple.com/verifyReceipt"
+)
+
+// VerifyReceiptException is an error that indicates the legacy verifyReceipt endpoint returned a non-zero status.
+// Response is set when the endpoint returned a decodable body, which for some statuses still contains receipt data.
+type VerifyReceiptException struct {
+	Status   VerifyReceiptStatus
+	Response *VerifyReceiptResponse
+}
+
+func (e *VerifyReceiptException) Error() string {
+	return fmt.Sprintf("verifyReceipt failed with status %d", e.Status)
+}
+
+// IsRetryable returns true if the failure is temporary and the receipt can be verified again later.
+func (e *VerifyReceiptException) IsRetryable() bool {
+	return e.Status.IsRetryable() || (e.Response != nil && e.Response.IsRetryable)
+}
+
+// VerifyReceiptClient is a client for the deprecated verifyReceipt endpoint.
+// Use it only to support app versions that still send App Receipts; prefer the App Store Server API for everything else.
+//
+// https://developer.apple.com/documentation/appstorereceipts/verifyreceipt
+type VerifyReceiptClient struct {
+	sharedSecret  string
+	httpClient    HTTPClient
+	productionURL string
+	sandboxURL    string
+}
+
+// NewVerifyReceiptClient creates a new verifyReceipt client with default HTTP client settings.
+// The sharedSecret is your app's shared secret and is required for receipts that contain auto-renewable subscriptions.
+func NewVerifyReceiptClient(sharedSecret string) *VerifyReceiptClient {
+	return NewVerifyReceiptClientWithHTTPClient(sharedSecret, &http.Client{Timeout: 30 * time.Second})
+}
+
+// NewVerifyReceiptClientWithHTTPClient creates a new verifyReceipt client with a custom HTTP client.
+func NewVerifyReceiptClientWithHTTPClient(sharedSecret string, httpClient HTTPClient) *VerifyReceiptClient {
+	return &VerifyReceiptClient{
+		sharedSecret:  sharedSecret,
+		httpClient:    httpClient,
+		productionURL: verifyReceiptProductionURL,
+		sandboxURL:    verifyReceiptSandboxURL,
+	}
+}
+
+// VerifyReceipt sends an App Receipt to the production verifyReceipt endpoint, and retries against the sandbox
+// when the App Store reports a sandbox receipt (status 21007).
+// A non-zero final status is returned as a *VerifyReceiptException.
+//
+// https://developer.apple.com/documentation/appstorereceipts/verifyreceipt
+func (c *VerifyReceiptClient) VerifyReceipt(receiptData string, excludeOldTransactions bool) (*VerifyReceiptResponse, error) {
+	request := VerifyReceiptRequest{
+		ReceiptData:            receiptData,
+		Password:               c.sharedSecret,
+		ExcludeOldTransactions: excludeOldTransactions,
+	}
+
+	response, err := c.post(c.productionURL, request)
+	if err != nil {
+		return nil, err
+	}
+	if response.Status == VERIFY_RECEIPT_STATUS_SANDBOX_RECEIPT_IN_PRODUCTION {
+		response, err = c.post(c.sandboxURL, request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if response.Status != VERIFY_RECEIPT_STATUS_OK {
+		return nil, &VerifyReceiptException{Status: response.Status, Response: response}
+	}
+	return response, nil
+}
+
+func (c *VerifyReceiptClient) post(url string, request VerifyReceiptRequest) (*VerifyReceiptResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "app-store-server-library/go/"+Version())
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(resp.Body)
+		return nil, &APIException{
+			HTTPStatusCode: resp.StatusCode,
+			ErrorMessage:   string(message),
+		}
+	}
+
+	var response VerifyReceiptResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Transactions returns the transactions in the response mapped to JWSTransactionDecodedPayload. It returns those in
+// latest_receipt_info, which includes renewals, followed by those in the receipt's in_app array that it doesn't include,
+// such as consumables and non-renewing subscriptions. Transactions are identified by their transaction ID.
+func (r *VerifyReceiptResponse) Transactions() ([]*JWSTransactionDecodedPayload, error) {
+	var bundleID string
+	source := r.LatestReceiptInfo
+	if r.Receipt != nil {
+		bundleID = r.Receipt.BundleId
+		source = append(source[:len(source):len(source)], r.Receipt.InApp...)
+	}
+
+	transactions := make([]*JWSTransactionDecodedPayload, 0, len(source))
+	seen := make(map[string]bool, len(source))
+	for i := range source {
+		if seen[source[i].TransactionId] {
+			continue
+		}
+		seen[source[i].TransactionId] = true
+		transaction, err := source[i].ToJWSTransactionDecodedPayload(bundleID, r.Environment)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+	return transactions, nil
+}
+
+// ToJWSTransactionDecodedPayload maps a legacy receipt transaction to the JWSTransactionDecodedPayload model,
+// so that downstream code only needs to handle a single transaction model.
+//
+// Legacy receipts don't carry every field of a signed transaction. Type is only set for auto-renewable subscriptions,
+// which are identified by the presence of an expiration date, and SignedDate is left empty.
+func (t LegacyInAppTransaction) ToJWSTransactionDecodedPayload(bundleID string, environment Environment) (*JWSTransactionDecodedPayload, error) {
+	payload := &JWSTransactionDecodedPayload{
+		OriginalTransactionId:       t.OriginalTransactionId,
+		TransactionId:               t.TransactionId,
+		WebOrderLineItemId:          t.WebOrderLineItemId,
+		BundleId:                    bundleID,
+		ProductId:                   t.ProductId,
+		SubscriptionGroupIdentifier: t.SubscriptionGroupIdentifier,
+		InAppOwnershipType:          t.InAppOwnershipType,
+		IsUpgraded:                  t.IsUpgraded == "true",
+		Environment:                 environment,
+	}
+
+	var err error
+	if payload.PurchaseDate, err = parseLegacyTimestamp("purchase_date_ms", t.PurchaseDateMs); err != nil {
+		return nil, err
+	}
+	if payload.OriginalPurchaseDate, err = parseLegacyTimestamp("original_purchase_date_ms", t.OriginalPurchaseDateMs); err != nil {
+		return nil, err
+	}
+	if payload.ExpiresDate, err = parseLegacyTimestamp("expires_date_ms", t.ExpiresDateMs); err != nil {
+		return nil, err
+	}
+	if !payload.ExpiresDate.IsZero() {
+		payload.Type = TYPE_AUTO_RENEWABLE_SUBSCRIPTION
+	}
+
+	if t.Quantity != "" {
+		quantity, err := strconv.ParseInt(t.Quantity, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity %q: %w", t.Quantity, err)
+		}
+		payload.Quantity = int32(quantity)
+	}
+
+	if t.CancellationDateMs != "" {
+		revocationDate, err := parseLegacyTimestamp("cancellation_date_ms", t.CancellationDateMs)
+		if err != nil {
+			return nil, err
+		}
+		payload.RevocationDate = &revocationDate
+		reason := REVOCATION_REASON_REFUNDED_FOR_OTHER_REASON
+		if t.CancellationReason == "1" {
+			reason = REVOCATION_REASON_REFUNDED_DUE_TO_ISSUE
+		}
+		payload.RevocationReason = &reason
+	}
+
+	if t.AppAccountToken != "" {
+		appAccountToken := t.AppAccountToken
+		payload.AppAccountToken = &appAccountToken
+	}
+
+	switch {
+	case t.IsTrialPeriod == "true" || t.IsInIntroOfferPeriod == "true":
+		payload.OfferType = OFFER_TYPE_INTRODUCTORY
+	case t.PromotionalOfferId != "":
+		payload.OfferType = OFFER_TYPE_PROMOTIONAL
+		offerIdentifier := t.PromotionalOfferId
+		payload.OfferIdentifier = &offerIdentifier
+	case t.OfferCodeRefName != "":
+		payload.OfferType = OFFER_TYPE_OFFER_CODE
+		offerIdentifier := t.OfferCodeRefName
+		payload.OfferIdentifier = &offerIdentifier
+	}
+
+	return payload, nil
+}
+
+func parseLegacyTimestamp(field, value string) (Timestamp, error) {
+	if value == "" {
+		return 0, nil
+	}
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", field, value, err)
+	}
+	return Timestamp(millis), nil
+}
@@ -0,0 +1,178 @@
+package appstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type verifyReceiptMockResponse struct {
+	statusCode int
+	body       string
+}
+
+// sequenceHTTPClient returns canned responses in order and records the requests it receives
+type sequenceHTTPClient struct {
+	responses []verifyReceiptMockResponse
+	requests  []*http.Request
+	bodies    []VerifyReceiptRequest
+	err       error
+}
+
+func (m *sequenceHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var body VerifyReceiptRequest
+	data, _ := io.ReadAll(req.Body)
+	_ = json.Unmarshal(data, &body)
+	m.requests = append(m.requests, req)
+	m.bodies = append(m.bodies, body)
+
+	next := m.responses[0]
+	m.responses = m.responses[1:]
+	return &http.Response{
+		StatusCode: next.statusCode,
+		Body:       io.NopCloser(bytes.NewReader([]byte(next.body))),
+		Header:     make(http.Header),
+	}, nil
+}
+
+func TestVerifyReceipt(t *testing.T) {
+	assert := assert.New(t)
+	responseBody, err := readTestDataString("models/verifyReceiptResponse.json")
+	assert.NoError(err, "Failed to read test data")
+	mock := &sequenceHTTPClient{responses: []verifyReceiptMockResponse{{200, responseBody}}}
+	client := NewVerifyReceiptClientWithHTTPClient("secret", mock)
+
+	response, err := client.VerifyReceipt("receipt", true)
+	assert.NoError(err, "VerifyReceipt failed")
+	assert.Equal(1, len(mock.requests), "Request count")
+	assert.Equal(verifyReceiptProductionURL, mock.requests[0].URL.String(), "URL")
+	assert.Equal("receipt", mock.bodies[0].ReceiptData, "receipt-data")
+	assert.Equal("secret", mock.bodies[0].Password, "password")
+	assert.True(mock.bodies[0].ExcludeOldTransactions, "exclude-old-transactions")
+
+	assert.Equal(VERIFY_RECEIPT_STATUS_OK, response.Status, "Status")
+	assert.Equal(ENVIRONMENT_SANDBOX, response.Environment, "Environment")
+	assert.Equal("com.example", response.Receipt.BundleId, "BundleId")
+	assert.Equal(2, len(response.Receipt.InApp), "InApp")
+	assert.Equal(2, len(response.LatestReceiptInfo), "LatestReceiptInfo")
+	assert.Equal(1, len(response.PendingRenewalInfo), "PendingRenewalInfo")
+	assert.Equal("1", response.PendingRenewalInfo[0].AutoRenewStatus, "AutoRenewStatus")
+}
+
+func TestVerifyReceipt_SandboxFallback(t *testing.T) {
+	assert := assert.New(t)
+	responseBody, err := readTestDataString("models/verifyReceiptResponse.json")
+	assert.NoError(err, "Failed to read test data")
+	mock := &sequenceHTTPClient{responses: []verifyReceiptMockResponse{
+		{200, `{"status": 21007}`},
+		{200, responseBody},
+	}}
+	client := NewVerifyReceiptClientWithHTTPClient("secret", mock)
+
+	response, err := client.VerifyReceipt("receipt", false)
+	assert.NoError(err, "VerifyReceipt failed")
+	assert.Equal(2, len(mock.requests), "Request count")
+	assert.Equal(verifyReceiptProductionURL, mock.requests[0].URL.String(), "First URL")
+	assert.Equal(verifyReceiptSandboxURL, mock.requests[1].URL.String(), "Second URL")
+	assert.Equal(ENVIRONMENT_SANDBOX, response.Environment, "Environment")
+}
+
+func TestVerifyReceipt_StatusError(t *testing.T) {
+	assert := assert.New(t)
+	mock := &sequenceHTTPClient{responses: []verifyReceiptMockResponse{{200, `{"status": 21004, "environment": "Production"}`}}}
+	client := NewVerifyReceiptClientWithHTTPClient("wrong", mock)
+
+	_, err := client.VerifyReceipt("receipt", false)
+	var vErr *VerifyReceiptException
+	assert.True(errors.As(err, &vErr), "Expected VerifyReceiptException")
+	assert.Equal(VERIFY_RECEIPT_STATUS_SHARED_SECRET_MISMATCH, vErr.Status, "Status")
+	assert.False(vErr.IsRetryable(), "IsRetryable")
+	assert.Equal("verifyReceipt failed with status 21004", vErr.Error(), "Error")
+}
+
+func TestVerifyReceipt_RetryableStatus(t *testing.T) {
+	assert := assert.New(t)
+	mock := &sequenceHTTPClient{responses: []verifyReceiptMockResponse{{200, `{"status": 21150, "is-retryable": true}`}}}
+	client := NewVerifyReceiptClientWithHTTPClient("secret", mock)
+
+	_, err := client.VerifyReceipt("receipt", false)
+	var vErr *VerifyReceiptException
+	assert.True(errors.As(err, &vErr), "Expected VerifyReceiptException")
+	assert.True(vErr.Status.IsValid(), "IsValid")
+	assert.True(vErr.IsRetryable(), "IsRetryable")
+}
+
+func TestVerifyReceipt_HTTPError(t *testing.T) {
+	assert := assert.New(t)
+	mock := &sequenceHTTPClient{responses: []verifyReceiptMockResponse{{503, "unavailable"}}}
+	client := NewVerifyReceiptClientWithHTTPClient("secret", mock)
+
+	_, err := client.VerifyReceipt("receipt", false)
+	apiErr, ok := err.(*APIException)
+	assert.True(ok, "Expected APIException")
+	assert.Equal(503, apiErr.HTTPStatusCode, "HTTPStatusCode")
+
+	mock = &sequenceHTTPClient{err: errors.New("network error")}
+	client = NewVerifyReceiptClientWithHTTPClient("secret", mock)
+	_, err = client.VerifyReceipt("receipt", false)
+	assert.EqualError(err, "network error")
+}
+
+func TestVerifyReceiptResponseTransactions(t *testing.T) {
+	assert := assert.New(t)
+	data, err := readTestData("models/verifyReceiptResponse.json")
+	assert.NoError(err, "Failed to read test data")
+	var response VerifyReceiptResponse
+	assert.NoError(json.Unmarshal(data, &response), "Failed to unmarshal")
+
+	transactions, err := response.Transactions()
+	assert.NoError(err, "Transactions failed")
+	assert.Equal(3, len(transactions), "Transactions from latest_receipt_info and in_app, without duplicates")
+
+	renewal := transactions[0]
+	assert.Equal("1000000000000003", renewal.TransactionId, "TransactionId")
+	assert.Equal("1000000000000002", renewal.OriginalTransactionId, "OriginalTransactionId")
+	assert.Equal("com.example", renewal.BundleId, "BundleId")
+	assert.Equal(ENVIRONMENT_SANDBOX, renewal.Environment, "Environment")
+	assert.Equal(TYPE_AUTO_RENEWABLE_SUBSCRIPTION, renewal.Type, "Type")
+	assert.Equal(Timestamp(1698148800000), renewal.PurchaseDate, "PurchaseDate")
+	assert.Equal(Timestamp(1698152400000), renewal.ExpiresDate, "ExpiresDate")
+	assert.Equal(int32(1), renewal.Quantity, "Quantity")
+	assert.Equal(OFFER_TYPE_PROMOTIONAL, renewal.OfferType, "OfferType")
+	assert.Equal("promo_1", *renewal.OfferIdentifier, "OfferIdentifier")
+	assert.Equal("7e3fb20b-4cdb-47cc-936d-99d65f608138", *renewal.AppAccountToken, "AppAccountToken")
+	assert.Nil(renewal.RevocationDate, "RevocationDate")
+
+	original := transactions[1]
+	assert.Equal(OFFER_TYPE_INTRODUCTORY, original.OfferType, "OfferType")
+	assert.Equal(IN_APP_OWNERSHIP_TYPE_FAMILY_SHARED, original.InAppOwnershipType, "InAppOwnershipType")
+	assert.Equal(Timestamp(1698063000000), *original.RevocationDate, "RevocationDate")
+	assert.Equal(REVOCATION_REASON_REFUNDED_DUE_TO_ISSUE, *original.RevocationReason, "RevocationReason")
+
+	consumable := transactions[2]
+	assert.Equal("com.example.consumable", consumable.ProductId, "Consumables only appear in in_app")
+	assert.Equal(Type(""), consumable.Type, "Type")
+
+	response.LatestReceiptInfo = nil
+	transactions, err = response.Transactions()
+	assert.NoError(err, "Transactions failed")
+	assert.Equal(2, len(transactions), "Transactions from in_app")
+	assert.Equal("com.example.consumable", transactions[0].ProductId, "ProductId")
+	assert.Nil(transactions[1].RevocationDate, "RevocationDate")
+}
+
+func TestLegacyInAppTransaction_InvalidValues(t *testing.T) {
+	assert := assert.New(t)
+	_, err := LegacyInAppTransaction{PurchaseDateMs: "abc"}.ToJWSTransactionDecodedPayload("com.example", ENVIRONMENT_PRODUCTION)
+	assert.Error(err, "Expected error for invalid purchase_date_ms")
+	_, err = LegacyInAppTransaction{Quantity: "x"}.ToJWSTransactionDecodedPayload("com.example", ENVIRONMENT_PRODUCTION)
+	assert.Error(err, "Expected error for invalid quantity")
+}
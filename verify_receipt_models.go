@@ -0,0 +1,195 @@
+package appstore
+
+// VerifyReceiptRequest is the JSON contents you submit with the request to the legacy verifyReceipt endpoint.
+//
+// https://developer.apple.com/documentation/appstorereceipts/requestbody
+type VerifyReceiptRequest struct {
+	// The Base64-encoded receipt data.
+	ReceiptData string `json:"receipt-data"`
+
+	// Your app's shared secret, which is a hexadecimal string. Required for receipts that contain auto-renewable subscriptions.
+	Password string `json:"password,omitempty"`
+
+	// Set this value to true for the response to include only the latest renewal transaction for any subscriptions.
+	ExcludeOldTransactions bool `json:"exclude-old-transactions,omitempty"`
+}
+
+// VerifyReceiptResponse is the JSON data returned in the response from the legacy verifyReceipt endpoint.
+//
+// https://developer.apple.com/documentation/appstorereceipts/responsebody
+type VerifyReceiptResponse struct {
+	// The environment for which the receipt was generated.
+	Environment Environment `json:"environment,omitempty"`
+
+	// An indicator that an error occurred during the request. A value of true indicates a temporary issue; retry validation for this receipt at a later time.
+	IsRetryable bool `json:"is-retryable,omitempty"`
+
+	// The latest Base64-encoded app receipt. This only returns for receipts that contain auto-renewable subscriptions.
+	LatestReceipt string `json:"latest_receipt,omitempty"`
+
+	// An array that contains all in-app purchase transactions. This only returns for receipts that contain auto-renewable subscriptions.
+	//
+	// https://developer.apple.com/documentation/appstorereceipts/responsebody/latest_receipt_info
+	LatestReceiptInfo []LegacyInAppTransaction `json:"latest_receipt_info,omitempty"`
+
+	// An array where each element contains the pending renewal information for each auto-renewable subscription identified by the product_id.
+	//
+	// https://developer.apple.com/documentation/appstorereceipts/responsebody/pending_renewal_info
+	PendingRenewalInfo []LegacyPendingRenewalInfo `json:"pending_renewal_info,omitempty"`
+
+	// A JSON representation of the receipt that was sent for verification.
+	//
+	// https://developer.apple.com/documentation/appstorereceipts/responsebody/receipt
+	Receipt *LegacyReceipt `json:"receipt,omitempty"`
+
+	// Either 0 if the receipt is valid, or a status code if there is an error.
+	//
+	// https://developer.apple.com/documentation/appstorereceipts/status
+	Status VerifyReceiptStatus `json:"status"`
+}
+
+// LegacyReceipt is the decoded version of the encoded receipt data sent with the request to the legacy verifyReceipt endpoint.
+//
+// https://developer.apple.com/documentation/appstorereceipts/responsebody/receipt
+type LegacyReceipt struct {
+	// See app_item_id.
+	AdamId int64 `json:"adam_id,omitempty"`
+
+	// Generated by App Store Connect and used by the App Store to uniquely identify the app purchased.
+	AppItemId int64 `json:"app_item_id,omitempty"`
+
+	// The app's version number.
+	ApplicationVersion string `json:"application_version,omitempty"`
+
+	// The bundle identifier for the app to which the receipt belongs.
+	BundleId string `json:"bundle_id,omitempty"`
+
+	// A unique identifier for the app download transaction.
+	DownloadId int64 `json:"download_id,omitempty"`
+
+	// The time the receipt expires for apps purchased through the Volume Purchase Program, in UNIX epoch time format, in milliseconds.
+	ExpirationDateMs string `json:"expiration_date_ms,omitempty"`
+
+	// An array that contains the in-app purchase receipt fields for all in-app purchase transactions.
+	InApp []LegacyInAppTransaction `json:"in_app,omitempty"`
+
+	// The version of the app that the user originally purchased.
+	OriginalApplicationVersion string `json:"original_application_version,omitempty"`
+
+	// The time of the original app purchase, in UNIX epoch time format, in milliseconds.
+	OriginalPurchaseDateMs string `json:"original_purchase_date_ms,omitempty"`
+
+	// The time the user ordered the app available for pre-order, in UNIX epoch time format, in milliseconds.
+	PreorderDateMs string `json:"preorder_date_ms,omitempty"`
+
+	// The time the App Store generated the receipt, in UNIX epoch time format, in milliseconds.
+	ReceiptCreationDateMs string `json:"receipt_creation_date_ms,omitempty"`
+
+	// The type of receipt generated, such as Production, ProductionVPP, ProductionSandbox, or ProductionVPPSandbox.
+	ReceiptType string `json:"receipt_type,omitempty"`
+
+	// The time the request to the verifyReceipt endpoint was processed and the response was generated, in UNIX epoch time format, in milliseconds.
+	RequestDateMs string `json:"request_date_ms,omitempty"`
+
+	// An arbitrary number that identifies a revision of your app. In the sandbox, this key's value is 0.
+	VersionExternalIdentifier int64 `json:"version_external_identifier,omitempty"`
+}
+
+// LegacyInAppTransaction is an in-app purchase transaction as it appears in the in_app and latest_receipt_info arrays.
+// Numeric and Boolean values are strings, exactly as the legacy endpoint returns them.
+//
+// https://developer.apple.com/documentation/appstorereceipts/responsebody/latest_receipt_info
+type LegacyInAppTransaction struct {
+	// The appAccountToken associated with this transaction.
+	AppAccountToken string `json:"app_account_token,omitempty"`
+
+	// The time the App Store refunded a transaction or revoked it from Family Sharing, in UNIX epoch time format, in milliseconds.
+	CancellationDateMs string `json:"cancellation_date_ms,omitempty"`
+
+	// The reason for a refunded or revoked transaction. A value of "1" indicates that the customer canceled their transaction due to an actual or perceived issue within your app.
+	CancellationReason string `json:"cancellation_reason,omitempty"`
+
+	// The time a subscription expires or when it will renew, in UNIX epoch time format, in milliseconds.
+	ExpiresDateMs string `json:"expires_date_ms,omitempty"`
+
+	// A value that indicates whether the user is the purchaser of the product or is a family member with access to the product through Family Sharing.
+	InAppOwnershipType InAppOwnershipType `json:"in_app_ownership_type,omitempty"`
+
+	// An indicator of whether an auto-renewable subscription is in the introductory price period.
+	IsInIntroOfferPeriod string `json:"is_in_intro_offer_period,omitempty"`
+
+	// An indicator of whether a subscription is in the free trial period.
+	IsTrialPeriod string `json:"is_trial_period,omitempty"`
+
+	// An indicator that a subscription has been canceled due to an upgrade. This field is only present for upgrade transactions.
+	IsUpgraded string `json:"is_upgraded,omitempty"`
+
+	// The reference name of a subscription offer that you configured in App Store Connect.
+	OfferCodeRefName string `json:"offer_code_ref_name,omitempty"`
+
+	// The time of the original app purchase, in UNIX epoch time format, in milliseconds.
+	OriginalPurchaseDateMs string `json:"original_purchase_date_ms,omitempty"`
+
+	// The transaction identifier of the original purchase.
+	OriginalTransactionId string `json:"original_transaction_id,omitempty"`
+
+	// The unique identifier of the product purchased.
+	ProductId string `json:"product_id,omitempty"`
+
+	// The identifier of the subscription offer redeemed by the user.
+	PromotionalOfferId string `json:"promotional_offer_id,omitempty"`
+
+	// The time the App Store charged the user's account for a purchased or restored product, in UNIX epoch time format, in milliseconds.
+	PurchaseDateMs string `json:"purchase_date_ms,omitempty"`
+
+	// The number of consumable products purchased.
+	Quantity string `json:"quantity,omitempty"`
+
+	// The identifier of the subscription group to which the subscription belongs.
+	SubscriptionGroupIdentifier string `json:"subscription_group_identifier,omitempty"`
+
+	// A unique identifier for purchase events across devices, including subscription-renewal events.
+	WebOrderLineItemId string `json:"web_order_line_item_id,omitempty"`
+
+	// A unique identifier for a transaction such as a purchase, restore, or renewal.
+	TransactionId string `json:"transaction_id,omitempty"`
+}
+
+// LegacyPendingRenewalInfo is the pending renewal information for an auto-renewable subscription.
+// Numeric and Boolean values are strings, exactly as the legacy endpoint returns them.
+//
+// https://developer.apple.com/documentation/appstorereceipts/responsebody/pending_renewal_info
+type LegacyPendingRenewalInfo struct {
+	// The current renewal preference for the auto-renewable subscription.
+	AutoRenewProductId string `json:"auto_renew_product_id,omitempty"`
+
+	// The current renewal status for the auto-renewable subscription. "1" if the subscription will renew, "0" if the customer turned off automatic renewal.
+	AutoRenewStatus string `json:"auto_renew_status,omitempty"`
+
+	// The reason a subscription expired.
+	ExpirationIntent string `json:"expiration_intent,omitempty"`
+
+	// The time at which the grace period for subscription renewals expires, in UNIX epoch time format, in milliseconds.
+	GracePeriodExpiresDateMs string `json:"grace_period_expires_date_ms,omitempty"`
+
+	// A flag that indicates Apple is attempting to renew an expired subscription automatically.
+	IsInBillingRetryPeriod string `json:"is_in_billing_retry_period,omitempty"`
+
+	// The reference name of a subscription offer that you configured in App Store Connect.
+	OfferCodeRefName string `json:"offer_code_ref_name,omitempty"`
+
+	// The transaction identifier of the original purchase.
+	OriginalTransactionId string `json:"original_transaction_id,omitempty"`
+
+	// The price consent status for an auto-renewable subscription price increase that requires customer consent.
+	PriceConsentStatus string `json:"price_consent_status,omitempty"`
+
+	// The unique identifier of the product purchased.
+	ProductId string `json:"product_id,omitempty"`
+
+	// The identifier of the promotional offer for an auto-renewable subscription that the user redeemed.
+	PromotionalOfferId string `json:"promotional_offer_id,omitempty"`
+
+	// The status that indicates if an auto-renewable subscription is subject to a price increase.
+	PriceIncreaseStatus string `json:"price_increase_status,omitempty"`
+}
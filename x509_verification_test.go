@@ -1,6 +1,7 @@
 package appstore
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/x509"
 	"encoding/base64"
@@ -223,6 +224,12 @@ func TestAppleChainIsValidWithOCSP(t *testing.T) {
 	assert.NoError(err, "Expected no error for Apple chain with OCSP")
 }
 
+// cacheTestChain caches certs as if they had been verified online, expiring at expiry
+func cacheTestChain(cv *chainVerifier, certs []string, expiry time.Time) {
+	_, rootsScope := cv.roots()
+	cv.cache.put(cv.cacheKey(rootsScope, certs, true), cacheEntry{publicKey: nil, expiry: expiry})
+}
+
 func TestOCSPResponseCaching(t *testing.T) {
 	assert := assert.New(t)
 	rootBytes, _ := base64.StdEncoding.DecodeString(ROOT_CA_BASE64_ENCODED)
@@ -230,19 +237,22 @@ func TestOCSPResponseCaching(t *testing.T) {
 	assert.NoError(err, "Failed to create chain verifier")
 
 	certs := []string{"cert1", "cert2", "cert3"}
-	cacheKey := "cert1|cert2|cert3"
 
 	// Initial hit
-	cv.cacheMutex.Lock()
-	cv.cache[cacheKey] = cacheEntry{
-		publicKey: nil,
-		expiry:    time.Now().Add(1 * time.Hour),
-	}
-	cv.cacheMutex.Unlock()
+	cacheTestChain(cv, certs, time.Now().Add(1*time.Hour))
 
 	pubKey, err := cv.verifyChain(certs, true, time.Now())
 	assert.NoError(err, "Expected no error from cache hit")
 	assert.Nil(pubKey, "Public Key")
+
+	report := &VerificationReport{}
+	_, err = cv.verifyChainWithReport(context.Background(), certs, true, time.Now(), report)
+	assert.NoError(err, "Expected no error from cache hit with a report")
+	assert.Nil(report.MatchedRoot, "No matched root for a cache entry without one")
+
+	// Chains verified online aren't used for offline verification
+	_, err = cv.verifyChain(certs, false, time.Now())
+	assert.Error(err, "Expected error for offline verification (cache miss)")
 }
 
 func TestOCSPResponseCachingHasExpiration(t *testing.T) {
@@ -252,19 +262,14 @@ func TestOCSPResponseCachingHasExpiration(t *testing.T) {
 	assert.NoError(err, "Failed to create chain verifier")
 
 	certs := []string{"cert1", "cert2", "cert3"}
-	cacheKey := "cert1|cert2|cert3"
 
 	// Mock entry ready to expire
-	cv.cacheMutex.Lock()
-	cv.cache[cacheKey] = cacheEntry{
-		publicKey: nil,
-		expiry:    time.Now().Add(-1 * time.Hour), // Expired
-	}
-	cv.cacheMutex.Unlock()
+	cacheTestChain(cv, certs, time.Now().Add(-1*time.Hour))
 
 	// Should miss cache and fail decoding
 	_, err = cv.verifyChain(certs, true, time.Now())
 	assert.Error(err, "Expected error for dummy certificates after cache expiration")
+	assert.Equal(0, cv.cache.Stats().Entries, "Expired entry is removed")
 }
 
 func TestOCSPCachingWithDifferentChain(t *testing.T) {
@@ -276,12 +281,7 @@ func TestOCSPCachingWithDifferentChain(t *testing.T) {
 	chain1 := []string{"leaf1", "int1", "root1"}
 	chain2 := []string{"leaf2", "int2", "root2"}
 
-	cv.cacheMutex.Lock()
-	cv.cache[strings.Join(chain1, "|")] = cacheEntry{
-		publicKey: nil,
-		expiry:    time.Now().Add(1 * time.Hour),
-	}
-	cv.cacheMutex.Unlock()
+	cacheTestChain(cv, chain1, time.Now().Add(1*time.Hour))
 
 	// chain1 should hit cache
 	_, err = cv.verifyChain(chain1, true, time.Now())
@@ -301,12 +301,7 @@ func TestOCSPCachingWithSlightlyDifferentChain(t *testing.T) {
 	chain1 := []string{"leaf1", "int1", "root1"}
 	chain2 := []string{"leaf1", "int1", "root2"} // Different root
 
-	cv.cacheMutex.Lock()
-	cv.cache[strings.Join(chain1, "|")] = cacheEntry{
-		publicKey: nil,
-		expiry:    time.Now().Add(1 * time.Hour),
-	}
-	cv.cacheMutex.Unlock()
+	cacheTestChain(cv, chain1, time.Now().Add(1*time.Hour))
 
 	// chain1 should hit cache
 	_, err = cv.verifyChain(chain1, true, time.Now())
@@ -324,67 +319,32 @@ func TestCacheEviction(t *testing.T) {
 	assert.NoError(err, "Failed to create chain verifier")
 
 	// 1. Fill cache to max capacity
+	chains := make([][]string, maxCacheSize)
 	for i := range maxCacheSize {
-		key := fmt.Sprintf("chain_%d", i)
-		// We can directly manipulate the map for setup because saveToCache enforces limit
-		cv.cacheMutex.Lock()
-		cv.cache[key] = cacheEntry{
-			publicKey: nil, // Value doesn't matter for this test
-			expiry:    time.Now().Add(1 * time.Hour),
-		}
-		cv.cacheMutex.Unlock()
-	}
-
-	assert.Equal(maxCacheSize, len(cv.cache), "Setup cache size")
-
-	// 2. Add one more item - should trigger eviction of a RANDOM item since none are expired
-	newItemKey := "new_item_1"
-	cv.saveToCache(newItemKey, nil)
-
-	cv.cacheMutex.RLock()
-	assert.Equal(maxCacheSize, len(cv.cache), "Eviction failed: cache size")
-	_, ok := cv.cache[newItemKey]
-	assert.True(ok, "New item was not added to cache")
-	cv.cacheMutex.RUnlock()
-
-	// 3. Test eviction of EXPIRED items
-	// First, clear cache and refill
-	cv.cacheMutex.Lock()
-	// Clear all for fresh start
-	for k := range cv.cache {
-		delete(cv.cache, k)
-	}
-
-	// Fill with max items again
-	for i := range maxCacheSize {
-		key := fmt.Sprintf("chain_retry_%d", i)
-		expiry := time.Now().Add(1 * time.Hour)
-		// Mark half as expired
-		if i < maxCacheSize/2 {
-			expiry = time.Now().Add(-1 * time.Hour)
-		}
-		cv.cache[key] = cacheEntry{
-			publicKey: nil,
-			expiry:    expiry,
-		}
-	}
-	cv.cacheMutex.Unlock()
-
-	// Add new item
-	newItemKey2 := "new_item_2"
-	cv.saveToCache(newItemKey2, nil)
-
-	cv.cacheMutex.RLock()
-	// Verify cache size: half were expired/removed (no forced eviction needed).
-	// We added one new item, so expected size = (max / 2) + 1.
-	expectedSize := (maxCacheSize - (maxCacheSize / 2)) + 1
-	assert.Equal(expectedSize, len(cv.cache), "Expired eviction failed: expected size roughly")
-	_, ok = cv.cache[newItemKey2]
-	assert.True(ok, "New item 2 was not added to cache")
-
-	// Verify no expired items remain
-	for k, v := range cv.cache {
-		assert.True(!time.Now().After(v.expiry), "Found expired item in cache: "+k)
+		chains[i] = []string{fmt.Sprintf("chain_%d", i), "int", "root"}
+		cacheTestChain(cv, chains[i], time.Now().Add(1*time.Hour))
 	}
-	cv.cacheMutex.RUnlock()
+	assert.Equal(maxCacheSize, cv.cache.Stats().Entries, "Setup cache size")
+
+	// 2. Use the oldest chain, so that the second oldest is the least recently used
+	_, err = cv.verifyChain(chains[0], true, time.Now())
+	assert.NoError(err, "Expected no error for chains[0] (cache hit)")
+
+	// 3. Add one more item - should evict the least recently used item
+	newChain := []string{"new_item", "int", "root"}
+	cacheTestChain(cv, newChain, time.Now().Add(1*time.Hour))
+	stats := cv.cache.Stats()
+	assert.Equal(maxCacheSize, stats.Entries, "Eviction failed: cache size")
+	assert.Equal(uint64(1), stats.Evictions, "Evictions")
+
+	_, err = cv.verifyChain(newChain, true, time.Now())
+	assert.NoError(err, "New item was not added to cache")
+	_, err = cv.verifyChain(chains[0], true, time.Now())
+	assert.NoError(err, "Recently used item was evicted")
+	_, err = cv.verifyChain(chains[1], true, time.Now())
+	assert.Error(err, "Least recently used item was not evicted")
+
+	stats = cv.cache.Stats()
+	assert.Equal(uint64(3), stats.Hits, "Hits")
+	assert.Equal(uint64(1), stats.Misses, "Misses")
 }
@@ -8,10 +8,23 @@ import (
 
 const XCODE_BUNDLE_ID = "com.example.naturelab.backyardbirds.example"
 
+// createXcodeTestSignedDataVerifier creates a verifier that checks Xcode signed data against the certificate Xcode signed it with
+func createXcodeTestSignedDataVerifier() (*SignedDataVerifier, error) {
+	xcodeCert, err := readTestData("xcode/StoreKitTestCertificate.cer")
+	if err != nil {
+		return nil, err
+	}
+	return NewSignedDataVerifierWithOptions(nil,
+		WithEnvironments(ENVIRONMENT_XCODE),
+		WithBundleID(XCODE_BUNDLE_ID),
+		WithLocalTestCertificates(xcodeCert),
+	)
+}
+
 // Test Xcode signed app transaction
 func TestXcodeSignedAppTransaction(t *testing.T) {
 	assert := assert.New(t)
-	verifier, err := createTestSignedDataVerifier(ENVIRONMENT_XCODE, XCODE_BUNDLE_ID, nil)
+	verifier, err := createXcodeTestSignedDataVerifier()
 	assert.NoError(err, "Failed to create verifier")
 
 	encodedAppTransaction, err := readTestDataString("xcode/xcode-signed-app-transaction")
@@ -36,7 +49,7 @@ func TestXcodeSignedAppTransaction(t *testing.T) {
 // Test Xcode signed transaction
 func TestXcodeSignedTransaction(t *testing.T) {
 	assert := assert.New(t)
-	verifier, err := createTestSignedDataVerifier(ENVIRONMENT_XCODE, XCODE_BUNDLE_ID, nil)
+	verifier, err := createXcodeTestSignedDataVerifier()
 	assert.NoError(err, "Failed to create verifier")
 
 	encodedTransaction, err := readTestDataString("xcode/xcode-signed-transaction")
@@ -73,7 +86,7 @@ func TestXcodeSignedTransaction(t *testing.T) {
 // Test Xcode signed renewal info
 func TestXcodeSignedRenewalInfo(t *testing.T) {
 	assert := assert.New(t)
-	verifier, err := createTestSignedDataVerifier(ENVIRONMENT_XCODE, XCODE_BUNDLE_ID, nil)
+	verifier, err := createXcodeTestSignedDataVerifier()
 	assert.NoError(err, "Failed to create verifier")
 
 	encodedRenewalInfo, err := readTestDataString("xcode/xcode-signed-renewal-info")